@@ -1,12 +1,19 @@
 package app
 
 import (
+	"JWT/internal/config"
 	"JWT/internal/delivery/gin"
 	"JWT/pkg/database"
+	"log"
 )
 
 func Run() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	db := database.SQLite()
-	eng := gin.SetupRouters(db)
+	eng := gin.SetupRouters(db, cfg)
 	eng.Run(":7328")
 }
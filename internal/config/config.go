@@ -0,0 +1,357 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultPath = "config.json"
+
+type Config struct {
+	// TrustedProxies are the addresses and CIDR ranges of the reverse proxies
+	// in front of the service. Only they may set the client address with
+	// X-Forwarded-For; none are trusted by default.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// Issuer is the public base URL of the service, used as the iss claim and
+	// in the OpenID Connect discovery document.
+	Issuer string `json:"issuer"`
+	Auth   Auth   `json:"auth"`
+	// Admins are granted the admin role when they log in to the default tenant
+	// with their email verified.
+	Admins []string `json:"admins"`
+	OAuth  OAuth    `json:"oauth"`
+	Policy Policy   `json:"policy"`
+	// BruteForce limits failed logins per IP.
+	BruteForce BruteForce `json:"brute_force"`
+	// Tenants are created (or renamed) at startup. The default tenant always exists.
+	Tenants  []Tenant `json:"tenants"`
+	WebAuthn WebAuthn `json:"webauthn"`
+	Mail     Mail     `json:"mail"`
+	// EmailVerification applies to users who register themselves.
+	EmailVerification EmailVerification `json:"email_verification"`
+	PasswordReset     PasswordReset     `json:"password_reset"`
+	EmailLogin        EmailLogin        `json:"email_login"`
+	// OIDCProviders are the upstream identity providers users may sign in with.
+	OIDCProviders []OIDCProvider `json:"oidc_providers"`
+	SAML          SAML           `json:"saml"`
+	// LDAP directories check the passwords of the email domains they list.
+	LDAP []LDAPDirectory `json:"ldap"`
+}
+
+type Mail struct {
+	// Driver is "smtp", "file" (appends to File) or "log".
+	Driver string `json:"driver"`
+	From   string `json:"from"`
+	File   string `json:"file"`
+	SMTP   SMTP   `json:"smtp"`
+}
+
+type SMTP struct {
+	// Addr is host:port of the server.
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type EmailVerification struct {
+	// Mode decides what unverified users may do: "allow" signs them in as
+	// usual, "restrict" limits their tokens to the profile, "block" refuses
+	// to sign them in.
+	Mode     string   `json:"mode"`
+	TokenTTL Duration `json:"token_ttl"`
+	// ResendInterval is the least time between two emails to an address.
+	ResendInterval Duration `json:"resend_interval"`
+	// ResendPerHour limits the emails requested from one IP.
+	ResendPerHour int `json:"resend_per_hour"`
+}
+
+type PasswordReset struct {
+	// Link is the page that asks for the new password and posts it to
+	// /v1/password/reset. The token is appended as ?token=. Defaults to
+	// <issuer>/password/reset.
+	Link     string   `json:"link"`
+	TokenTTL Duration `json:"token_ttl"`
+	// PerHour limits the emails requested from one IP.
+	PerHour int `json:"per_hour"`
+}
+
+// EmailLogin signs users in with a link or a code sent to their email.
+type EmailLogin struct {
+	// Link is the page that posts the token of the link to
+	// /v1/login/email/verify. The token is appended as ?token=. Defaults to
+	// <issuer>/login/email.
+	Link string   `json:"link"`
+	TTL  Duration `json:"ttl"`
+	// MaxAttempts is how many codes may be tried per email.
+	MaxAttempts int `json:"max_attempts"`
+	// PerHour limits the emails requested from one IP.
+	PerHour int `json:"per_hour"`
+}
+
+// OIDCProvider is registered with the provider with the redirect URI
+// <issuer>/v1/login/oidc/<id>/callback.
+type OIDCProvider struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Issuer string `json:"issuer"`
+	// ClientSecret is empty for a public client.
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Scopes default to openid, email and profile.
+	Scopes []string `json:"scopes"`
+}
+
+// SAML signs users in with SAML 2.0 identity providers. The providers post
+// their responses to <issuer>/v1/saml/acs.
+type SAML struct {
+	// EntityID of the service, defaults to <issuer>/v1/saml/metadata.
+	EntityID  string         `json:"entity_id"`
+	Providers []SAMLProvider `json:"providers"`
+}
+
+type SAMLProvider struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	EntityID string `json:"entity_id"`
+	// SSOURL is the single sign-on service of the HTTP-Redirect binding.
+	SSOURL string `json:"sso_url"`
+	// CertificateFile holds the PEM certificates that sign the assertions.
+	CertificateFile string `json:"certificate_file"`
+	// Tenant is where logins started at the provider sign in to, the default
+	// one if empty. They are refused unless AllowIdPInitiated is set.
+	Tenant            string `json:"tenant"`
+	AllowIdPInitiated bool   `json:"allow_idp_initiated"`
+	// EmailAttribute defaults to the NameID in the emailAddress format.
+	EmailAttribute string `json:"email_attribute"`
+	NameAttribute  string `json:"name_attribute"`
+}
+
+// LDAPDirectory signs in the users of its domains with their directory
+// password. Users are created on their first login.
+type LDAPDirectory struct {
+	Domains []string `json:"domains"`
+	// URL is ldap://host:389 or ldaps://host:636.
+	URL      string `json:"url"`
+	StartTLS bool   `json:"start_tls"`
+	// BindDN and BindPassword are the service account that searches for the
+	// users. Without them the search is anonymous.
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	BaseDN       string `json:"base_dn"`
+	// Filter finds the user by {email} or {username}, the part of the email
+	// before the @. Defaults to (mail={email}).
+	Filter string `json:"filter"`
+	// GroupFilter finds the groups of the user by its {dn}, for directories
+	// without memberOf.
+	GroupFilter string         `json:"group_filter"`
+	Attributes  LDAPAttributes `json:"attributes"`
+	// GroupRoles maps group DNs to the roles their members hold in the tenant
+	// they sign in to.
+	GroupRoles map[string][]string `json:"group_roles"`
+	// FallbackLocal tries the local password when the directory does not know
+	// the user or is down.
+	FallbackLocal bool     `json:"fallback_local"`
+	Timeout       Duration `json:"timeout"`
+}
+
+// LDAPAttributes default to mail, cn and memberOf.
+type LDAPAttributes struct {
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Groups string `json:"groups"`
+}
+
+// WebAuthn describes the service to passkeys and security keys. The RP ID and
+// origin default to those of the issuer.
+type WebAuthn struct {
+	RPID    string   `json:"rp_id"`
+	RPName  string   `json:"rp_name"`
+	Origins []string `json:"origins"`
+}
+
+type Tenant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// SigningKeys give the tenant keys of its own, the first one signing.
+	// Its tokens are then issued by <issuer>/t/<id>, whose discovery document
+	// publishes these keys only. Without them its tokens are signed like
+	// everyone else's.
+	SigningKeys []SigningKey `json:"signing_keys"`
+	// BruteForce gives the tenant login protection of its own. Limits left
+	// out are taken from the service-wide settings.
+	BruteForce *BruteForce `json:"brute_force"`
+}
+
+type BruteForce struct {
+	MaxAttempts        int      `json:"max_attempts"`
+	BlockTime          Duration `json:"block_time"`
+	PermanentBlockTime Duration `json:"permanent_block_time"`
+}
+
+type Policy struct {
+	// File holds the access rules, see pkg/policy. Built-in rules apply
+	// while it does not exist.
+	File           string   `json:"file"`
+	ReloadInterval Duration `json:"reload_interval"`
+}
+
+type OAuth struct {
+	// Clients are registered (or updated) at startup.
+	Clients []Client `json:"clients"`
+	// Impersonators are granted the support role when they log in to the
+	// default tenant with their email verified, which allows impersonating
+	// users through token exchange.
+	Impersonators []string `json:"impersonators"`
+}
+
+type Client struct {
+	ID           string   `json:"client_id"`
+	Secret       string   `json:"client_secret"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grant_types"`
+	Public       bool     `json:"public"`
+}
+
+type Auth struct {
+	// The first key signs new tokens, the rest are only used for verification.
+	// When no static keys are configured the rotating keyring is used.
+	SigningKeys []SigningKey `json:"signing_keys"`
+	Keyring     Keyring      `json:"keyring"`
+	// TOTPIssuer is the name authenticator apps show for the accounts.
+	TOTPIssuer string `json:"totp_issuer"`
+}
+
+type Keyring struct {
+	Dir              string   `json:"dir"`
+	Algorithm        string   `json:"algorithm"`
+	RotationInterval Duration `json:"rotation_interval"`
+	PublishAhead     Duration `json:"publish_ahead"`
+	VerifyFor        Duration `json:"verify_for"`
+	CheckInterval    Duration `json:"check_interval"`
+}
+
+type SigningKey struct {
+	ID   string `json:"kid"`
+	File string `json:"file"`
+}
+
+// Load reads the JSON config pointed to by JWT_CONFIG (config.json by default).
+// A missing file is not an error: defaults are used instead.
+func Load() (Config, error) {
+	path := os.Getenv("JWT_CONFIG")
+	if path == "" {
+		path = defaultPath
+	}
+
+	cfg := defaults()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, cfg.WebAuthn.fill(cfg.Issuer)
+		}
+		return cfg, fmt.Errorf("Ошибка чтения конфигурации: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("Невалидная конфигурация %s: %w", path, err)
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	if err := cfg.WebAuthn.fill(cfg.Issuer); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (w *WebAuthn) fill(issuer string) error {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return fmt.Errorf("Невалидный issuer: %w", err)
+	}
+	if w.RPID == "" {
+		w.RPID = u.Hostname()
+	}
+	if len(w.Origins) == 0 {
+		w.Origins = []string{u.Scheme + "://" + u.Host}
+	}
+	return nil
+}
+
+func defaults() Config {
+	return Config{
+		Issuer: "http://localhost:7328",
+		WebAuthn: WebAuthn{
+			RPName: "JWT",
+		},
+		Mail: Mail{
+			Driver: "log",
+			From:   "JWT <no-reply@localhost>",
+		},
+		EmailVerification: EmailVerification{
+			Mode:           "allow",
+			TokenTTL:       Duration(24 * time.Hour),
+			ResendInterval: Duration(time.Minute),
+			ResendPerHour:  10,
+		},
+		PasswordReset: PasswordReset{
+			TokenTTL: Duration(30 * time.Minute),
+			PerHour:  10,
+		},
+		EmailLogin: EmailLogin{
+			TTL:         Duration(10 * time.Minute),
+			MaxAttempts: 5,
+			PerHour:     10,
+		},
+		BruteForce: BruteForce{
+			MaxAttempts:        5,
+			BlockTime:          Duration(5 * time.Minute),
+			PermanentBlockTime: Duration(24 * time.Hour),
+		},
+		Policy: Policy{
+			File:           "policy.rules",
+			ReloadInterval: Duration(10 * time.Second),
+		},
+		Auth: Auth{
+			TOTPIssuer: "JWT",
+			Keyring: Keyring{
+				Dir:              "keys",
+				Algorithm:        "RS256",
+				RotationInterval: Duration(30 * 24 * time.Hour),
+				PublishAhead:     Duration(24 * time.Hour),
+				VerifyFor:        Duration(8 * 24 * time.Hour),
+				CheckInterval:    Duration(time.Hour),
+			},
+		},
+	}
+}
+
+// Duration is a time.Duration written as "720h" in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	Sessions       *usecase.SessionUseCase
+	PersonalTokens *usecase.PersonalTokenUseCase
+	Clients        *usecase.ClientUseCase
+	Audit          *usecase.AuditUseCase
+}
+
+// RevokeUserTokens ends every session of the user and revokes the access
+// tokens that are still in flight, and the personal access tokens.
+func (a *AdminHandler) RevokeUserTokens(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam.Error()})
+		return
+	}
+
+	if err := a.Sessions.RevokeAll(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := a.PersonalTokens.RevokeAll(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Токены пользователя ID: %d отозваны", id)})
+}
+
+type DtoCreatedClient struct {
+	entity.Client
+	Secret string `json:"clientSecret,omitempty"`
+}
+
+func (a *AdminHandler) ListClients(c *gin.Context) {
+	clients, err := a.Clients.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, clients)
+}
+
+// CreateClient registers a client and returns its secret, which is not shown again.
+func (a *AdminHandler) CreateClient(c *gin.Context) {
+	var data struct {
+		Name         string   `json:"name" binding:"required"`
+		RedirectURIs []string `json:"redirectUris"`
+		Scopes       []string `json:"scopes"`
+		GrantTypes   []string `json:"grantTypes"`
+		Public       bool     `json:"public"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	client, secret, err := a.Clients.Create(entity.Client{
+		Name:         data.Name,
+		RedirectURIs: data.RedirectURIs,
+		Scopes:       data.Scopes,
+		GrantTypes:   data.GrantTypes,
+		Public:       data.Public,
+	})
+	if err != nil {
+		a.clientError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, DtoCreatedClient{Client: client, Secret: secret})
+}
+
+func (a *AdminHandler) RotateClientSecret(c *gin.Context) {
+	secret, err := a.Clients.RotateSecret(c.Param("id"))
+	if err != nil {
+		a.clientError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"clientId": c.Param("id"), "clientSecret": secret})
+}
+
+// DisableClient blocks the client and revokes the access tokens it holds.
+func (a *AdminHandler) DisableClient(c *gin.Context) {
+	if err := a.Clients.Disable(c.Param("id")); err != nil {
+		a.clientError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Клиент %s отключен", c.Param("id"))})
+}
+
+func (a *AdminHandler) clientError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, entity.ErrClientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrPublicClientSecret), errors.Is(err, usecase.ErrUnsupportedGrantType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListAudit returns the most recent audit events, ?limit=N of them.
+func (a *AdminHandler) ListAudit(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	events, err := a.Audit.List(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler is the admin API for the keys of partner integrations.
+type APIKeyHandler struct {
+	UseCase *usecase.APIKeyUseCase
+}
+
+type DtoCreatedAPIKey struct {
+	entity.APIKey
+	Key string `json:"apiKey"`
+}
+
+func (a *APIKeyHandler) List(c *gin.Context) {
+	keys, err := a.UseCase.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// Get returns the key with its usage.
+func (a *APIKeyHandler) Get(c *gin.Context) {
+	key, err := a.UseCase.Get(c.Param("id"))
+	if err != nil {
+		a.apiKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// Create returns the key itself, which is not shown again.
+func (a *APIKeyHandler) Create(c *gin.Context) {
+	var data struct {
+		Name       string             `json:"name" binding:"required"`
+		Tenant     string             `json:"tenant"`
+		Scopes     []string           `json:"scopes"`
+		AllowedIPs []string           `json:"allowedIps"`
+		Quota      entity.APIKeyQuota `json:"quota"`
+		ExpiresAt  *time.Time         `json:"expiresAt"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	key, secret, err := a.UseCase.Create(entity.APIKey{
+		Name:       data.Name,
+		Tenant:     data.Tenant,
+		Scopes:     data.Scopes,
+		AllowedIPs: data.AllowedIPs,
+		Quota:      data.Quota,
+		ExpiresAt:  data.ExpiresAt,
+	})
+	if err != nil {
+		a.apiKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, DtoCreatedAPIKey{APIKey: key, Key: secret})
+}
+
+// Rotate replaces the key; the old one stops working at once.
+func (a *APIKeyHandler) Rotate(c *gin.Context) {
+	key, secret, err := a.UseCase.Rotate(c.Param("id"))
+	if err != nil {
+		a.apiKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, DtoCreatedAPIKey{APIKey: key, Key: secret})
+}
+
+func (a *APIKeyHandler) Revoke(c *gin.Context) {
+	if err := a.UseCase.Revoke(c.Param("id")); err != nil {
+		a.apiKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("API ключ %s отозван", c.Param("id"))})
+}
+
+func (a *APIKeyHandler) apiKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, entity.ErrAPIKeyNotFound),
+		errors.Is(err, entity.ErrOrganizationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrAPIKeyRevoked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrAPIKeyName),
+		errors.Is(err, usecase.ErrInvalidAllowedIP),
+		errors.Is(err, usecase.ErrInvalidQuota),
+		errors.Is(err, usecase.ErrAPIKeyExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
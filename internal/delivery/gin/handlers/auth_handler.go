@@ -1,43 +1,53 @@
 package handlers
 
 import (
+	"JWT/internal/delivery/gin/middleware"
 	"JWT/internal/entity"
-	"JWT/pkg/auth"
+	"JWT/internal/usecase"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/gin-gonic/gin/binding"
+	"log"
 	"net/http"
-	"time"
 )
 
 type DtoUser struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
 }
 
 func (u *UserHandler) Register(c *gin.Context) {
-	var user entity.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var data struct {
+		entity.User
+		Tenant string `json:"tenant"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := user.HashPassword(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	tenant, ok := u.resolveTenant(c, data.Tenant)
+	if !ok {
 		return
 	}
-
-	createUser, err := u.UseCase.CreateUser(user)
+	data.User.EmailVerified = false
+	createUser, err := u.UseCase.CreateUser(tenant, data.User)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The account exists either way, the link can be sent again
+	if err := u.Verification.Send(tenant, createUser); err != nil {
+		log.Printf("Verification email to %s: %v", createUser.Email, err)
+	}
 
 	var DUser = DtoUser{
-		ID:    createUser.ID,
-		Name:  createUser.Name,
-		Email: createUser.Email,
+		ID:            createUser.ID,
+		Name:          createUser.Name,
+		Email:         createUser.Email,
+		EmailVerified: createUser.EmailVerified,
 	}
 
 	c.JSON(http.StatusOK, DUser)
@@ -47,131 +57,244 @@ func (u *UserHandler) Login(c *gin.Context) {
 	var data struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Device   string `json:"device"`
+		// Tenant is the organization to sign in to, the default one if empty
+		Tenant string `json:"tenant"`
+		// Scope and Nonce request an OpenID Connect ID token
+		Scope string `json:"scope"`
+		Nonce string `json:"nonce"`
 	}
 
-	if err := c.ShouldBindJSON(&data); err != nil {
+	// The body has already been read by the brute force middleware
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
 		return
 	}
 
-	user, err := u.UseCase.GetUserByEmail(data.Email)
+	tenant, ok := u.resolveTenant(c, data.Tenant)
+	if !ok {
+		return
+	}
+	user, err := u.Authenticator.Authenticate(tenant, data.Email, data.Password)
 	if err != nil {
-		if errors.Is(err, entity.NotFoundUser) {
+		switch {
+		case errors.Is(err, entity.NotFoundUser):
 			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
-			return
+		case errors.Is(err, usecase.ErrInvalidPassword):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, usecase.ErrDirectoryUnavailable):
+			log.Printf("Login of %s: %v", data.Email, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": usecase.ErrDirectoryUnavailable.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка сервера: %v", err)})
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка сервера: %w", err.Error())})
 		return
 	}
 
-	if user.CheckPassword(data.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неправильный пароль"})
+	grant, err := usecase.FirstPartyGrant(tenant, data.Scope, data.Nonce)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	u.completeLogin(c, user, grant, data.Device)
+}
 
-	accessExpireAt := time.Now().Add(15 * time.Minute)
-	refreshExpireAt := time.Now().Add(7 * 24 * time.Hour)
+// completeLogin follows the first factor of a login. With a second factor it
+// only earns an mfa_pending token; the attempt is not reset yet, or the code
+// could be guessed between logins. Otherwise the tokens are issued and
+// AuthenticatedKey is set.
+func (u *UserHandler) completeLogin(c *gin.Context, user entity.User, grant entity.Grant, device string) {
+	if err := u.Auth.CheckEmailVerified(user); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 
-	accessClaims := &auth.Claims{
-		Email: data.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(accessExpireAt),
-		},
+	required, err := u.MFA.Required(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if required {
+		challenge, err := u.MFA.Challenge(user, grant, device)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, challenge)
+		return
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(auth.SECRET_KEY)
+
+	tokens, err := u.Auth.IssueTokens(user, entity.Device{
+		Name:      device,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}, grant)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Ошибка генерации access токена: %w", err),
+			"error": err.Error(),
 		})
 		return
 	}
 
-	refreshClaims := &auth.Claims{
-		Email: data.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(refreshExpireAt),
-		},
+	c.Set(middleware.AuthenticatedKey, true)
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LoginMFA completes a login with the code of the authenticator app or a
+// recovery code. Wrong codes count against the brute force limits of the
+// tenant like wrong passwords do.
+func (u *UserHandler) LoginMFA(c *gin.Context) {
+	var data struct {
+		MFAToken string `json:"mfaToken" binding:"required"`
+		Code     string `json:"code" binding:"required"`
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(auth.SECRET_KEY)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Ошибка генерации refresh токена: %w", err),
-		})
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
 		return
 	}
 
-	err = u.UseCase.Login(user, refreshTokenString)
+	pending, err := u.MFA.Pending(data.MFAToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	protection := u.Protections(pending.Tenant)
+	if !middleware.Attempt(c, protection, pending.Email) {
 		return
 	}
 
-	c.JSON(http.StatusOK, auth.TokenResponse{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
-		ExpiresAt:    accessExpireAt.Unix(),
+	tokens, err := u.MFA.CompleteLogin(pending, data.Code, entity.Device{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
 	})
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidMFACode) || errors.Is(err, entity.ErrTOTPNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, usecase.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	protection.ResetAttempts(c.ClientIP())
+	c.JSON(http.StatusOK, tokens)
 }
 
-func (u *UserHandler) Refresh(c *gin.Context) {
-	var request struct {
-		RefreshToken *string `json:"refreshToken"`
+// VerifyEmail follows the link of the verification email.
+func (u *UserHandler) VerifyEmail(c *gin.Context) {
+	if err := u.Verification.Verify(c.Query("token")); err != nil {
+		if errors.Is(err, usecase.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email подтвержден"})
+}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+// ResendVerification sends the link again. The answer is the same whether
+// or not the address is registered.
+func (u *UserHandler) ResendVerification(c *gin.Context) {
+	var data struct {
+		Email  string `json:"email" binding:"required"`
+		Tenant string `json:"tenant"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+	tenant, ok := u.resolveTenant(c, data.Tenant)
+	if !ok {
 		return
 	}
 
-	claims := &auth.Claims{}
-	token, err := jwt.ParseWithClaims(*request.RefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return auth.SECRET_KEY, nil
-	})
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": fmt.Errorf("Невалидный refresh токен: %w", err),
-		})
+	if err := u.Verification.Resend(tenant, data.Email, c.ClientIP()); err != nil {
+		if errors.Is(err, usecase.ErrTooManyRequests) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Verification email to %s: %v", data.Email, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Если адрес зарегистрирован и не подтвержден, письмо отправлено"})
+}
+
+// ForgotPassword emails a reset link. The answer is the same whether or not
+// the address is registered.
+func (u *UserHandler) ForgotPassword(c *gin.Context) {
+	var data struct {
+		Email  string `json:"email" binding:"required"`
+		Tenant string `json:"tenant"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+	tenant, ok := u.resolveTenant(c, data.Tenant)
+	if !ok {
 		return
 	}
 
-	user, err := u.UseCase.GetUserByEmail(claims.Email)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	if err := u.Passwords.Forgot(tenant, data.Email, c.ClientIP()); err != nil {
+		if errors.Is(err, usecase.ErrTooManyRequests) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Password reset for %s: %v", data.Email, err)
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Если адрес зарегистрирован, на него отправлена ссылка для сброса пароля"})
+}
 
-	if user.RefreshToken != request.RefreshToken {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Невалидный refresh токен",
-		})
+func (u *UserHandler) ResetPassword(c *gin.Context) {
+	var data struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
 		return
 	}
 
-	accessExpirationTime := time.Now().Add(15 * time.Minute)
-	accessClaim := &auth.Claims{
-		Email: user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(accessExpirationTime),
-		},
+	if err := u.Passwords.Reset(data.Token, data.Password); err != nil {
+		if errors.Is(err, usecase.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaim)
-	accessTokenString, err := accessToken.SignedString(auth.SECRET_KEY)
+	c.JSON(http.StatusOK, gin.H{"message": "Пароль изменен"})
+}
+
+func (u *UserHandler) Refresh(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	tokens, err := u.Auth.Refresh(request.RefreshToken, "")
 	if err != nil {
+		if isRefreshError(err) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Errorf("Ошибка генерации access токена: %w", err.Error()),
+			"error": err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, auth.TokenResponse{
-		AccessToken: accessTokenString,
-		ExpiresAt:   accessExpirationTime.Unix(),
-	})
+	c.JSON(http.StatusOK, tokens)
 }
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"JWT/internal/usecase"
+	"JWT/pkg/auth"
+	"JWT/pkg/policy"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthzHandler lets other services evaluate the access policy.
+type AuthzHandler struct {
+	Auth  *usecase.AuthUseCase
+	Authz *usecase.AuthzUseCase
+}
+
+// Check answers whether the subject may perform the action on the resource.
+// The subject is the bearer of subjectToken, or the caller itself without one.
+// The environment is always that of the request. Must run after Authorization.
+func (a *AuthzHandler) Check(c *gin.Context) {
+	var data struct {
+		SubjectToken string         `json:"subjectToken"`
+		Action       string         `json:"action" binding:"required"`
+		Resource     map[string]any `json:"resource"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	if data.SubjectToken != "" {
+		subject, err := a.Auth.ValidateAccessToken(data.SubjectToken)
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, usecase.ErrInvalidAccessToken) && !errors.Is(err, usecase.ErrAccessTokenRevoked) {
+				status = http.StatusInternalServerError
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		claims = subject
+	}
+
+	c.JSON(http.StatusOK, a.Authz.Evaluate(policy.Request{
+		Subject:     a.Authz.Subject(claims),
+		Action:      data.Action,
+		Resource:    data.Resource,
+		Environment: usecase.Environment(c.ClientIP()),
+	}))
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceHandler lets a logged in user approve a device authorization by its user code.
+type DeviceHandler struct {
+	UseCase *usecase.DeviceUseCase
+}
+
+// Show describes the client behind a user code so the user knows what they approve.
+func (d *DeviceHandler) Show(c *gin.Context) {
+	if _, ok := currentUserID(c); !ok {
+		return
+	}
+
+	pending, err := d.UseCase.Pending(c.Query("user_code"))
+	if err != nil {
+		d.deviceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pending)
+}
+
+func (d *DeviceHandler) Decide(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var data struct {
+		UserCode string `json:"userCode" binding:"required"`
+		Action   string `json:"action" binding:"required,oneof=approve deny"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	if err := d.UseCase.Decide(data.UserCode, c.GetString("tenant"), userID, data.Action == "approve"); err != nil {
+		d.deviceError(c, err)
+		return
+	}
+	if data.Action == "approve" {
+		c.JSON(http.StatusOK, gin.H{"message": "Устройство подключено"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Запрос отклонен"})
+}
+
+func (d *DeviceHandler) deviceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, entity.ErrDeviceCodeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrDeviceCodeProcessed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"JWT/internal/delivery/gin/middleware"
+	"JWT/internal/usecase"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emailLoginCookie binds a login by email to the browser that asked for it.
+const emailLoginCookie = "email_login"
+
+// LoginEmail sends a link or a code to sign in with. The answer is the same
+// whether or not the address is registered.
+func (u *UserHandler) LoginEmail(c *gin.Context) {
+	var data struct {
+		Email  string `json:"email" binding:"required"`
+		Tenant string `json:"tenant"`
+		// Method is "link" (the default) or "code"
+		Method string `json:"method"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+	tenant, ok := u.resolveTenant(c, data.Tenant)
+	if !ok {
+		return
+	}
+	if u.Protections(tenant).IsIPBlocked(c.ClientIP()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "IP address is blocked due to suspicious activity"})
+		return
+	}
+
+	binding, err := u.EmailLogin.Start(tenant, data.Email, usecase.EmailLoginMethod(data.Method), c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidLoginMethod):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, usecase.ErrTooManyRequests):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(emailLoginCookie, binding, int(u.EmailLoginTTL/time.Second), "/v1/login/email", "", u.SecureCookies, true)
+	c.JSON(http.StatusOK, gin.H{"message": "Если адрес зарегистрирован, на него отправлено письмо для входа"})
+}
+
+// LoginEmailVerify redeems the token of the link or the code, in the browser
+// that asked for them, and answers like /v1/login. Wrong codes count against
+// the brute force limits of the tenant like wrong passwords do.
+func (u *UserHandler) LoginEmailVerify(c *gin.Context) {
+	var data struct {
+		Token  string `json:"token"`
+		Code   string `json:"code"`
+		Device string `json:"device"`
+		// Scope and Nonce request an OpenID Connect ID token
+		Scope string `json:"scope"`
+		Nonce string `json:"nonce"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil || (data.Token == "") == (data.Code == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	binding, _ := c.Cookie(emailLoginCookie)
+	login, err := u.EmailLogin.Find(binding, data.Token)
+	if err != nil {
+		u.emailLoginError(c, err)
+		return
+	}
+	grant, err := usecase.FirstPartyGrant(login.Tenant, data.Scope, data.Nonce)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	protection := u.Protections(login.Tenant)
+	if !middleware.Attempt(c, protection, login.Email) {
+		return
+	}
+
+	user, err := u.EmailLogin.Redeem(login, data.Token != "", data.Code)
+	if err != nil {
+		u.emailLoginError(c, err)
+		return
+	}
+
+	c.SetCookie(emailLoginCookie, "", -1, "/v1/login/email", "", u.SecureCookies, true)
+	u.completeLogin(c, user, grant, data.Device)
+	if c.GetBool(middleware.AuthenticatedKey) {
+		protection.ResetAttempts(c.ClientIP())
+	}
+}
+
+func (u *UserHandler) emailLoginError(c *gin.Context, err error) {
+	if errors.Is(err, usecase.ErrInvalidLoginCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
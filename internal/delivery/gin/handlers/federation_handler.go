@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"JWT/pkg/oidc"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// federationCookie keeps the state of a login sent to a provider, so that
+// the callback is only accepted in the browser that started it.
+const federationCookie = "oidc_state"
+
+func (u *UserHandler) FederationProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, u.Federation.Providers())
+}
+
+// FederationBegin sends the browser to the provider to sign in.
+func (u *UserHandler) FederationBegin(c *gin.Context) {
+	tenant, ok := u.resolveTenant(c, c.Query("tenant"))
+	if !ok {
+		return
+	}
+
+	url, state, err := u.Federation.Begin(c.Request.Context(), c.Param("provider"), tenant)
+	if err != nil {
+		u.federationError(c, err)
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(federationCookie, state, int(usecase.FederationTimeout/time.Second), "/v1/login/oidc", "", u.SecureCookies, true)
+	c.Redirect(http.StatusFound, url)
+}
+
+// FederationCallback is where the provider sends the browser back. It
+// answers like /v1/login.
+func (u *UserHandler) FederationCallback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": reason, "error_description": c.Query("error_description")})
+		return
+	}
+	browserState, _ := c.Cookie(federationCookie)
+	c.SetCookie(federationCookie, "", -1, "/v1/login/oidc", "", u.SecureCookies, true)
+
+	user, tenant, err := u.Federation.Finish(
+		c.Request.Context(),
+		c.Param("provider"),
+		c.Query("state"),
+		browserState,
+		c.Query("code"),
+	)
+	if err != nil {
+		u.federationError(c, err)
+		return
+	}
+	grant, err := usecase.FirstPartyGrant(tenant, "", "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u.completeLogin(c, user, grant, "")
+}
+
+func (u *UserHandler) federationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidFederation),
+		errors.Is(err, oidc.ErrInvalidIDToken),
+		errors.Is(err, oidc.ErrExchange):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrFederatedEmail):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrFederatedEmailClaimed),
+		errors.Is(err, entity.ErrUserAlreadyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, oidc.ErrDiscovery):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"JWT/internal/delivery/gin/middleware"
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"JWT/pkg/security"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler lets users set up two-factor authentication. Must run after
+// Authorization.
+type MFAHandler struct {
+	UseCase     *usecase.MFAUseCase
+	Protections middleware.Protections
+}
+
+type mfaCode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (m *MFAHandler) Status(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	status, err := m.UseCase.Status(userID)
+	if err != nil {
+		m.mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// Enroll returns a new secret to scan. Logins are not affected until it is
+// confirmed.
+func (m *MFAHandler) Enroll(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := m.UseCase.Enroll(userID, c.GetString("email"))
+	if err != nil {
+		m.mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm enables two-factor authentication with the first code of the app.
+func (m *MFAHandler) Confirm(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var data mfaCode
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	protection, ok := m.attempt(c)
+	if !ok {
+		return
+	}
+	codes, err := m.UseCase.Confirm(userID, data.Code)
+	if err != nil {
+		m.mfaError(c, err)
+		return
+	}
+	protection.ResetAttempts(c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (m *MFAHandler) RecoveryCodes(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var data mfaCode
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	protection, ok := m.attempt(c)
+	if !ok {
+		return
+	}
+	codes, err := m.UseCase.RegenerateRecoveryCodes(userID, data.Code)
+	if err != nil {
+		m.mfaError(c, err)
+		return
+	}
+	protection.ResetAttempts(c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (m *MFAHandler) Disable(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var data mfaCode
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	protection, ok := m.attempt(c)
+	if !ok {
+		return
+	}
+	if err := m.UseCase.Disable(userID, data.Code); err != nil {
+		m.mfaError(c, err)
+		return
+	}
+	protection.ResetAttempts(c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "Двухфакторная аутентификация отключена"})
+}
+
+// attempt counts a code against the brute force limits of the tenant, so that
+// a stolen access token is not enough to guess it.
+func (m *MFAHandler) attempt(c *gin.Context) (*security.AdvancedProtection, bool) {
+	protection := m.Protections(c.GetString("tenant"))
+	return protection, middleware.Attempt(c, protection, c.GetString("email"))
+}
+
+func (m *MFAHandler) mfaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrTOTPNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrTOTPEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
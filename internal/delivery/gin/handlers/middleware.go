@@ -1,18 +1,23 @@
 package handlers
 
 import (
+	"JWT/internal/usecase"
 	"JWT/pkg/auth"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func Authorization() gin.HandlerFunc {
+// Authorization accepts access tokens and personal access tokens, told apart
+// by the prefix of the latter.
+func Authorization(authUseCase *usecase.AuthUseCase, personalTokens *usecase.PersonalTokenUseCase) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Отсутствие Headers",
 			})
 			return
@@ -20,7 +25,7 @@ func Authorization() gin.HandlerFunc {
 
 		const bearerPrefix = "Bearer "
 		if !strings.HasPrefix(authHeader, bearerPrefix) {
-			c.JSON(http.StatusUnauthorized, gin.H{
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Невалидный формат авторизации",
 			})
 			return
@@ -28,18 +33,149 @@ func Authorization() gin.HandlerFunc {
 
 		tokenString := strings.TrimSpace(authHeader[len(bearerPrefix):])
 
-		claims := &auth.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return auth.SECRET_KEY, nil
-		})
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Невалидный токен",
+		var claims *auth.Claims
+		var err error
+		if usecase.IsPersonalToken(tokenString) {
+			claims, err = personalTokens.Validate(tokenString)
+		} else {
+			claims, err = authUseCase.ValidateAccessToken(tokenString)
+		}
+		if err != nil {
+			status := http.StatusUnauthorized
+			if !errors.Is(err, usecase.ErrInvalidAccessToken) && !errors.Is(err, usecase.ErrAccessTokenRevoked) &&
+				!errors.Is(err, usecase.ErrInvalidPersonalToken) {
+				status = http.StatusInternalServerError
+			}
+			c.AbortWithStatusJSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if claims.IsClient() {
+			c.Set("client_id", claims.ClientID)
+		} else {
+			c.Set("email", claims.Email)
+			c.Set("tenant", claims.Tenant)
+			c.Set("user_id", claims.Subject)
+			c.Set("session_id", claims.SessionID)
+		}
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// APIKeyAuthorization authenticates requests carrying an X-API-Key header
+// and leaves the others to next, usually Authorization. Keys act as clients
+// of their own, so the handlers after it see them as such.
+func APIKeyAuthorization(apiKeys *usecase.APIKeyUseCase, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := c.GetHeader("X-API-Key")
+		if secret == "" {
+			next(c)
+			return
+		}
+
+		claims, quota, err := apiKeys.Authenticate(strings.TrimSpace(secret), c.ClientIP())
+		if quota.Limit > 0 {
+			c.Header("X-RateLimit-Limit", strconv.Itoa(quota.Limit))
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(quota.Remaining))
+			c.Header("X-RateLimit-Reset", strconv.FormatInt(quota.ResetAt.Unix(), 10))
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, usecase.ErrInvalidAPIKey):
+				status = http.StatusUnauthorized
+			case errors.Is(err, usecase.ErrAPIKeyIPNotAllowed):
+				status = http.StatusForbidden
+			case errors.Is(err, usecase.ErrAPIKeyQuotaExceeded):
+				status = http.StatusTooManyRequests
+				c.Header("Retry-After", strconv.Itoa(int(time.Until(quota.ResetAt).Seconds())+1))
+			}
+			c.AbortWithStatusJSON(status, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.Set("client_id", claims.ClientID)
+		c.Set("api_key_id", claims.ClientID)
+		c.Set("tenant", claims.Tenant)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// RejectPersonalTokens keeps personal access tokens away from what manages
+// the account itself: tokens, sessions and second factors need a login.
+// Must run after Authorization.
+func RejectPersonalTokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*auth.Claims)
+		if claims.IsPersonalAccess() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": usecase.ErrPersonalTokenNotAllowed.Error(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail keeps users who have not verified their email out
+// when the mode restricts them. Tokens of clients and tokens issued before
+// verification existed pass. Must run after Authorization.
+func RequireVerifiedEmail(mode usecase.EmailVerificationMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if mode != usecase.EmailVerificationRestrict {
+			c.Next()
+			return
+		}
+		claims := c.MustGet("claims").(*auth.Claims)
+		if claims.EmailVerified != nil && !*claims.EmailVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": usecase.ErrEmailNotVerified.Error(),
 			})
 			return
 		}
+		c.Next()
+	}
+}
+
+// RequirePermission must run after Authorization.
+func RequirePermission(roles *usecase.RoleUseCase, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get("claims")
+		if ok && roles.HasPermission(claims.(*auth.Claims), permission) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Недостаточно прав",
+		})
+	}
+}
 
-		c.Set("email", claims.Email)
+// RequirePlatformPermission is RequirePermission for resources shared by all
+// tenants: roles held within an organization do not count.
+// Must run after Authorization.
+func RequirePlatformPermission(roles *usecase.RoleUseCase, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get("claims")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+			return
+		}
+		allowed, err := roles.HasPlatformPermission(claims.(*auth.Claims), permission)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+			return
+		}
 		c.Next()
 	}
 }
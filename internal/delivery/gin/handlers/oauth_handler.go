@@ -0,0 +1,557 @@
+package handlers
+
+import (
+	"JWT/internal/delivery/gin/middleware"
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"JWT/pkg/auth"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthHandler serves the RFC 6749 family of endpoints. Their error bodies
+// follow the spec rather than the {"error": message} format of /v1.
+type OAuthHandler struct {
+	Auth      *usecase.AuthUseCase
+	Clients   *usecase.ClientUseCase
+	OAuth     *usecase.OAuthUseCase
+	Devices   *usecase.DeviceUseCase
+	Exchanges *usecase.TokenExchangeUseCase
+	Users     usecase.UserUseCase
+	// Authenticator checks the passwords entered on the authorize page
+	Authenticator usecase.Authenticator
+	// Organizations resolves the tenant users sign in to on the authorize page
+	Organizations *usecase.OrganizationUseCase
+	MFA           *usecase.MFAUseCase
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// IssuedTokenType is only part of token exchange responses
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// Authorize shows the login and consent page of the authorization code flow.
+func (o *OAuthHandler) Authorize(c *gin.Context) {
+	var request usecase.AuthorizeRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		renderError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	client, ok := o.validateAuthorize(c, &request)
+	if !ok {
+		return
+	}
+	renderAuthorize(c, http.StatusOK, client, request, "", "")
+}
+
+// AuthorizeSubmit authenticates the user and, if they approved, redirects
+// back to the client with a code.
+func (o *OAuthHandler) AuthorizeSubmit(c *gin.Context) {
+	var request usecase.AuthorizeRequest
+	if err := c.ShouldBind(&request); err != nil {
+		renderError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	client, ok := o.validateAuthorize(c, &request)
+	if !ok {
+		return
+	}
+
+	if c.PostForm("action") != "approve" {
+		redirectWithError(c, request, &usecase.OAuthError{Code: "access_denied", Description: "the user denied the request"})
+		return
+	}
+
+	email := c.PostForm("email")
+	user, err := o.Authenticator.Authenticate(request.Tenant, email, c.PostForm("password"))
+	if err != nil {
+		switch {
+		case errors.Is(err, entity.NotFoundUser), errors.Is(err, usecase.ErrInvalidPassword):
+			renderAuthorize(c, http.StatusUnauthorized, client, request, email, "Неверный email или пароль")
+		case errors.Is(err, usecase.ErrDirectoryUnavailable):
+			log.Printf("Login of %s: %v", email, err)
+			renderAuthorize(c, http.StatusServiceUnavailable, client, request, email, usecase.ErrDirectoryUnavailable.Error())
+		default:
+			renderError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	// The page asks for both factors at once
+	required, err := o.MFA.Required(user.ID)
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if required {
+		if err := o.MFA.Verify(user.ID, c.PostForm("code")); err != nil {
+			if !errors.Is(err, usecase.ErrInvalidMFACode) {
+				renderError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			renderAuthorize(c, http.StatusUnauthorized, client, request, email, "Неверный код двухфакторной аутентификации")
+			return
+		}
+	}
+	c.Set(middleware.AuthenticatedKey, true)
+	if err := o.Auth.CheckEmailVerified(user); err != nil {
+		renderAuthorize(c, http.StatusForbidden, client, request, email, err.Error())
+		return
+	}
+
+	code, err := o.OAuth.IssueCode(client, user, request)
+	if err != nil {
+		var oauthErr *usecase.OAuthError
+		if errors.As(err, &oauthErr) {
+			redirectWithError(c, request, oauthErr)
+			return
+		}
+		renderError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	redirectWithParams(c, request.RedirectURI, url.Values{"code": {code}, "state": {request.State}})
+}
+
+// Token is the token endpoint. Every grant type authenticates the client first.
+func (o *OAuthHandler) Token(c *gin.Context) {
+	client, ok := o.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	grantType := c.PostForm("grant_type")
+	if grantType == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	}
+	if !client.AllowsGrant(grantType) {
+		oauthError(c, http.StatusBadRequest, "unauthorized_client", "the client may not use this grant_type")
+		return
+	}
+
+	device := entity.Device{Name: client.Name, UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+
+	var (
+		tokens          auth.TokenResponse
+		scope           string
+		issuedTokenType string
+		err             error
+	)
+	switch grantType {
+	case entity.GrantAuthorizationCode:
+		tokens, scope, err = o.OAuth.ExchangeCode(
+			client,
+			c.PostForm("code"),
+			c.PostForm("redirect_uri"),
+			c.PostForm("code_verifier"),
+			device,
+		)
+	case entity.GrantRefreshToken:
+		tokens, err = o.Auth.Refresh(c.PostForm("refresh_token"), client.ID)
+		if isRefreshError(err) {
+			err = &usecase.OAuthError{Code: "invalid_grant", Description: err.Error()}
+		}
+	case entity.GrantClientCredentials:
+		tokens, scope, err = o.OAuth.ClientCredentials(client, c.PostForm("scope"))
+	case entity.GrantDeviceCode:
+		tokens, scope, err = o.Devices.Exchange(client, c.PostForm("device_code"), device)
+	case entity.GrantTokenExchange:
+		var request usecase.TokenExchangeRequest
+		if err := c.ShouldBind(&request); err != nil {
+			oauthError(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		tokens, scope, err = o.Exchanges.Exchange(client, request, c.ClientIP())
+		issuedTokenType = usecase.TokenTypeAccessToken
+	default:
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant_type")
+		return
+	}
+	if errors.Is(err, usecase.ErrEmailNotVerified) {
+		err = &usecase.OAuthError{Code: "invalid_grant", Description: err.Error()}
+	}
+	if err != nil {
+		var oauthErr *usecase.OAuthError
+		if errors.As(err, &oauthErr) {
+			oauthError(c, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+			return
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, oauthTokenResponse{
+		AccessToken:     tokens.AccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       tokens.ExpiresAt - time.Now().Unix(),
+		RefreshToken:    tokens.RefreshToken,
+		Scope:           scope,
+		IDToken:         tokens.IDToken,
+		IssuedTokenType: issuedTokenType,
+	})
+}
+
+// UserInfo is the OpenID Connect userinfo endpoint. It must run after Authorization.
+func (o *OAuthHandler) UserInfo(c *gin.Context) {
+	claims := c.MustGet("claims").(*auth.Claims)
+
+	info, err := o.Auth.UserInfo(claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInsufficientScope):
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			oauthError(c, http.StatusForbidden, "insufficient_scope", "the access token was not granted the openid scope")
+		case errors.Is(err, usecase.ErrInvalidAccessToken), errors.Is(err, entity.NotFoundUser):
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			oauthError(c, http.StatusUnauthorized, "invalid_token", err.Error())
+		default:
+			oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		}
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// DeviceAuthorization starts the RFC 8628 flow for a client without a browser.
+func (o *OAuthHandler) DeviceAuthorization(c *gin.Context) {
+	client, ok := o.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	authorization, err := o.Devices.Authorize(client, c.PostForm("scope"))
+	if err != nil {
+		var oauthErr *usecase.OAuthError
+		if errors.As(err, &oauthErr) {
+			oauthError(c, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+			return
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, authorization)
+}
+
+// DeviceVerification is the verification_uri of the device flow: the page
+// where the user signs in and approves the code shown on the device.
+func (o *OAuthHandler) DeviceVerification(c *gin.Context) {
+	form := deviceForm{UserCode: c.Query("user_code"), Tenant: c.Query("tenant")}
+	if form.UserCode == "" {
+		renderDevice(c, http.StatusOK, form, "")
+		return
+	}
+	if !o.pendingDevice(c, &form) {
+		return
+	}
+	renderDevice(c, http.StatusOK, form, "")
+}
+
+// DeviceVerificationSubmit authenticates the user like AuthorizeSubmit does
+// and records their decision on the user code.
+func (o *OAuthHandler) DeviceVerificationSubmit(c *gin.Context) {
+	form := deviceForm{
+		UserCode: c.PostForm("user_code"),
+		Tenant:   c.PostForm("tenant"),
+		Email:    c.PostForm("email"),
+	}
+	if !o.pendingDevice(c, &form) {
+		return
+	}
+	tenant, err := o.Organizations.Resolve(form.Tenant)
+	if err != nil {
+		if errors.Is(err, entity.ErrOrganizationNotFound) {
+			renderDevice(c, http.StatusBadRequest, form, err.Error())
+			return
+		}
+		renderError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user, err := o.Authenticator.Authenticate(tenant, form.Email, c.PostForm("password"))
+	if err != nil {
+		switch {
+		case errors.Is(err, entity.NotFoundUser), errors.Is(err, usecase.ErrInvalidPassword):
+			renderDevice(c, http.StatusUnauthorized, form, "Неверный email или пароль")
+		case errors.Is(err, usecase.ErrDirectoryUnavailable):
+			log.Printf("Login of %s: %v", form.Email, err)
+			renderDevice(c, http.StatusServiceUnavailable, form, usecase.ErrDirectoryUnavailable.Error())
+		default:
+			renderError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	required, err := o.MFA.Required(user.ID)
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if required {
+		if err := o.MFA.Verify(user.ID, c.PostForm("code")); err != nil {
+			if !errors.Is(err, usecase.ErrInvalidMFACode) {
+				renderError(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			renderDevice(c, http.StatusUnauthorized, form, "Неверный код двухфакторной аутентификации")
+			return
+		}
+	}
+	c.Set(middleware.AuthenticatedKey, true)
+	if err := o.Auth.CheckEmailVerified(user); err != nil {
+		renderDevice(c, http.StatusForbidden, form, err.Error())
+		return
+	}
+
+	approve := c.PostForm("action") == "approve"
+	if err := o.Devices.Decide(form.UserCode, tenant, user.ID, approve); err != nil {
+		if errors.Is(err, entity.ErrDeviceCodeNotFound) || errors.Is(err, entity.ErrDeviceCodeProcessed) {
+			renderDevice(c, http.StatusConflict, form, err.Error())
+			return
+		}
+		renderError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	form.Message = "Запрос отклонен"
+	if approve {
+		form.Message = "Устройство подключено, вернитесь к нему"
+	}
+	renderDevice(c, http.StatusOK, form, "")
+}
+
+type deviceForm struct {
+	UserCode string
+	Tenant   string
+	Email    string
+	Device   *usecase.PendingDevice
+	Message  string
+}
+
+// pendingDevice looks up the user code of the form, rendering the page with
+// the error if it cannot be approved.
+func (o *OAuthHandler) pendingDevice(c *gin.Context, form *deviceForm) bool {
+	pending, err := o.Devices.Pending(form.UserCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, entity.ErrDeviceCodeNotFound):
+			renderDevice(c, http.StatusNotFound, *form, err.Error())
+		case errors.Is(err, entity.ErrDeviceCodeProcessed):
+			renderDevice(c, http.StatusConflict, *form, err.Error())
+		default:
+			renderError(c, http.StatusInternalServerError, err.Error())
+		}
+		return false
+	}
+	form.Device = &pending
+	return true
+}
+
+func renderDevice(c *gin.Context, status int, form deviceForm, message string) {
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	var scopes []string
+	if form.Device != nil {
+		scopes = strings.Fields(form.Device.Scope)
+	}
+	c.HTML(status, "device.html", gin.H{
+		"Title":    "Подключение устройства",
+		"Device":   form.Device,
+		"Scopes":   scopes,
+		"UserCode": form.UserCode,
+		"Tenant":   form.Tenant,
+		"Email":    form.Email,
+		"Message":  form.Message,
+		"Error":    message,
+	})
+	c.Abort()
+}
+
+// validateAuthorize also resolves the tenant of the request.
+func (o *OAuthHandler) validateAuthorize(c *gin.Context, request *usecase.AuthorizeRequest) (entity.Client, bool) {
+	client, err := o.OAuth.ValidateAuthorize(*request)
+	if err == nil {
+		request.Tenant, err = o.Organizations.Resolve(request.Tenant)
+		if errors.Is(err, entity.ErrOrganizationNotFound) {
+			err = &usecase.OAuthError{Code: "invalid_request", Description: "unknown tenant"}
+		}
+	}
+	if err == nil {
+		return client, true
+	}
+
+	var oauthErr *usecase.OAuthError
+	switch {
+	case errors.As(err, &oauthErr):
+		redirectWithError(c, *request, oauthErr)
+	case errors.Is(err, usecase.ErrInvalidRedirect), errors.Is(err, entity.ErrClientDisabled):
+		renderError(c, http.StatusBadRequest, err.Error())
+	default:
+		renderError(c, http.StatusInternalServerError, err.Error())
+	}
+	return entity.Client{}, false
+}
+
+// isRefreshError tells the refresh tokens that are no good from failures of
+// the service. A user that left the tenant since the login has none.
+func isRefreshError(err error) bool {
+	return errors.Is(err, entity.NotFoundUser) ||
+		errors.Is(err, entity.ErrInvalidRefreshToken) ||
+		errors.Is(err, entity.ErrRefreshTokenRevoked) ||
+		errors.Is(err, entity.ErrRefreshTokenReused) ||
+		errors.Is(err, entity.ErrSessionRevoked)
+}
+
+func renderAuthorize(
+	c *gin.Context,
+	status int,
+	client entity.Client,
+	request usecase.AuthorizeRequest,
+	email string,
+	message string,
+) {
+	// Forbid framing to prevent clickjacking of the consent buttons
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.HTML(status, "authorize.html", gin.H{
+		"Title":  "Вход",
+		"Client": client,
+		"Scopes": strings.Fields(request.Scope),
+		"Email":  email,
+		"Error":  message,
+		"Params": map[string]string{
+			"client_id":             request.ClientID,
+			"redirect_uri":          request.RedirectURI,
+			"response_type":         request.ResponseType,
+			"scope":                 request.Scope,
+			"state":                 request.State,
+			"code_challenge":        request.CodeChallenge,
+			"code_challenge_method": request.CodeChallengeMethod,
+			"nonce":                 request.Nonce,
+			"tenant":                request.Tenant,
+		},
+	})
+}
+
+func renderError(c *gin.Context, status int, message string) {
+	c.HTML(status, "error.html", gin.H{"Title": "Ошибка", "Error": message})
+	c.Abort()
+}
+
+func redirectWithError(c *gin.Context, request usecase.AuthorizeRequest, err *usecase.OAuthError) {
+	redirectWithParams(c, request.RedirectURI, url.Values{
+		"error":             {err.Code},
+		"error_description": {err.Description},
+		"state":             {request.State},
+	})
+}
+
+func redirectWithParams(c *gin.Context, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := target.Query()
+	for name, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(name, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, target.String())
+	c.Abort()
+}
+
+// Introspect implements RFC 7662 for the API gateway and other resource servers.
+func (o *OAuthHandler) Introspect(c *gin.Context) {
+	client, ok := o.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if client.Public {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "public clients may not introspect tokens")
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	introspection, err := o.Auth.Introspect(token, c.PostForm("token_type_hint"))
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, introspection)
+}
+
+// Revoke implements RFC 7009 for access and refresh tokens.
+func (o *OAuthHandler) Revoke(c *gin.Context) {
+	client, ok := o.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	err := o.Auth.Revoke(token, c.PostForm("token_type_hint"), client.ID)
+	if err != nil {
+		if errors.Is(err, usecase.ErrForeignToken) {
+			oauthError(c, http.StatusBadRequest, "unauthorized_client", err.Error())
+			return
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// authenticateClient accepts client_secret_basic and client_secret_post.
+func (o *OAuthHandler) authenticateClient(c *gin.Context) (entity.Client, bool) {
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	client, err := o.Clients.Authenticate(id, secret)
+	if err != nil {
+		if errors.Is(err, entity.ErrInvalidClientSecret) || errors.Is(err, entity.ErrClientDisabled) {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+			oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+			return entity.Client{}, false
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		return entity.Client{}, false
+	}
+	return client, true
+}
+
+func oauthError(c *gin.Context, status int, code string, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrganizationHandler is the admin API for tenants, their members and the
+// roles members hold within them.
+type OrganizationHandler struct {
+	UseCase *usecase.OrganizationUseCase
+}
+
+func (o *OrganizationHandler) List(c *gin.Context) {
+	orgs, err := o.UseCase.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, orgs)
+}
+
+// Save creates the organization named in the path or renames it.
+func (o *OrganizationHandler) Save(c *gin.Context) {
+	var data struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	if err := o.UseCase.Save(entity.Organization{ID: c.Param("id"), Name: data.Name}); err != nil {
+		o.organizationError(c, err)
+		return
+	}
+	org, err := o.UseCase.Get(c.Param("id"))
+	if err != nil {
+		o.organizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+func (o *OrganizationHandler) Members(c *gin.Context) {
+	members, err := o.UseCase.Members(c.Param("id"))
+	if err != nil {
+		o.organizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// AddMember adds an existing user, e.g. one registered in another tenant.
+func (o *OrganizationHandler) AddMember(c *gin.Context) {
+	userID, ok := memberID(c)
+	if !ok {
+		return
+	}
+	if err := o.UseCase.AddMember(c.Param("id"), userID); err != nil {
+		o.organizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Пользователь добавлен в организацию"})
+}
+
+func (o *OrganizationHandler) RemoveMember(c *gin.Context) {
+	userID, ok := memberID(c)
+	if !ok {
+		return
+	}
+	if err := o.UseCase.RemoveMember(c.Param("id"), userID); err != nil {
+		o.organizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Пользователь исключен из организации"})
+}
+
+func (o *OrganizationHandler) MemberRoles(c *gin.Context) {
+	userID, ok := memberID(c)
+	if !ok {
+		return
+	}
+	roles, err := o.UseCase.MemberRoles(c.Param("id"), userID)
+	if err != nil {
+		o.organizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+func (o *OrganizationHandler) AssignRole(c *gin.Context) {
+	userID, ok := memberID(c)
+	if !ok {
+		return
+	}
+	var data struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	if err := o.UseCase.AssignRole(c.Param("id"), userID, data.Role); err != nil {
+		o.organizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Роль назначена"})
+}
+
+func (o *OrganizationHandler) UnassignRole(c *gin.Context) {
+	userID, ok := memberID(c)
+	if !ok {
+		return
+	}
+	if err := o.UseCase.UnassignRole(c.Param("id"), userID, c.Param("role")); err != nil {
+		o.organizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Роль снята"})
+}
+
+func memberID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+func (o *OrganizationHandler) organizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, entity.ErrOrganizationNotFound),
+		errors.Is(err, entity.ErrNotMember),
+		errors.Is(err, entity.NotFoundUser),
+		errors.Is(err, entity.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidOrganization):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrUserAlreadyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
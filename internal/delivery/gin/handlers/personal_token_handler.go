@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"JWT/pkg/auth"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PersonalTokenHandler lets users manage the personal access tokens they
+// script the API with.
+type PersonalTokenHandler struct {
+	UseCase *usecase.PersonalTokenUseCase
+}
+
+func (p *PersonalTokenHandler) List(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := p.UseCase.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Create returns the token itself, which is never shown again. Neither a
+// client acting for the user nor someone impersonating them may create one:
+// the token would outlive what they were given.
+func (p *PersonalTokenHandler) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	claims := c.MustGet("claims").(*auth.Claims)
+	if claims.ClientID != "" || claims.Actor != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": usecase.ErrPersonalTokenNotAllowed.Error()})
+		return
+	}
+	var data struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expiresInDays"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	ttl := time.Duration(data.ExpiresInDays) * 24 * time.Hour
+	token, err := p.UseCase.Create(c.GetString("tenant"), userID, data.Name, data.Scopes, ttl)
+	if err != nil {
+		p.personalTokenError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, token)
+}
+
+func (p *PersonalTokenHandler) Delete(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := p.UseCase.Delete(userID, c.Param("id")); err != nil {
+		p.personalTokenError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Токен доступа удален"})
+}
+
+func (p *PersonalTokenHandler) personalTokenError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, entity.ErrPersonalTokenNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrPersonalTokenName),
+		errors.Is(err, usecase.ErrPersonalTokenTTL):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrPersonalTokenScope):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrTooManyPersonalTokens):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
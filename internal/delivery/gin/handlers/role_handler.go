@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleHandler is the admin API for roles and their assignment to users.
+type RoleHandler struct {
+	UseCase *usecase.RoleUseCase
+}
+
+func (r *RoleHandler) List(c *gin.Context) {
+	roles, err := r.UseCase.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// Save creates the role named in the path or replaces its permissions.
+func (r *RoleHandler) Save(c *gin.Context) {
+	var data struct {
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	role := entity.Role{Name: c.Param("name"), Description: data.Description, Permissions: data.Permissions}
+	if err := r.UseCase.Save(role); err != nil {
+		r.roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+func (r *RoleHandler) Delete(c *gin.Context) {
+	if err := r.UseCase.Delete(c.Param("name")); err != nil {
+		r.roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Роль удалена"})
+}
+
+func (r *RoleHandler) UserRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam.Error()})
+		return
+	}
+
+	roles, err := r.UseCase.UserRoles(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+func (r *RoleHandler) Assign(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam.Error()})
+		return
+	}
+	var data struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	if err := r.UseCase.Assign(id, data.Role); err != nil {
+		r.roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Роль назначена"})
+}
+
+func (r *RoleHandler) Unassign(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam.Error()})
+		return
+	}
+
+	if err := r.UseCase.Unassign(id, c.Param("role")); err != nil {
+		r.roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Роль снята"})
+}
+
+func (r *RoleHandler) roleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, entity.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrRoleProtected), errors.Is(err, usecase.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"JWT/internal/usecase"
+	"JWT/pkg/saml"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SAMLMetadata describes the service to the identity providers.
+func (u *UserHandler) SAMLMetadata(c *gin.Context) {
+	metadata, err := u.SAML.Metadata()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+func (u *UserHandler) SAMLProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, u.SAML.Providers())
+}
+
+// SAMLBegin sends the browser to the provider with an AuthnRequest.
+func (u *UserHandler) SAMLBegin(c *gin.Context) {
+	tenant, ok := u.resolveTenant(c, c.Query("tenant"))
+	if !ok {
+		return
+	}
+	url, err := u.SAML.Begin(c.Param("provider"), tenant)
+	if err != nil {
+		u.samlError(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, url)
+}
+
+// SAMLACS is the assertion consumer service the providers post the
+// responses to. It answers like /v1/login.
+func (u *UserHandler) SAMLACS(c *gin.Context) {
+	user, tenant, err := u.SAML.Finish(c.PostForm("SAMLResponse"), c.PostForm("RelayState"))
+	if err != nil {
+		u.samlError(c, err)
+		return
+	}
+	grant, err := usecase.FirstPartyGrant(tenant, "", "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u.completeLogin(c, user, grant, "")
+}
+
+func (u *UserHandler) samlError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, saml.ErrInvalidResponse):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, saml.ErrInvalidSignature),
+		errors.Is(err, saml.ErrInvalidAssertion),
+		errors.Is(err, saml.ErrStatus),
+		errors.Is(err, usecase.ErrAssertionReplayed):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrIdPInitiatedLogin):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		u.federationError(c, err)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionHandler struct {
+	UseCase *usecase.SessionUseCase
+}
+
+type DtoSession struct {
+	entity.Session
+	Current bool `json:"current"`
+}
+
+func (s *SessionHandler) Logout(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := s.UseCase.Revoke(userID, c.GetString("session_id")); err != nil {
+		s.sessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Сессия завершена"})
+}
+
+func (s *SessionHandler) LogoutAll(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := s.UseCase.RevokeAll(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Все сессии завершены"})
+}
+
+func (s *SessionHandler) List(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := s.UseCase.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	current := c.GetString("session_id")
+	result := make([]DtoSession, len(sessions))
+	for i, session := range sessions {
+		result[i] = DtoSession{Session: session, Current: session.ID == current}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *SessionHandler) Revoke(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := s.UseCase.Revoke(userID, c.Param("id")); err != nil {
+		s.sessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Сессия завершена"})
+}
+
+func (s *SessionHandler) sessionError(c *gin.Context, err error) {
+	if errors.Is(err, entity.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// currentUserID reads the user set by Authorization and answers 401 itself
+// when the token has no usable subject.
+func currentUserID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.GetString("user_id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Невалидный токен"})
+		return 0, false
+	}
+	return id, true
+}
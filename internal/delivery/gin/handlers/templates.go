@@ -0,0 +1,62 @@
+package handlers
+
+import "html/template"
+
+// Templates holds the few HTML pages served to browsers.
+var Templates = template.Must(template.New("").Parse(`
+{{define "layout_head"}}<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 420px; margin: 48px auto; padding: 0 16px; }
+input, button { display: block; width: 100%; margin: 8px 0; padding: 8px; box-sizing: border-box; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>{{end}}
+
+{{define "layout_foot"}}</body>
+</html>{{end}}
+
+{{define "error.html"}}{{template "layout_head" .}}
+<h1>{{.Title}}</h1>
+<p class="error">{{.Error}}</p>
+{{template "layout_foot"}}{{end}}
+
+{{define "authorize.html"}}{{template "layout_head" .}}
+<h1>{{.Title}}</h1>
+<p>Приложение <b>{{.Client.Name}}</b> запрашивает доступ к вашему аккаунту.</p>
+{{if .Scopes}}<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}
+<input type="email" name="email" placeholder="Email" value="{{.Email}}" autocomplete="username">
+<input type="password" name="password" placeholder="Пароль" autocomplete="current-password">
+<input type="text" name="code" placeholder="Код 2FA, если включена" autocomplete="one-time-code">
+<button type="submit" name="action" value="approve">Разрешить</button>
+<button type="submit" name="action" value="deny">Отклонить</button>
+</form>
+{{template "layout_foot"}}{{end}}
+
+{{define "device.html"}}{{template "layout_head" .}}
+<h1>{{.Title}}</h1>
+{{if .Message}}<p>{{.Message}}</p>{{else}}
+{{if .Device}}<p>Приложение <b>{{.Device.ClientName}}</b> на другом устройстве запрашивает доступ к вашему аккаунту.</p>
+{{if .Scopes}}<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{else}}<p>Введите код, показанный на устройстве.</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/device">
+<input type="hidden" name="tenant" value="{{.Tenant}}">
+<input type="text" name="user_code" placeholder="Код устройства" value="{{.UserCode}}" autocomplete="off">
+<input type="email" name="email" placeholder="Email" value="{{.Email}}" autocomplete="username">
+<input type="password" name="password" placeholder="Пароль" autocomplete="current-password">
+<input type="text" name="code" placeholder="Код 2FA, если включена" autocomplete="one-time-code">
+<button type="submit" name="action" value="approve">Разрешить</button>
+<button type="submit" name="action" value="deny">Отклонить</button>
+</form>{{end}}
+{{template "layout_foot"}}{{end}}
+`))
@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"JWT/internal/delivery/gin/middleware"
 	"JWT/internal/entity"
 	"JWT/internal/usecase"
+	"JWT/pkg/auth"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 var (
@@ -15,26 +18,86 @@ var (
 )
 
 type UserHandler struct {
-	UseCase usecase.UserUseCase
+	UseCase       usecase.UserUseCase
+	Authenticator usecase.Authenticator
+	Auth          *usecase.AuthUseCase
+	Authz         *usecase.AuthzUseCase
+	Organizations *usecase.OrganizationUseCase
+	MFA           *usecase.MFAUseCase
+	Verification  *usecase.EmailVerificationUseCase
+	Passwords     *usecase.PasswordResetUseCase
+	EmailLogin    *usecase.EmailLoginUseCase
+	Federation    *usecase.FederationUseCase
+	SAML          *usecase.SAMLUseCase
+	// EmailLoginTTL is how long the cookie binding a login by email lives.
+	EmailLoginTTL time.Duration
+	// SecureCookies is set when the service is served over HTTPS.
+	SecureCookies bool
+	// Protections are the brute force limits of the tenants, for the second
+	// step of a login.
+	Protections middleware.Protections
 }
 
+// GetUserByID must run after Authorization.
 func (u *UserHandler) GetUserByID(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam})
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam.Error()})
 		return
 	}
-	user, err := u.UseCase.GetUserByID(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	user, ok := u.authorizeUser(c, id, usecase.ActionUsersRead)
+	if !ok {
 		return
 	}
 	user.Password = ""
 	c.JSON(http.StatusOK, user)
 }
 
+// authorizeUser loads the user from the caller's tenant and asks the policy
+// whether the caller may perform the action on it.
+func (u *UserHandler) authorizeUser(c *gin.Context, id int, action string) (entity.User, bool) {
+	tenant := c.GetString("tenant")
+	user, err := u.UseCase.GetUserByID(tenant, id)
+	return u.authorizeLookup(c, tenant, user, entity.User{ID: id}, err, action)
+}
+
+// authorizeLookup asks the policy about the user found, or about missing,
+// what was looked for, if there is none. A missing user is only reported to
+// callers that would have been allowed to see it, so that others cannot tell
+// which users exist.
+func (u *UserHandler) authorizeLookup(
+	c *gin.Context,
+	tenant string,
+	user entity.User,
+	missing entity.User,
+	err error,
+	action string,
+) (entity.User, bool) {
+	if err != nil && !errors.Is(err, entity.NotFoundUser) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return entity.User{}, false
+	}
+
+	resource := usecase.UserResource(tenant, user)
+	if err != nil {
+		resource = usecase.UserResource(tenant, missing)
+	}
+	claims := c.MustGet("claims").(*auth.Claims)
+	if !u.Authz.Check(claims, action, resource, c.ClientIP()).Allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+		return entity.User{}, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return entity.User{}, false
+	}
+	return user, true
+}
+
+// GetAll lists the users of the caller's tenant. Must run after Authorization.
 func (u *UserHandler) GetAll(c *gin.Context) {
-	users, err := u.UseCase.GetAll()
+	users, err := u.UseCase.GetAll(c.GetString("tenant"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -48,26 +111,48 @@ func (u *UserHandler) GetAll(c *gin.Context) {
 	c.JSON(http.StatusOK, safeUsers)
 }
 
+// GetUserByEmail looks the user up in the caller's tenant. Must run after
+// Authorization.
 func (u *UserHandler) GetUserByEmail(c *gin.Context) {
+	tenant := c.GetString("tenant")
 	email := c.Param("email")
-	user, err := u.UseCase.GetUserByEmail(email)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	user, err := u.UseCase.GetUserByEmail(tenant, email)
+	user, ok := u.authorizeLookup(c, tenant, user, entity.User{Email: email}, err, usecase.ActionUsersRead)
+	if !ok {
 		return
 	}
 	user.Password = ""
 	c.JSON(http.StatusOK, user)
 }
 
+// DeleteUser must run after Authorization.
 func (u *UserHandler) DeleteUser(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam})
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrBadParam.Error()})
+		return
 	}
-	err = u.UseCase.DeleteUser(id)
+	if _, ok := u.authorizeUser(c, id, usecase.ActionUsersDelete); !ok {
+		return
+	}
+	err = u.UseCase.DeleteUser(c.GetString("tenant"), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, fmt.Sprintf("Пользователь ID: %d удален", id))
 }
+
+// resolveTenant checks the tenant named in a request that carries no token.
+func (u *UserHandler) resolveTenant(c *gin.Context, tenant string) (string, bool) {
+	resolved, err := u.Organizations.Resolve(tenant)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, entity.ErrOrganizationNotFound) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return resolved, true
+}
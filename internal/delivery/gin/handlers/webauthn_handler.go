@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/usecase"
+	"JWT/pkg/webauthn"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebAuthnHandler registers passkeys under /profile and signs in with them
+// under /v1/login/passkey.
+type WebAuthnHandler struct {
+	UseCase       *usecase.WebAuthnUseCase
+	Organizations *usecase.OrganizationUseCase
+}
+
+func (w *WebAuthnHandler) List(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	credentials, err := w.UseCase.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, credentials)
+}
+
+func (w *WebAuthnHandler) Delete(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := w.UseCase.Delete(userID, c.Param("id")); err != nil {
+		w.webauthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Ключ доступа удален"})
+}
+
+// BeginRegistration must run after Authorization.
+func (w *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	options, err := w.UseCase.BeginRegistration(c.GetString("tenant"), userID)
+	if err != nil {
+		w.webauthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishRegistration takes the JSON of the credential create() returned,
+// along with a name for it.
+func (w *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var data struct {
+		webauthn.RegistrationResponse
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	credential, err := w.UseCase.FinishRegistration(userID, data.Name, data.RegistrationResponse)
+	if err != nil {
+		w.webauthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, credential)
+}
+
+func (w *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	var data struct {
+		Email  string `json:"email"`
+		Tenant string `json:"tenant"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+	tenant, err := w.Organizations.Resolve(data.Tenant)
+	if err != nil {
+		w.webauthnError(c, err)
+		return
+	}
+
+	options, err := w.UseCase.BeginLogin(tenant, data.Email)
+	if err != nil {
+		w.webauthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishLogin takes the JSON of the credential get() returned and answers
+// like /v1/login.
+func (w *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var data struct {
+		webauthn.AssertionResponse
+		Device string `json:"device"`
+		// Scope and Nonce request an OpenID Connect ID token
+		Scope string `json:"scope"`
+		Nonce string `json:"nonce"`
+	}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+		return
+	}
+
+	tokens, err := w.UseCase.FinishLogin(data.AssertionResponse, data.Scope, data.Nonce, entity.Device{
+		Name:      data.Device,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		w.webauthnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (w *WebAuthnHandler) webauthnError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, entity.ErrCredentialNotFound),
+		errors.Is(err, entity.NotFoundUser):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrCredentialExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrOrganizationNotFound),
+		errors.Is(err, usecase.ErrInvalidScope),
+		errors.Is(err, webauthn.ErrInvalidClientData),
+		errors.Is(err, webauthn.ErrInvalidAuthData),
+		errors.Is(err, webauthn.ErrInvalidAttestation),
+		errors.Is(err, webauthn.ErrInvalidPublicKey),
+		errors.Is(err, webauthn.ErrUnsupportedAlgorithm):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, entity.ErrChallengeNotFound),
+		errors.Is(err, usecase.ErrInvalidCredential),
+		errors.Is(err, usecase.ErrCredentialCloned),
+		errors.Is(err, webauthn.ErrInvalidSignature),
+		errors.Is(err, webauthn.ErrUserNotPresent),
+		errors.Is(err, webauthn.ErrUserNotVerified):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
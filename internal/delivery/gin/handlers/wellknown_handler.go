@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public signing keys so other services can verify tokens.
+// The keys of tenants with keys of their own are left out: they are published
+// under the tenant's issuer.
+func JWKS(signer auth.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, signer.JWKS())
+	}
+}
+
+// TenantJWKS publishes only the keys that sign the tokens of one tenant.
+func TenantJWKS(signer *auth.TenantSigner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, signer.For(c.Param("tenant")).JWKS())
+	}
+}
+
+// OpenIDConfiguration serves the OpenID Connect discovery document.
+func OpenIDConfiguration(issuer string, signer auth.Signer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, discovery(issuer, issuer, issuer+"/oauth/authorize", signer.JWKS()))
+	}
+}
+
+// TenantOpenIDConfiguration serves the discovery document of the issuer of a
+// tenant with signing keys of its own. Other tenants share the service's.
+func TenantOpenIDConfiguration(issuer string, signer *auth.TenantSigner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := c.Param("tenant")
+		if !signer.OwnKeys(tenant) {
+			c.JSON(http.StatusNotFound, gin.H{"error": entity.ErrOrganizationNotFound.Error()})
+			return
+		}
+
+		authorize := issuer + "/oauth/authorize?" + url.Values{"tenant": {tenant}}.Encode()
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, discovery(signer.Issuer(issuer, tenant), issuer, authorize, signer.For(tenant).JWKS()))
+	}
+}
+
+// discovery describes the issuer, whose endpoints are served under base.
+func discovery(issuer string, base string, authorize string, keys auth.JWKSet) gin.H {
+	algorithms := []string{}
+	seen := map[string]bool{}
+	for _, key := range keys.Keys {
+		if !seen[key.Alg] {
+			seen[key.Alg] = true
+			algorithms = append(algorithms, key.Alg)
+		}
+	}
+
+	return gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                authorize,
+		"token_endpoint":                        base + "/oauth/token",
+		"userinfo_endpoint":                     base + "/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"introspection_endpoint":                base + "/oauth/introspect",
+		"revocation_endpoint":                   base + "/oauth/revoke",
+		"device_authorization_endpoint":         base + "/oauth/device_authorization",
+		"scopes_supported":                      []string{auth.ScopeOpenID, auth.ScopeProfile, auth.ScopeEmail},
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{entity.GrantAuthorizationCode, entity.GrantRefreshToken, entity.GrantClientCredentials, entity.GrantDeviceCode, entity.GrantTokenExchange},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": algorithms,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{auth.PKCEMethodS256},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "azp", "name", "email"},
+	}
+}
@@ -5,40 +5,41 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
-func BruteForceProtection(protection *security.AdvancedProtection) gin.HandlerFunc {
+// AuthenticatedKey is set by the protected handler once the credentials have
+// been accepted, which resets the attempt counter.
+const AuthenticatedKey = "authenticated"
+
+// Protections picks the protection of the tenant a login is for.
+type Protections func(tenant string) *security.AdvancedProtection
+
+func BruteForceProtection(protections Protections) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 
-		// Check if IP is permanently blocked
-		if protection.IsIPBlocked(ip) {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "IP address is blocked due to suspicious activity",
-			})
-			c.Abort()
-			return
-		}
-
-		// Get username from request
+		// Get username from request, JSON for the API and forms for browser pages.
+		// The JSON body is cached so that the handler can bind it again.
 		var loginData struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email    string `json:"email" form:"email"`
+			Password string `json:"password" form:"password"`
+			Tenant   string `json:"tenant" form:"tenant"`
 		}
 
-		if err := c.ShouldBindJSON(&loginData); err != nil {
+		var err error
+		if c.ContentType() == binding.MIMEPOSTForm {
+			err = c.ShouldBind(&loginData)
+		} else {
+			err = c.ShouldBindBodyWith(&loginData, binding.JSON)
+		}
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 			c.Abort()
 			return
 		}
-
-		if protection.RecordFailedAttempt(ip, loginData.Email) {
-			// Generate and send garbage data
-			garbage := protection.GenerateGarbage(ip)
-
-			c.Header("Content-Type", "application/octet-stream")
-			c.Header("Content-Disposition", "attachment; filename=garbage.bin")
-			c.Data(http.StatusOK, "application/octet-stream", garbage)
+		protection := protections(loginData.Tenant)
+		if !Attempt(c, protection, loginData.Email) {
 			c.Abort()
 			return
 		}
@@ -46,8 +47,34 @@ func BruteForceProtection(protection *security.AdvancedProtection) gin.HandlerFu
 		c.Next()
 
 		// Reset attempts on successful login
-		if c.Writer.Status() == http.StatusOK {
+		if c.GetBool(AuthenticatedKey) {
 			protection.ResetAttempts(ip)
 		}
 	}
 }
+
+// Attempt counts a login attempt before the credentials are checked; the
+// count is reset once they are accepted. It reports false, having answered
+// the request, when the IP is blocked or has just run out of attempts.
+func Attempt(c *gin.Context, protection *security.AdvancedProtection, username string) bool {
+	ip := c.ClientIP()
+
+	// Check if IP is permanently blocked
+	if protection.IsIPBlocked(ip) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "IP address is blocked due to suspicious activity",
+		})
+		return false
+	}
+
+	if protection.RecordFailedAttempt(ip, username) {
+		// Generate and send garbage data
+		garbage := protection.GenerateGarbage(ip)
+
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", "attachment; filename=garbage.bin")
+		c.Data(http.StatusOK, "application/octet-stream", garbage)
+		return false
+	}
+	return true
+}
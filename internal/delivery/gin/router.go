@@ -1,58 +1,564 @@
 package gin
 
 import (
+	"JWT/internal/config"
 	"JWT/internal/delivery/gin/handlers"
 	"JWT/internal/delivery/gin/middleware"
+	"JWT/internal/entity"
 	"JWT/internal/repository"
 	"JWT/internal/usecase"
+	"JWT/pkg/auth"
+	"JWT/pkg/directory"
+	"JWT/pkg/mail"
+	"JWT/pkg/oidc"
+	"JWT/pkg/policy"
+	"JWT/pkg/saml"
 	"JWT/pkg/security"
+	"JWT/pkg/webauthn"
+	"cmp"
+	"context"
 	"database/sql"
 	"log"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouters(db *sql.DB) *gin.Engine {
+func SetupRouters(db *sql.DB, cfg config.Config) *gin.Engine {
 	router := gin.Default()
+	router.SetHTMLTemplate(handlers.Templates)
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := repository.Migrate(db); err != nil {
+		log.Fatal(err)
+	}
+
+	signer := setupTenantSigner(cfg)
+
+	// Initialize advanced brute force protection, 1GB base garbage file.
+	// Tenants may have limits of their own.
+	protection := setupProtection(cfg.BruteForce)
+	tenantProtections := map[string]*security.AdvancedProtection{}
+	for _, tenant := range cfg.Tenants {
+		if tenant.BruteForce == nil {
+			continue
+		}
+		limits := *tenant.BruteForce
+		if limits.MaxAttempts == 0 {
+			limits.MaxAttempts = cfg.BruteForce.MaxAttempts
+		}
+		if limits.BlockTime == 0 {
+			limits.BlockTime = cfg.BruteForce.BlockTime
+		}
+		if limits.PermanentBlockTime == 0 {
+			limits.PermanentBlockTime = cfg.BruteForce.PermanentBlockTime
+		}
+		tenantProtections[tenant.ID] = setupProtection(limits)
+	}
+	protections := func(tenant string) *security.AdvancedProtection {
+		if p, ok := tenantProtections[tenant]; ok {
+			return p
+		}
+		return protection
+	}
+
+	revocations, err := usecase.NewRevocationUseCase(repository.NewRevocationRepository(db))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bootstrap := map[string][]string{}
+	for _, email := range cfg.Admins {
+		bootstrap[email] = append(bootstrap[email], entity.RoleAdmin)
+	}
+	for _, email := range cfg.OAuth.Impersonators {
+		bootstrap[email] = append(bootstrap[email], entity.RoleSupport)
+	}
+	roleUseCase, err := usecase.NewRoleUseCase(repository.NewRoleRepository(db), revocations, bootstrap)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	engine, err := policy.NewEngine(cfg.Policy.File, usecase.DefaultPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go engine.Watch(context.Background(), cfg.Policy.ReloadInterval.Std())
+	authzUseCase := usecase.NewAuthzUseCase(engine, roleUseCase)
+
+	organizationUseCase := usecase.NewOrganizationUseCase(repository.NewOrganizationRepository(db), roleUseCase, revocations)
+	for _, tenant := range cfg.Tenants {
+		if err := organizationUseCase.Save(entity.Organization{ID: tenant.ID, Name: tenant.Name}); err != nil {
+			log.Fatalf("Tenant %q: %v", tenant.ID, err)
+		}
+	}
 
 	rep := repository.NewUserRepository(db)
-	useCase := *usecase.NewUserUseCase(rep)
-	handler := handlers.UserHandler{UseCase: useCase}
-
-	// Initialize advanced brute force protection
-	// 5 attempts within 5 minutes, 1GB base garbage file, 24h permanent block
-	protection := security.NewAdvancedProtection(
-		5,                // max attempts
-		5*time.Minute,    // block time
-		24*time.Hour,     // permanent block time
-		1*1024*1024*1024, // 1GB base garbage size
+	refreshRep := repository.NewRefreshTokenRepository(db)
+	sessionRep := repository.NewSessionRepository(db)
+	useCase := *usecase.NewUserUseCase(rep, revocations)
+	verificationMode, err := usecase.ParseEmailVerificationMode(cfg.EmailVerification.Mode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	authUseCase := usecase.NewAuthUseCase(rep, refreshRep, sessionRep, revocations, roleUseCase, signer, protection, cfg.Issuer, verificationMode)
+	sender := setupMailSender(cfg.Mail)
+	verificationUseCase := usecase.NewEmailVerificationUseCase(
+		rep,
+		authUseCase,
+		sender,
+		cfg.Issuer+"/v1/verify-email",
+		cfg.EmailVerification.TokenTTL.Std(),
+		cfg.EmailVerification.ResendInterval.Std(),
+		cfg.EmailVerification.ResendPerHour,
+	)
+	clientRep := repository.NewClientRepository(db)
+	clientUseCase := usecase.NewClientUseCase(clientRep, revocations)
+	oauthUseCase := usecase.NewOAuthUseCase(clientRep, repository.NewAuthorizationCodeRepository(db), rep, authUseCase)
+	deviceUseCase := usecase.NewDeviceUseCase(
+		repository.NewDeviceCodeRepository(db),
+		clientRep,
+		rep,
+		authUseCase,
+		cfg.Issuer+"/oauth/device",
 	)
+	mfaUseCase := usecase.NewMFAUseCase(repository.NewMFARepository(db), rep, authUseCase, cfg.Auth.TOTPIssuer)
+	webauthnUseCase := usecase.NewWebAuthnUseCase(
+		&webauthn.RelyingParty{ID: cfg.WebAuthn.RPID, Name: cfg.WebAuthn.RPName, Origins: cfg.WebAuthn.Origins},
+		repository.NewCredentialRepository(db),
+		repository.NewWebAuthnChallengeRepository(db),
+		rep,
+		authUseCase,
+	)
+	emailLoginUseCase := usecase.NewEmailLoginUseCase(
+		repository.NewLoginCodeRepository(db),
+		rep,
+		sender,
+		cmp.Or(cfg.EmailLogin.Link, cfg.Issuer+"/login/email"),
+		cfg.EmailLogin.TTL.Std(),
+		cfg.EmailLogin.MaxAttempts,
+		cfg.EmailLogin.PerHour,
+	)
+	federationUseCase := usecase.NewFederationUseCase(
+		setupFederatedProviders(cfg),
+		repository.NewFederationStateRepository(db),
+		repository.NewIdentityRepository(db),
+		rep,
+	)
+	samlUseCase := usecase.NewSAMLUseCase(
+		&saml.ServiceProvider{
+			EntityID: cmp.Or(cfg.SAML.EntityID, cfg.Issuer+"/v1/saml/metadata"),
+			ACSURL:   cfg.Issuer + "/v1/saml/acs",
+		},
+		setupSAMLProviders(cfg.SAML.Providers),
+		repository.NewFederationStateRepository(db),
+		repository.NewAssertionReplayRepository(db),
+		repository.NewIdentityRepository(db),
+		rep,
+	)
+	sessionUseCase := usecase.NewSessionUseCase(sessionRep, refreshRep, revocations)
+	go revocations.RunSweeper(context.Background(), time.Minute, sessionUseCase.DeleteExpired)
+	passwordResetUseCase := usecase.NewPasswordResetUseCase(
+		repository.NewPasswordResetRepository(db),
+		rep,
+		sessionUseCase,
+		authUseCase,
+		sender,
+		cmp.Or(cfg.PasswordReset.Link, cfg.Issuer+"/password/reset"),
+		cfg.PasswordReset.TokenTTL.Std(),
+		cfg.PasswordReset.PerHour,
+	)
+	personalTokenUseCase := usecase.NewPersonalTokenUseCase(
+		repository.NewPersonalTokenRepository(db),
+		rep,
+		roleUseCase,
+		cfg.Issuer,
+	)
+	apiKeyUseCase := usecase.NewAPIKeyUseCase(repository.NewAPIKeyRepository(db), organizationUseCase, cfg.Issuer)
+	authenticator := setupAuthenticator(cfg.LDAP, rep, roleUseCase)
+	handler := handlers.UserHandler{
+		UseCase:       useCase,
+		Authenticator: authenticator,
+		Auth:          authUseCase,
+		Authz:         authzUseCase,
+		Organizations: organizationUseCase,
+		MFA:           mfaUseCase,
+		Verification:  verificationUseCase,
+		Passwords:     passwordResetUseCase,
+		EmailLogin:    emailLoginUseCase,
+		Federation:    federationUseCase,
+		SAML:          samlUseCase,
+		EmailLoginTTL: cfg.EmailLogin.TTL.Std(),
+		SecureCookies: strings.HasPrefix(cfg.Issuer, "https://"),
+		Protections:   protections,
+	}
+	authzHandler := handlers.AuthzHandler{Auth: authUseCase, Authz: authzUseCase}
+	sessionHandler := handlers.SessionHandler{UseCase: sessionUseCase}
+	auditUseCase := usecase.NewAuditUseCase(repository.NewAuditRepository(db))
+	exchangeUseCase := usecase.NewTokenExchangeUseCase(
+		authUseCase,
+		rep,
+		usecase.NewRoleImpersonationPolicy(roleUseCase),
+		auditUseCase,
+	)
+	roleHandler := handlers.RoleHandler{UseCase: roleUseCase}
+	organizationHandler := handlers.OrganizationHandler{UseCase: organizationUseCase}
+	deviceHandler := handlers.DeviceHandler{UseCase: deviceUseCase}
+	mfaHandler := handlers.MFAHandler{UseCase: mfaUseCase, Protections: protections}
+	webauthnHandler := handlers.WebAuthnHandler{UseCase: webauthnUseCase, Organizations: organizationUseCase}
+	personalTokenHandler := handlers.PersonalTokenHandler{UseCase: personalTokenUseCase}
+	apiKeyHandler := handlers.APIKeyHandler{UseCase: apiKeyUseCase}
+	adminHandler := handlers.AdminHandler{
+		Sessions:       sessionUseCase,
+		PersonalTokens: personalTokenUseCase,
+		Clients:        clientUseCase,
+		Audit:          auditUseCase,
+	}
+	oauthHandler := handlers.OAuthHandler{
+		Auth:      authUseCase,
+		Clients:   clientUseCase,
+		OAuth:     oauthUseCase,
+		Devices:   deviceUseCase,
+		Exchanges: exchangeUseCase,
+		Users:     useCase,
+
+		Authenticator: authenticator,
+		Organizations: organizationUseCase,
+		MFA:           mfaUseCase,
+	}
 
-	// Start notification handler
-	go func() {
-		for notification := range protection.GetNotifications() {
-			log.Printf("Security Alert: %s", notification)
-			// Здесь можно добавить отправку уведомлений в Telegram/Slack/etc
+	for _, client := range cfg.OAuth.Clients {
+		err := clientUseCase.Register(entity.Client{
+			ID:           client.ID,
+			Name:         client.Name,
+			RedirectURIs: client.RedirectURIs,
+			Scopes:       client.Scopes,
+			GrantTypes:   client.GrantTypes,
+			Public:       client.Public,
+		}, client.Secret)
+		if err != nil {
+			log.Fatal(err)
 		}
-	}()
+	}
+
+	// Start notification handlers
+	for _, p := range slices.AppendSeq([]*security.AdvancedProtection{protection}, maps.Values(tenantProtections)) {
+		go func() {
+			for notification := range p.GetNotifications() {
+				log.Printf("Security Alert: %s", notification)
+				// Здесь можно добавить отправку уведомлений в Telegram/Slack/etc
+			}
+		}()
+	}
+
+	router.GET("/.well-known/jwks.json", handlers.JWKS(signer))
+	router.GET("/.well-known/openid-configuration", handlers.OpenIDConfiguration(cfg.Issuer, signer))
+	// Tenants with signing keys of their own are issuers of their own
+	router.GET("/t/:tenant/.well-known/openid-configuration", handlers.TenantOpenIDConfiguration(cfg.Issuer, signer))
+	router.GET("/t/:tenant/.well-known/jwks.json", handlers.TenantJWKS(signer))
+	router.GET("/userinfo", handlers.Authorization(authUseCase, personalTokenUseCase), oauthHandler.UserInfo)
+	router.POST("/userinfo", handlers.Authorization(authUseCase, personalTokenUseCase), oauthHandler.UserInfo)
+
+	oauth := router.Group("/oauth")
+	{
+		oauth.GET("/authorize", oauthHandler.Authorize)
+		oauth.POST("/authorize", middleware.BruteForceProtection(protections), oauthHandler.AuthorizeSubmit)
+		oauth.POST("/token", oauthHandler.Token)
+		oauth.POST("/device_authorization", oauthHandler.DeviceAuthorization)
+		oauth.GET("/device", oauthHandler.DeviceVerification)
+		oauth.POST("/device", middleware.BruteForceProtection(protections), oauthHandler.DeviceVerificationSubmit)
+		oauth.POST("/introspect", oauthHandler.Introspect)
+		oauth.POST("/revoke", oauthHandler.Revoke)
+	}
+
+	authorized := handlers.Authorization(authUseCase, personalTokenUseCase)
+	// The API proper also takes the keys of partner integrations
+	keyed := handlers.APIKeyAuthorization(apiKeyUseCase, authorized)
+	// Unverified users keep their profile when the mode restricts them
+	verified := handlers.RequireVerifiedEmail(verificationMode)
+	can := func(permission string) gin.HandlerFunc {
+		return handlers.RequirePermission(roleUseCase, permission)
+	}
+	// Everything under /admin is shared by all tenants
+	platform := func(permission string) gin.HandlerFunc {
+		return handlers.RequirePlatformPermission(roleUseCase, permission)
+	}
 
 	api := router.Group("/v1")
 	{
 		api.POST("/reg", handler.Register)
-		api.POST("/login", middleware.BruteForceProtection(protection), handler.Login)
+		api.POST("/login", middleware.BruteForceProtection(protections), handler.Login)
+		api.POST("/login/mfa", handler.LoginMFA)
+		api.POST("/login/email", handler.LoginEmail)
+		api.POST("/login/email/verify", handler.LoginEmailVerify)
+		api.GET("/login/oidc", handler.FederationProviders)
+		api.GET("/login/oidc/:provider", handler.FederationBegin)
+		api.GET("/login/oidc/:provider/callback", handler.FederationCallback)
+		api.GET("/login/saml", handler.SAMLProviders)
+		api.GET("/login/saml/:provider", handler.SAMLBegin)
+		api.GET("/saml/metadata", handler.SAMLMetadata)
+		api.POST("/saml/acs", handler.SAMLACS)
+		api.POST("/login/passkey/begin", webauthnHandler.BeginLogin)
+		api.POST("/login/passkey/finish", webauthnHandler.FinishLogin)
+		api.POST("/refresh", handler.Refresh)
+		api.GET("/verify-email", handler.VerifyEmail)
+		api.POST("/verify-email/resend", handler.ResendVerification)
+		api.POST("/password/forgot", handler.ForgotPassword)
+		api.POST("/password/reset", handler.ResetPassword)
+
+		api.GET("/users", keyed, verified, can(entity.PermUsersRead), handler.GetAll)
+		api.GET("/user/email/:email", keyed, verified, handler.GetUserByEmail)
+		api.GET("/user/:id", keyed, verified, handler.GetUserByID)
 
-		api.GET("/users", handler.GetAll)
-		api.GET("/user/email/:email", handler.GetUserByEmail)
-		api.GET("/user/:id", handler.GetUserByID)
+		api.DELETE("/user/:id", keyed, verified, handler.DeleteUser)
 
-		api.DELETE("/user/:id", handler.DeleteUser)
+		api.POST("/authz/check", keyed, verified, authzHandler.Check)
 	}
 
+	// Managing the account takes a login, not a personal access token
 	auth := router.Group("/profile")
-	auth.Use(handlers.Authorization())
+	auth.Use(authorized, handlers.RejectPersonalTokens())
+	{
+		auth.POST("/logout", sessionHandler.Logout)
+		auth.POST("/logout-all", sessionHandler.LogoutAll)
+		auth.GET("/sessions", sessionHandler.List)
+		auth.DELETE("/sessions/:id", sessionHandler.Revoke)
+
+		auth.GET("/device", deviceHandler.Show)
+		auth.POST("/device", deviceHandler.Decide)
+
+		auth.GET("/2fa", mfaHandler.Status)
+		auth.POST("/2fa", mfaHandler.Enroll)
+		auth.DELETE("/2fa", mfaHandler.Disable)
+		auth.POST("/2fa/confirm", mfaHandler.Confirm)
+		auth.POST("/2fa/recovery-codes", mfaHandler.RecoveryCodes)
+
+		auth.GET("/passkeys", webauthnHandler.List)
+		auth.DELETE("/passkeys/:id", webauthnHandler.Delete)
+		auth.POST("/passkeys/register/begin", webauthnHandler.BeginRegistration)
+		auth.POST("/passkeys/register/finish", webauthnHandler.FinishRegistration)
+
+		auth.GET("/tokens", personalTokenHandler.List)
+		auth.POST("/tokens", personalTokenHandler.Create)
+		auth.DELETE("/tokens/:id", personalTokenHandler.Delete)
+	}
+
+	admin := router.Group("/admin")
+	admin.Use(authorized, verified)
 	{
+		admin.POST("/users/:id/revoke-tokens", platform(entity.PermSessionsRevoke), adminHandler.RevokeUserTokens)
+
+		admin.GET("/clients", platform(entity.PermClientsManage), adminHandler.ListClients)
+		admin.POST("/clients", platform(entity.PermClientsManage), adminHandler.CreateClient)
+		admin.POST("/clients/:id/rotate-secret", platform(entity.PermClientsManage), adminHandler.RotateClientSecret)
+		admin.POST("/clients/:id/disable", platform(entity.PermClientsManage), adminHandler.DisableClient)
+
+		admin.GET("/audit", platform(entity.PermAuditRead), adminHandler.ListAudit)
+
+		admin.GET("/api-keys", platform(entity.PermAPIKeysManage), apiKeyHandler.List)
+		admin.POST("/api-keys", platform(entity.PermAPIKeysManage), apiKeyHandler.Create)
+		admin.GET("/api-keys/:id", platform(entity.PermAPIKeysManage), apiKeyHandler.Get)
+		admin.POST("/api-keys/:id/rotate", platform(entity.PermAPIKeysManage), apiKeyHandler.Rotate)
+		admin.DELETE("/api-keys/:id", platform(entity.PermAPIKeysManage), apiKeyHandler.Revoke)
+
+		admin.GET("/roles", platform(entity.PermRolesManage), roleHandler.List)
+		admin.PUT("/roles/:name", platform(entity.PermRolesManage), roleHandler.Save)
+		admin.DELETE("/roles/:name", platform(entity.PermRolesManage), roleHandler.Delete)
+		admin.GET("/users/:id/roles", platform(entity.PermRolesManage), roleHandler.UserRoles)
+		admin.POST("/users/:id/roles", platform(entity.PermRolesManage), roleHandler.Assign)
+		admin.DELETE("/users/:id/roles/:role", platform(entity.PermRolesManage), roleHandler.Unassign)
+
+		admin.GET("/organizations", platform(entity.PermOrgsManage), organizationHandler.List)
+		admin.PUT("/organizations/:id", platform(entity.PermOrgsManage), organizationHandler.Save)
+		admin.GET("/organizations/:id/members", platform(entity.PermOrgsManage), organizationHandler.Members)
+		admin.PUT("/organizations/:id/members/:user_id", platform(entity.PermOrgsManage), organizationHandler.AddMember)
+		admin.DELETE("/organizations/:id/members/:user_id", platform(entity.PermOrgsManage), organizationHandler.RemoveMember)
+		admin.GET("/organizations/:id/members/:user_id/roles", platform(entity.PermOrgsManage), organizationHandler.MemberRoles)
+		admin.POST("/organizations/:id/members/:user_id/roles", platform(entity.PermOrgsManage), organizationHandler.AssignRole)
+		admin.DELETE("/organizations/:id/members/:user_id/roles/:role", platform(entity.PermOrgsManage), organizationHandler.UnassignRole)
 	}
 
 	return router
 }
+
+func setupFederatedProviders(cfg config.Config) []usecase.FederatedProvider {
+	var providers []usecase.FederatedProvider
+	for _, provider := range cfg.OIDCProviders {
+		if provider.ID == "" || provider.Issuer == "" || provider.ClientID == "" {
+			log.Fatalf("OIDC provider %q: id, issuer and client_id are required", provider.ID)
+		}
+		scopes := provider.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{auth.ScopeOpenID, auth.ScopeEmail, auth.ScopeProfile}
+		}
+		providers = append(providers, usecase.FederatedProvider{
+			ID:   provider.ID,
+			Name: cmp.Or(provider.Name, provider.ID),
+			Provider: oidc.NewProvider(
+				provider.Issuer,
+				provider.ClientID,
+				provider.ClientSecret,
+				cfg.Issuer+"/v1/login/oidc/"+provider.ID+"/callback",
+				scopes,
+				nil,
+			),
+		})
+	}
+	return providers
+}
+
+func setupSAMLProviders(cfg []config.SAMLProvider) []usecase.SAMLProvider {
+	var providers []usecase.SAMLProvider
+	for _, provider := range cfg {
+		if provider.ID == "" || provider.EntityID == "" || provider.SSOURL == "" || provider.CertificateFile == "" {
+			log.Fatalf("SAML provider %q: id, entity_id, sso_url and certificate_file are required", provider.ID)
+		}
+		certs, err := saml.LoadCertificates(provider.CertificateFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		providers = append(providers, usecase.SAMLProvider{
+			ID:   provider.ID,
+			Name: cmp.Or(provider.Name, provider.ID),
+			IdentityProvider: &saml.IdentityProvider{
+				EntityID:     provider.EntityID,
+				SSOURL:       provider.SSOURL,
+				Certificates: certs,
+			},
+			Tenant:            cmp.Or(provider.Tenant, entity.DefaultTenant),
+			AllowIdPInitiated: provider.AllowIdPInitiated,
+			EmailAttribute:    provider.EmailAttribute,
+			NameAttribute:     provider.NameAttribute,
+		})
+	}
+	return providers
+}
+
+// setupAuthenticator checks the passwords of the domains of the directories
+// with them, and every other password locally.
+func setupAuthenticator(cfg []config.LDAPDirectory, users entity.UserRepository, roles *usecase.RoleUseCase) usecase.Authenticator {
+	local := usecase.NewLocalAuthenticator(users)
+	if len(cfg) == 0 {
+		return local
+	}
+	domains := map[string]usecase.DomainBackend{}
+	for _, dir := range cfg {
+		if dir.URL == "" || dir.BaseDN == "" || len(dir.Domains) == 0 {
+			log.Fatalf("LDAP directory %q: url, base_dn and domains are required", dir.URL)
+		}
+		ldap := usecase.NewLDAPAuthenticator(
+			&directory.Directory{
+				URL:          dir.URL,
+				StartTLS:     dir.StartTLS,
+				BindDN:       dir.BindDN,
+				BindPassword: dir.BindPassword,
+				BaseDN:       dir.BaseDN,
+				Filter:       cmp.Or(dir.Filter, "(mail={email})"),
+				GroupFilter:  dir.GroupFilter,
+				Attributes: directory.Attributes{
+					Email:  cmp.Or(dir.Attributes.Email, "mail"),
+					Name:   cmp.Or(dir.Attributes.Name, "cn"),
+					Groups: cmp.Or(dir.Attributes.Groups, "memberOf"),
+				},
+				Timeout: cmp.Or(dir.Timeout.Std(), 10*time.Second),
+			},
+			users,
+			roles,
+			dir.GroupRoles,
+		)
+		for _, domain := range dir.Domains {
+			if _, ok := domains[strings.ToLower(domain)]; ok {
+				log.Fatalf("LDAP domain %q is configured twice", domain)
+			}
+			domains[strings.ToLower(domain)] = usecase.DomainBackend{Authenticator: ldap, FallbackLocal: dir.FallbackLocal}
+		}
+	}
+	return usecase.NewDomainAuthenticator(domains, local)
+}
+
+func setupMailSender(cfg config.Mail) mail.Sender {
+	switch cfg.Driver {
+	case "smtp":
+		return mail.NewSMTPSender(cfg.SMTP.Addr, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From)
+	case "file":
+		sender, err := mail.NewFileSender(cfg.File, cfg.From)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return sender
+	case "log":
+		return mail.NewLogSender(cfg.From)
+	}
+	log.Fatalf("Unknown mail driver %q", cfg.Driver)
+	return nil
+}
+
+func setupProtection(cfg config.BruteForce) *security.AdvancedProtection {
+	return security.NewAdvancedProtection(
+		cfg.MaxAttempts,
+		cfg.BlockTime.Std(),
+		cfg.PermanentBlockTime.Std(),
+		1*1024*1024*1024, // 1GB base garbage size
+	)
+}
+
+// setupTenantSigner gives the tenants that have signing keys of their own a
+// signer each.
+func setupTenantSigner(cfg config.Config) *auth.TenantSigner {
+	tenants := map[string]auth.Signer{}
+	for _, tenant := range cfg.Tenants {
+		if len(tenant.SigningKeys) > 0 {
+			tenants[tenant.ID] = setupStaticSigner(tenant.SigningKeys)
+		}
+	}
+	return auth.NewTenantSigner(setupSigner(cfg.Auth), tenants)
+}
+
+func setupSigner(cfg config.Auth) auth.Signer {
+	if len(cfg.SigningKeys) == 0 {
+		return setupKeyring(cfg.Keyring)
+	}
+	return setupStaticSigner(cfg.SigningKeys)
+}
+
+func setupStaticSigner(cfg []config.SigningKey) auth.Signer {
+	var keys []*auth.Key
+	for _, keyCfg := range cfg {
+		key, err := auth.LoadKeyFile(keyCfg.File, keyCfg.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	signer, err := auth.NewStaticSigner(keys[0], keys[1:]...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return signer
+}
+
+func setupKeyring(cfg config.Keyring) auth.Signer {
+	keyring, err := auth.OpenKeyring(cfg.Dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	policy := auth.RotationPolicy{
+		Algorithm:    cfg.Algorithm,
+		Interval:     cfg.RotationInterval.Std(),
+		PublishAhead: cfg.PublishAhead.Std(),
+		VerifyFor:    cfg.VerifyFor.Std(),
+	}
+	if err := keyring.Rotate(policy); err != nil {
+		log.Fatal(err)
+	}
+	go keyring.RunRotation(context.Background(), policy, cfg.CheckInterval.Std())
+
+	return keyring
+}
@@ -0,0 +1,70 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// APIKeyRepository stores the keys partner integrations call the API with.
+// Only the hashes of the keys are stored.
+type APIKeyRepository interface {
+	GetAll() ([]APIKey, error)
+	GetByID(id string) (APIKey, error)
+	GetByHash(hash string) (APIKey, error)
+	// Save creates the key or replaces everything but its usage.
+	Save(key APIKey) error
+	// Consume counts a request from ip against the quota window starting at
+	// windowStart and returns the requests counted in it. It reports false,
+	// counting nothing, when the quota of the window is used up.
+	Consume(id string, windowStart time.Time, now time.Time, ip string) (int, bool, error)
+}
+
+var (
+	ErrAPIKeyNotFound = errors.New("API ключ не найден")
+	ErrAPIKeyRevoked  = errors.New("API ключ отозван")
+)
+
+// Quota periods of API keys.
+const (
+	QuotaPerMinute = "minute"
+	QuotaPerHour   = "hour"
+	QuotaPerDay    = "day"
+)
+
+// APIKey is not tied to any user: a request made with it acts as the key,
+// like a client with its own credentials, within the key's scopes and the
+// tenant it belongs to.
+type APIKey struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Tenant  string   `json:"tenant"`
+	Hint    string   `json:"hint"`
+	KeyHash string   `json:"-"`
+	Scopes  []string `json:"scopes"`
+	// AllowedIPs are addresses and CIDR ranges; none allow every address.
+	AllowedIPs []string    `json:"allowedIps"`
+	Quota      APIKeyQuota `json:"quota"`
+	Usage      APIKeyUsage `json:"usage"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	RotatedAt  *time.Time  `json:"rotatedAt,omitempty"`
+	ExpiresAt  *time.Time  `json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time  `json:"revokedAt,omitempty"`
+}
+
+// APIKeyQuota limits the requests of a key per minute, hour or day. A limit
+// of zero is no limit.
+type APIKeyQuota struct {
+	Limit  int    `json:"limit"`
+	Period string `json:"period,omitempty"`
+}
+
+// APIKeyUsage counts the requests made with a key. Requests refused for the
+// quota are not counted.
+type APIKeyUsage struct {
+	Total int64 `json:"total"`
+	// WindowStart is the start of the quota window WindowCount counts in.
+	WindowStart *time.Time `json:"windowStart,omitempty"`
+	WindowCount int        `json:"windowCount"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP  string     `json:"lastUsedIp,omitempty"`
+}
@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+type AuditRepository interface {
+	Create(event AuditEvent) error
+	// List returns the most recent events first.
+	List(limit int) ([]AuditEvent, error)
+}
+
+type AuditOutcome string
+
+const (
+	AuditGranted AuditOutcome = "granted"
+	AuditDenied  AuditOutcome = "denied"
+)
+
+// AuditEvent records a security sensitive action: who did what to whom.
+type AuditEvent struct {
+	ID        int          `json:"id"`
+	Action    string       `json:"action"`
+	Outcome   AuditOutcome `json:"outcome"`
+	ActorID   string       `json:"actorId,omitempty"`
+	SubjectID string       `json:"subjectId,omitempty"`
+	ClientID  string       `json:"clientId,omitempty"`
+	Details   string       `json:"details,omitempty"`
+	IP        string       `json:"ip,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+type AuthorizationCodeRepository interface {
+	Create(code AuthorizationCode) error
+	GetByHash(hash string) (AuthorizationCode, error)
+	MarkUsed(hash string, usedAt time.Time) (bool, error)
+	SetSession(hash string, sessionID string) error
+	DeleteExpired(now time.Time) error
+}
+
+var ErrAuthorizationCodeNotFound = errors.New("Код авторизации не найден")
+
+// AuthorizationCode is a short-lived single-use code of the authorization code
+// flow. Only the hash of the code is stored.
+type AuthorizationCode struct {
+	CodeHash            string
+	ClientID            string
+	UserID              int
+	Tenant              string
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	AuthTime            time.Time
+	SessionID           *string
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	UsedAt              *time.Time
+}
@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ClientRepository interface {
+	GetAll() ([]Client, error)
+	GetByID(id string) (Client, error)
+	Save(client Client) error
+}
+
+var (
+	ErrClientNotFound      = errors.New("Клиент не найден")
+	ErrInvalidClientSecret = errors.New("Неверный секрет клиента")
+	ErrClientDisabled      = errors.New("Клиент отключен")
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// defaultGrantTypes apply to clients registered without explicit grant types.
+var defaultGrantTypes = []string{GrantAuthorizationCode, GrantRefreshToken}
+
+// Client is an application registered to call the OAuth endpoints. Public
+// clients (SPAs, mobile apps) have no secret and must always use PKCE.
+type Client struct {
+	ID           string     `json:"clientId"`
+	Name         string     `json:"name"`
+	SecretHash   string     `json:"-"`
+	RedirectURIs []string   `json:"redirectUris"`
+	Scopes       []string   `json:"scopes"`
+	GrantTypes   []string   `json:"grantTypes"`
+	Public       bool       `json:"public"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	DisabledAt   *time.Time `json:"disabledAt,omitempty"`
+}
+
+func (c *Client) AllowsGrant(grantType string) bool {
+	grantTypes := c.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = defaultGrantTypes
+	}
+	for _, allowed := range grantTypes {
+		if allowed == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScopes reports whether every requested scope is registered for the client.
+func (c *Client) AllowsScopes(requested []string) bool {
+	for _, scope := range requested {
+		allowed := false
+		for _, registered := range c.Scopes {
+			if registered == scope {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// HasRedirectURI requires an exact match, as recommended for OAuth 2.1.
+func (c *Client) HasRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) SetSecret(secret string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	c.SecretHash = string(hash)
+	return nil
+}
+
+func (c *Client) CheckSecret(secret string) bool {
+	if c.SecretHash == "" {
+		return false
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(c.SecretHash), []byte(secret))
+	return err == nil
+}
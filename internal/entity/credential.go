@@ -0,0 +1,68 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// CredentialRepository stores the WebAuthn credentials (passkeys and
+// security keys) users sign in with.
+type CredentialRepository interface {
+	Create(credential Credential) error
+	GetByID(id string) (Credential, error)
+	GetByUser(userID int) ([]Credential, error)
+	// UpdateSignCount records a login. It reports false if the counter did
+	// not move forward, which is a sign of a cloned authenticator.
+	UpdateSignCount(id string, signCount uint32, usedAt time.Time) (bool, error)
+	Delete(userID int, id string) error
+}
+
+var (
+	ErrCredentialNotFound = errors.New("Ключ доступа не найден")
+	ErrCredentialExists   = errors.New("Ключ доступа уже зарегистрирован")
+)
+
+// Credential is a registered WebAuthn public key credential.
+type Credential struct {
+	// ID is the credential ID, base64url encoded.
+	ID     string `json:"id"`
+	UserID int    `json:"-"`
+	Name   string `json:"name"`
+	// PublicKey is the COSE_Key of the credential.
+	PublicKey  []byte   `json:"-"`
+	SignCount  uint32   `json:"signCount"`
+	AAGUID     string   `json:"aaguid"`
+	Transports []string `json:"transports"`
+	// Attestation is the format of the attestation statement at registration.
+	Attestation string     `json:"attestation"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+}
+
+// WebAuthnChallengeRepository keeps the challenges of ceremonies in progress.
+type WebAuthnChallengeRepository interface {
+	Create(challenge WebAuthnChallenge) error
+	// Take removes the challenge, so that it can only be answered once.
+	Take(challenge string) (WebAuthnChallenge, error)
+	DeleteExpired(now time.Time) error
+}
+
+var ErrChallengeNotFound = errors.New("Запрос WebAuthn не найден или истек")
+
+type WebAuthnCeremony string
+
+const (
+	CeremonyRegistration WebAuthnCeremony = "registration"
+	CeremonyLogin        WebAuthnCeremony = "login"
+)
+
+type WebAuthnChallenge struct {
+	Challenge string
+	Ceremony  WebAuthnCeremony
+	Tenant    string
+	// UserID is the user registering a credential, or the one named at the
+	// start of a login. Logins with a passkey name nobody.
+	UserID    *int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+type DeviceCodeRepository interface {
+	Create(code DeviceCode) error
+	GetByHash(hash string) (DeviceCode, error)
+	GetByUserCode(userCode string) (DeviceCode, error)
+	// Poll records a token request and the polling interval the client must keep from now on.
+	Poll(hash string, polledAt time.Time, interval time.Duration) error
+	// Decide approves or denies a pending code. It reports false if the code was not pending.
+	Decide(userCode string, status DeviceCodeStatus, tenant string, userID int, decidedAt time.Time) (bool, error)
+	MarkUsed(hash string, usedAt time.Time) (bool, error)
+	DeleteExpired(now time.Time) error
+}
+
+var (
+	ErrDeviceCodeNotFound  = errors.New("Код устройства не найден")
+	ErrDeviceCodeProcessed = errors.New("Код устройства уже обработан")
+)
+
+type DeviceCodeStatus string
+
+const (
+	DeviceCodePending  DeviceCodeStatus = "pending"
+	DeviceCodeApproved DeviceCodeStatus = "approved"
+	DeviceCodeDenied   DeviceCodeStatus = "denied"
+)
+
+// DeviceCode is a pending device authorization (RFC 8628). The device code is
+// stored hashed; the user code is short-lived and typed in by the user.
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	Scope          string
+	Status         DeviceCodeStatus
+	// Tenant and UserID are those of the user who decided.
+	Tenant       string
+	UserID       *int
+	Interval     time.Duration
+	LastPolledAt *time.Time
+	DecidedAt    *time.Time
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+}
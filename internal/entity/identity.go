@@ -0,0 +1,58 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// IdentityRepository links users to their accounts at upstream providers.
+type IdentityRepository interface {
+	Create(identity Identity) error
+	// GetUserIDs returns the users linked to the account, one per tenant
+	// the account signed in to.
+	GetUserIDs(provider string, subject string) ([]int, error)
+	Touch(provider string, subject string, userID int, at time.Time) error
+}
+
+// FederationStateRepository keeps the logins that were sent to a provider
+// until they come back.
+type FederationStateRepository interface {
+	Create(state FederationState) error
+	// Take returns the state and deletes it, so it can only be used once.
+	Take(hash string) (FederationState, error)
+	DeleteExpired(now time.Time) error
+}
+
+// AssertionReplayRepository remembers the SAML assertions that were
+// consumed until they expire, so none is accepted twice.
+type AssertionReplayRepository interface {
+	// Remember reports false if the assertion was consumed before.
+	Remember(issuer string, id string, expiresAt time.Time) (bool, error)
+	DeleteExpired(now time.Time) error
+}
+
+var ErrFederationStateNotFound = errors.New("Запрос входа через провайдера не найден")
+
+// Identity is the account of a user at an upstream OpenID Connect provider,
+// identified by the provider and its sub claim.
+type Identity struct {
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	UserID      int        `json:"userId"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// FederationState is a login sent to a provider. Only the hash of the state
+// parameter is stored.
+type FederationState struct {
+	StateHash string
+	Provider  string
+	Tenant    string
+	Nonce     string
+	// Verifier is the PKCE code verifier
+	Verifier  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
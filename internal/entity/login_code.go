@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+type LoginCodeRepository interface {
+	Create(code LoginCode) error
+	GetByHash(hash string) (LoginCode, error)
+	GetByBinding(bindingHash string) (LoginCode, error)
+	// CountAttempt records a guess of the code. It reports false once max
+	// guesses have been made.
+	CountAttempt(hash string, max int) (bool, error)
+	MarkUsed(hash string, usedAt time.Time) (bool, error)
+	DeleteExpired(now time.Time) error
+}
+
+var ErrLoginCodeNotFound = errors.New("Запрос на вход не найден")
+
+// LoginCode is a passwordless login by email: a link and a short code for the
+// same request. Both only work in the browser that asked for them, which
+// holds the binding. Only hashes are stored.
+type LoginCode struct {
+	TokenHash   string
+	BindingHash string
+	CodeHash    string
+	UserID      int
+	Tenant      string
+	Email       string
+	Attempts    int
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	UsedAt      *time.Time
+}
@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// MFARepository stores the second factors of users: a TOTP secret and the
+// one-time recovery codes that replace it when the authenticator is lost.
+type MFARepository interface {
+	GetTOTP(userID int) (TOTP, error)
+	// SaveTOTP starts a new enrollment, replacing an unconfirmed one.
+	SaveTOTP(totp TOTP) error
+	ConfirmTOTP(userID int, confirmedAt time.Time) error
+	// UseStep records the time step of an accepted code. It reports false if
+	// that step or a later one has already been used.
+	UseStep(userID int, step int64) (bool, error)
+	// DeleteTOTP removes the secret along with the recovery codes.
+	DeleteTOTP(userID int) error
+
+	// ReplaceRecoveryCodes invalidates the previous codes.
+	ReplaceRecoveryCodes(userID int, hashes []string) error
+	// UseRecoveryCode reports false if the code is unknown or already used.
+	UseRecoveryCode(userID int, hash string, usedAt time.Time) (bool, error)
+	RecoveryCodesLeft(userID int) (int, error)
+}
+
+var (
+	ErrTOTPNotFound = errors.New("Двухфакторная аутентификация не настроена")
+	ErrTOTPEnabled  = errors.New("Двухфакторная аутентификация уже включена")
+)
+
+type TOTP struct {
+	UserID int
+	Secret string
+	// LastStep is the time step of the last accepted code, which can not be
+	// used again.
+	LastStep    int64
+	CreatedAt   time.Time
+	ConfirmedAt *time.Time
+}
+
+// Enabled reports whether the enrollment has been confirmed with a first code.
+func (t TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
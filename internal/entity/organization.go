@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+type OrganizationRepository interface {
+	GetAll() ([]Organization, error)
+	GetByID(id string) (Organization, error)
+	// Save creates the organization or renames it.
+	Save(org Organization) error
+	Members(orgID string) ([]Member, error)
+	IsMember(orgID string, userID int) (bool, error)
+	// AddMember reports false if the user already was a member. It fails with
+	// ErrUserAlreadyRegistered if another member has the same email.
+	AddMember(orgID string, userID int, joinedAt time.Time) (bool, error)
+	// RemoveMember takes the user out of the organization as
+	// UserRepository.Delete does: with its roles, sessions, codes and tokens
+	// there, and the user itself once it is a member of no organization.
+	RemoveMember(orgID string, userID int) error
+}
+
+var (
+	ErrOrganizationNotFound = errors.New("Организация не найдена")
+	ErrNotMember            = errors.New("Пользователь не состоит в организации")
+)
+
+// DefaultTenant holds the users created before organizations existed and
+// everyone who signs up without naming an organization.
+const DefaultTenant = "default"
+
+// Organization is a tenant. Users may belong to several organizations; their
+// email only has to be unique within each one.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Member struct {
+	UserID   int       `json:"userId"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+type PasswordResetRepository interface {
+	Create(reset PasswordReset) error
+	GetByHash(hash string) (PasswordReset, error)
+	MarkUsed(hash string, usedAt time.Time) (bool, error)
+	// DeleteByUser drops the resets of the user that are still outstanding.
+	DeleteByUser(userID int) error
+	DeleteExpired(now time.Time) error
+}
+
+var ErrPasswordResetNotFound = errors.New("Запрос на сброс пароля не найден")
+
+// PasswordReset is a short-lived single-use token emailed to a user who
+// forgot the password. Only the hash of the token is stored.
+type PasswordReset struct {
+	TokenHash string
+	UserID    int
+	Tenant    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// PersonalTokenRepository stores the long-lived tokens users script the API
+// with. Only the hashes of the tokens are stored.
+type PersonalTokenRepository interface {
+	Create(token PersonalToken) error
+	GetByHash(hash string) (PersonalToken, error)
+	GetByUser(userID int) ([]PersonalToken, error)
+	// Touch records that the token was used.
+	Touch(id string, usedAt time.Time) error
+	Delete(userID int, id string) error
+	DeleteByUser(userID int) error
+	DeleteExpired(now time.Time) error
+}
+
+var ErrPersonalTokenNotFound = errors.New("Токен доступа не найден")
+
+// PersonalToken is a personal access token. It acts for the user in one
+// tenant, with no more than its scopes allow.
+type PersonalToken struct {
+	ID     string `json:"id"`
+	UserID int    `json:"-"`
+	Tenant string `json:"tenant"`
+	Name   string `json:"name"`
+	// Hint is the start of the token, to tell the tokens apart.
+	Hint       string     `json:"hint"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+type RefreshTokenRepository interface {
+	Create(token RefreshToken) error
+	GetByID(id string) (RefreshToken, error)
+	MarkUsed(id string, usedAt time.Time) (bool, error)
+	RevokeFamily(familyID string) error
+	DeleteExpired(now time.Time) error
+}
+
+var (
+	ErrInvalidRefreshToken  = errors.New("Невалидный refresh токен")
+	ErrRefreshTokenNotFound = errors.New("Refresh токен не найден")
+	ErrRefreshTokenRevoked  = errors.New("Refresh токен отозван")
+	ErrRefreshTokenReused   = errors.New("Повторное использование refresh токена")
+)
+
+// RefreshToken is a single link of a rotation chain. Only the hash of the
+// token is stored.
+type RefreshToken struct {
+	ID        string
+	FamilyID  string
+	ParentID  *string
+	UserID    int
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
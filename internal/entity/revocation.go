@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+type RevocationRepository interface {
+	Save(revocation Revocation) error
+	ListActive(now time.Time) ([]Revocation, error)
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+type RevocationKind string
+
+const (
+	// RevokeToken revokes a single access token by its jti.
+	RevokeToken RevocationKind = "jti"
+	// RevokeSession revokes every access token issued for a session.
+	RevokeSession RevocationKind = "sid"
+	// RevokeUser revokes every access token of a user issued up to RevokedAt.
+	RevokeUser RevocationKind = "sub"
+	// RevokeMember revokes every access token of a user in a tenant issued up
+	// to RevokedAt. Its value is the tenant and the user ID, joined by a slash.
+	RevokeMember RevocationKind = "member"
+	// RevokeClient revokes every access token issued to a client up to RevokedAt.
+	RevokeClient RevocationKind = "cid"
+)
+
+// Revocation is kept until ExpiresAt, after which every token it could match
+// has expired on its own.
+type Revocation struct {
+	Kind      RevocationKind
+	Value     string
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,67 @@
+package entity
+
+import (
+	"errors"
+	"strings"
+)
+
+type RoleRepository interface {
+	GetAll() ([]Role, error)
+	GetByName(name string) (Role, error)
+	// Save creates the role or replaces its description and permissions.
+	Save(role Role) error
+	Delete(name string) error
+	GetUserRoles(userID int) ([]string, error)
+	// Assign reports false if the user already had the role.
+	Assign(userID int, role string) (bool, error)
+	Unassign(userID int, role string) error
+	// Member roles only apply within one organization.
+	GetMemberRoles(tenant string, userID int) ([]string, error)
+	AssignMember(tenant string, userID int, role string) (bool, error)
+	UnassignMember(tenant string, userID int, role string) error
+}
+
+var (
+	ErrRoleNotFound  = errors.New("Роль не найдена")
+	ErrRoleProtected = errors.New("Роль admin нельзя удалить")
+)
+
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// Permissions are checked by handlers.RequirePermission. A role may also be
+// granted "*" or a whole group such as "users:*".
+const (
+	PermUsersRead        = "users:read"
+	PermUsersDelete      = "users:delete"
+	PermUsersAdmin       = "users:admin"
+	PermUsersImpersonate = "users:impersonate"
+	PermSessionsRevoke   = "sessions:revoke"
+	PermClientsManage    = "clients:manage"
+	PermRolesManage      = "roles:manage"
+	PermAuditRead        = "audit:read"
+	PermOrgsManage       = "organizations:manage"
+	PermAPIKeysManage    = "api_keys:manage"
+)
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// Grants reports whether the role includes the permission, directly or
+// through a wildcard.
+func (r *Role) Grants(permission string) bool {
+	for _, granted := range r.Permissions {
+		if granted == "*" || granted == permission {
+			return true
+		}
+		if group, ok := strings.CutSuffix(granted, ":*"); ok && strings.HasPrefix(permission, group+":") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+type SessionRepository interface {
+	Create(session Session) error
+	GetByID(id string) (Session, error)
+	// ListActive returns the sessions that are neither revoked nor past the
+	// expiry of their current refresh token.
+	ListActive(userID int, now time.Time) ([]Session, error)
+	Touch(id string, refreshTokenHash string, usedAt time.Time) error
+	Revoke(id string) error
+	RevokeAll(userID int) error
+	// DeleteExpired drops the sessions none of whose refresh tokens is valid anymore.
+	DeleteExpired(now time.Time) error
+}
+
+var (
+	ErrSessionNotFound = errors.New("Сессия не найдена")
+	ErrSessionRevoked  = errors.New("Сессия завершена")
+)
+
+// Session is one logged in device. Its ID doubles as the refresh token family.
+type Session struct {
+	ID               string     `json:"id"`
+	UserID           int        `json:"-"`
+	Tenant           string     `json:"tenant"`
+	DeviceName       string     `json:"deviceName"`
+	UserAgent        string     `json:"userAgent"`
+	IP               string     `json:"ip"`
+	ClientID         string     `json:"clientId,omitempty"`
+	Scope            string     `json:"scope,omitempty"`
+	RefreshTokenHash string     `json:"-"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	LastUsedAt       time.Time  `json:"lastUsedAt"`
+	RevokedAt        *time.Time `json:"-"`
+	// AuthTime is when the user last entered their credentials for the session.
+	AuthTime time.Time `json:"-"`
+}
+
+// Grant is what the session's tokens are issued for. First-party logins
+// through /v1/login have no client and no scope unless they ask for openid.
+type Grant struct {
+	// Tenant is the organization the user signed in to.
+	Tenant   string
+	ClientID string
+	Scope    string
+	// Nonce is echoed in the first ID token of the session.
+	Nonce string
+	// AuthTime defaults to the start of the session.
+	AuthTime time.Time
+}
+
+// Device describes where a login came from.
+type Device struct {
+	Name      string
+	UserAgent string
+	IP        string
+}
@@ -5,13 +5,23 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// UserRepository only sees the members of one tenant.
 type UserRepository interface {
-	GetAll() ([]User, error)
-	GetByID(id int) (User, error)
-	GetByEmail(email string) (User, error)
-	Create(user User) (User, error)
-	Delete(id int) error
-	Login(user User, refresh string) error
+	GetAll(tenant string) ([]User, error)
+	GetByID(tenant string, id int) (User, error)
+	GetByEmail(tenant string, email string) (User, error)
+	// Create adds the user to the tenant. Emails are unique within a tenant.
+	Create(tenant string, user User) (User, error)
+	// Delete removes the user from the tenant, with its sessions, codes and
+	// tokens there, and removes the user for good once it is a member of no
+	// tenant at all.
+	Delete(tenant string, id int) error
+	// VerifyEmail marks the email of the user as verified, provided it is
+	// still the address the verification was sent to.
+	VerifyEmail(id int, email string) (bool, error)
+	// UpdatePassword stores a password that is already hashed.
+	UpdatePassword(id int, password string) error
+	UpdateName(id int, name string) error
 }
 
 var (
@@ -23,11 +33,12 @@ var (
 )
 
 type User struct {
-	ID           int     `json:"id"`
-	Name         string  `json:"name"`
-	Password     string  `json:"password"`
-	Email        string  `json:"email"`
-	RefreshToken *string `json:"refresh_token"`
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+	// EmailVerified is set once the user follows the link sent on registration.
+	EmailVerified bool `json:"emailVerified"`
 }
 
 func (u *User) HashPassword() error {
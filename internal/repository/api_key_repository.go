@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type apiKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) entity.APIKeyRepository {
+	return &apiKeyRepository{db}
+}
+
+const apiKeyColumns = `id, name, tenant, hint, key_hash, scopes, allowed_ips, quota_limit, quota_period,
+	total_requests, window_start, window_count, last_used_at, last_used_ip,
+	created_at, rotated_at, expires_at, revoked_at`
+
+func (r *apiKeyRepository) GetAll() ([]entity.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска API ключей: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []entity.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка поиска API ключей: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *apiKeyRepository) GetByID(id string) (entity.APIKey, error) {
+	return r.getBy(`id`, id)
+}
+
+func (r *apiKeyRepository) GetByHash(hash string) (entity.APIKey, error) {
+	return r.getBy(`key_hash`, hash)
+}
+
+func (r *apiKeyRepository) getBy(column string, value string) (entity.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE ` + column + ` = $1`
+
+	key, err := scanAPIKey(r.db.QueryRow(query, value))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.APIKey{}, entity.ErrAPIKeyNotFound
+		}
+		return entity.APIKey{}, fmt.Errorf("Ошибка поиска API ключа: %w", err)
+	}
+	return key, nil
+}
+
+func (r *apiKeyRepository) Save(key entity.APIKey) error {
+	query :=
+		`INSERT INTO api_keys(id, name, tenant, hint, key_hash, scopes, allowed_ips, quota_limit, quota_period,
+		                      created_at, rotated_at, expires_at, revoked_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		 ON CONFLICT(id) DO UPDATE
+		 SET name = excluded.name,
+		     tenant = excluded.tenant,
+		     hint = excluded.hint,
+		     key_hash = excluded.key_hash,
+		     scopes = excluded.scopes,
+		     allowed_ips = excluded.allowed_ips,
+		     quota_limit = excluded.quota_limit,
+		     quota_period = excluded.quota_period,
+		     rotated_at = excluded.rotated_at,
+		     expires_at = excluded.expires_at,
+		     revoked_at = excluded.revoked_at`
+
+	lists := make([]string, 2)
+	for i, list := range [][]string{key.Scopes, key.AllowedIPs} {
+		if list == nil {
+			list = []string{}
+		}
+		data, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		lists[i] = string(data)
+	}
+
+	_, err := r.db.Exec(
+		query,
+		key.ID,
+		key.Name,
+		key.Tenant,
+		key.Hint,
+		key.KeyHash,
+		lists[0],
+		lists[1],
+		key.Quota.Limit,
+		key.Quota.Period,
+		key.CreatedAt,
+		key.RotatedAt,
+		key.ExpiresAt,
+		key.RevokedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения API ключа: %w", err)
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) Consume(id string, windowStart time.Time, now time.Time, ip string) (int, bool, error) {
+	// One statement, so that concurrent requests can not both take the last
+	// request of the quota
+	query :=
+		`UPDATE api_keys
+		 SET window_count = CASE WHEN window_start = $2 THEN window_count + 1 ELSE 1 END,
+		     window_start = $2,
+		     total_requests = total_requests + 1,
+		     last_used_at = $3,
+		     last_used_ip = $4
+		 WHERE id = $1 AND (quota_limit = 0 OR window_start IS NOT $2 OR window_count < quota_limit)
+		 RETURNING window_count`
+
+	var count int
+	err := r.db.QueryRow(query, id, windowStart, now, ip).Scan(&count)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("Ошибка учета запроса API ключа: %w", err)
+	}
+	return count, true, nil
+}
+
+func scanAPIKey(row rowScanner) (entity.APIKey, error) {
+	var (
+		key                entity.APIKey
+		scopes, allowedIPs string
+	)
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Tenant,
+		&key.Hint,
+		&key.KeyHash,
+		&scopes,
+		&allowedIPs,
+		&key.Quota.Limit,
+		&key.Quota.Period,
+		&key.Usage.Total,
+		&key.Usage.WindowStart,
+		&key.Usage.WindowCount,
+		&key.Usage.LastUsedAt,
+		&key.Usage.LastUsedIP,
+		&key.CreatedAt,
+		&key.RotatedAt,
+		&key.ExpiresAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return entity.APIKey{}, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return entity.APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(allowedIPs), &key.AllowedIPs); err != nil {
+		return entity.APIKey{}, err
+	}
+	return key, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"fmt"
+)
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) entity.AuditRepository {
+	return &auditRepository{db}
+}
+
+func (r *auditRepository) Create(event entity.AuditEvent) error {
+	query :=
+		`INSERT INTO audit_events(action, outcome, actor_id, subject_id, client_id, details, ip, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := r.db.Exec(
+		query,
+		event.Action,
+		event.Outcome,
+		event.ActorID,
+		event.SubjectID,
+		event.ClientID,
+		event.Details,
+		event.IP,
+		event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка записи в журнал аудита: %w", err)
+	}
+	return nil
+}
+
+func (r *auditRepository) List(limit int) ([]entity.AuditEvent, error) {
+	query :=
+		`SELECT id, action, outcome, actor_id, subject_id, client_id, details, ip, created_at
+		 FROM audit_events
+		 ORDER BY id DESC
+		 LIMIT $1`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка чтения журнала аудита: %w", err)
+	}
+	defer rows.Close()
+
+	events := []entity.AuditEvent{}
+	for rows.Next() {
+		var event entity.AuditEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.Action,
+			&event.Outcome,
+			&event.ActorID,
+			&event.SubjectID,
+			&event.ClientID,
+			&event.Details,
+			&event.IP,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка чтения журнала аудита: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type authorizationCodeRepository struct {
+	db *sql.DB
+}
+
+func NewAuthorizationCodeRepository(db *sql.DB) entity.AuthorizationCodeRepository {
+	return &authorizationCodeRepository{db}
+}
+
+func (r *authorizationCodeRepository) Create(code entity.AuthorizationCode) error {
+	query :=
+		`INSERT INTO authorization_codes(code_hash, client_id, user_id, tenant, redirect_uri, scope,
+		                                 code_challenge, code_challenge_method, nonce, auth_time,
+		                                 created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	_, err := r.db.Exec(
+		query,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.Tenant,
+		code.RedirectURI,
+		code.Scope,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.Nonce,
+		code.AuthTime,
+		code.CreatedAt,
+		code.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения кода авторизации: %w", err)
+	}
+	return nil
+}
+
+func (r *authorizationCodeRepository) GetByHash(hash string) (entity.AuthorizationCode, error) {
+	query :=
+		`SELECT code_hash, client_id, user_id, tenant, redirect_uri, scope, code_challenge,
+		        code_challenge_method, nonce, auth_time, session_id, created_at, expires_at, used_at
+		 FROM authorization_codes WHERE code_hash = $1`
+
+	var (
+		code     entity.AuthorizationCode
+		authTime sql.NullTime
+	)
+	err := r.db.QueryRow(query, hash).Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.Tenant,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.Nonce,
+		&authTime,
+		&code.SessionID,
+		&code.CreatedAt,
+		&code.ExpiresAt,
+		&code.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.AuthorizationCode{}, entity.ErrAuthorizationCodeNotFound
+		}
+		return entity.AuthorizationCode{}, fmt.Errorf("Ошибка поиска кода авторизации: %w", err)
+	}
+	code.AuthTime = code.CreatedAt
+	if authTime.Valid {
+		code.AuthTime = authTime.Time
+	}
+	return code, nil
+}
+
+func (r *authorizationCodeRepository) MarkUsed(hash string, usedAt time.Time) (bool, error) {
+	query :=
+		`UPDATE authorization_codes
+		 SET used_at = $1
+		 WHERE code_hash = $2 AND used_at IS NULL`
+
+	res, err := r.db.Exec(query, usedAt, hash)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления кода авторизации: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *authorizationCodeRepository) SetSession(hash string, sessionID string) error {
+	query := `UPDATE authorization_codes SET session_id = $1 WHERE code_hash = $2`
+
+	if _, err := r.db.Exec(query, sessionID, hash); err != nil {
+		return fmt.Errorf("Ошибка обновления кода авторизации: %w", err)
+	}
+	return nil
+}
+
+func (r *authorizationCodeRepository) DeleteExpired(now time.Time) error {
+	query := `DELETE FROM authorization_codes WHERE expires_at <= $1`
+
+	if _, err := r.db.Exec(query, now); err != nil {
+		return fmt.Errorf("Ошибка очистки кодов авторизации: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type clientRepository struct {
+	db *sql.DB
+}
+
+func NewClientRepository(db *sql.DB) entity.ClientRepository {
+	return &clientRepository{db}
+}
+
+const clientColumns = `id, name, secret_hash, redirect_uris, scopes, grant_types, public, created_at, disabled_at`
+
+func (r *clientRepository) GetAll() ([]entity.Client, error) {
+	query := `SELECT ` + clientColumns + ` FROM oauth_clients ORDER BY created_at`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска клиентов: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []entity.Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка поиска клиентов: %w", err)
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+func (r *clientRepository) GetByID(id string) (entity.Client, error) {
+	query := `SELECT ` + clientColumns + ` FROM oauth_clients WHERE id = $1`
+
+	client, err := scanClient(r.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Client{}, entity.ErrClientNotFound
+		}
+		return entity.Client{}, fmt.Errorf("Ошибка поиска клиента: %w", err)
+	}
+	return client, nil
+}
+
+func (r *clientRepository) Save(client entity.Client) error {
+	query :=
+		`INSERT INTO oauth_clients(` + clientColumns + `)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 ON CONFLICT(id) DO UPDATE
+		 SET name = excluded.name,
+		     secret_hash = excluded.secret_hash,
+		     redirect_uris = excluded.redirect_uris,
+		     scopes = excluded.scopes,
+		     grant_types = excluded.grant_types,
+		     public = excluded.public,
+		     disabled_at = excluded.disabled_at`
+
+	lists := make([]string, 3)
+	for i, list := range [][]string{client.RedirectURIs, client.Scopes, client.GrantTypes} {
+		if list == nil {
+			list = []string{}
+		}
+		data, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		lists[i] = string(data)
+	}
+
+	_, err := r.db.Exec(
+		query,
+		client.ID,
+		client.Name,
+		client.SecretHash,
+		lists[0],
+		lists[1],
+		lists[2],
+		client.Public,
+		client.CreatedAt,
+		client.DisabledAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения клиента: %w", err)
+	}
+	return nil
+}
+
+func scanClient(row rowScanner) (entity.Client, error) {
+	var (
+		client                           entity.Client
+		redirectURIs, scopes, grantTypes string
+	)
+	err := row.Scan(
+		&client.ID,
+		&client.Name,
+		&client.SecretHash,
+		&redirectURIs,
+		&scopes,
+		&grantTypes,
+		&client.Public,
+		&client.CreatedAt,
+		&client.DisabledAt,
+	)
+	if err != nil {
+		return entity.Client{}, err
+	}
+
+	for _, field := range []struct {
+		raw  string
+		dest *[]string
+	}{
+		{redirectURIs, &client.RedirectURIs},
+		{scopes, &client.Scopes},
+		{grantTypes, &client.GrantTypes},
+	} {
+		if err := json.Unmarshal([]byte(field.raw), field.dest); err != nil {
+			return entity.Client{}, err
+		}
+	}
+	return client, nil
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type credentialRepository struct {
+	db *sql.DB
+}
+
+func NewCredentialRepository(db *sql.DB) entity.CredentialRepository {
+	return &credentialRepository{db}
+}
+
+const credentialColumns = `id, user_id, name, public_key, sign_count, aaguid, transports, attestation, created_at, last_used_at`
+
+func (r *credentialRepository) Create(credential entity.Credential) error {
+	query :=
+		`INSERT INTO webauthn_credentials(` + credentialColumns + `)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULL)
+		 ON CONFLICT(id) DO NOTHING`
+
+	res, err := r.db.Exec(
+		query,
+		credential.ID,
+		credential.UserID,
+		credential.Name,
+		credential.PublicKey,
+		credential.SignCount,
+		credential.AAGUID,
+		strings.Join(credential.Transports, " "),
+		credential.Attestation,
+		credential.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения ключа доступа: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entity.ErrCredentialExists
+	}
+	return nil
+}
+
+func (r *credentialRepository) GetByID(id string) (entity.Credential, error) {
+	query := `SELECT ` + credentialColumns + ` FROM webauthn_credentials WHERE id = $1`
+
+	credential, err := scanCredential(r.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Credential{}, entity.ErrCredentialNotFound
+		}
+		return entity.Credential{}, fmt.Errorf("Ошибка поиска ключа доступа: %w", err)
+	}
+	return credential, nil
+}
+
+func (r *credentialRepository) GetByUser(userID int) ([]entity.Credential, error) {
+	query := `SELECT ` + credentialColumns + ` FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска ключей доступа: %w", err)
+	}
+	defer rows.Close()
+
+	credentials := []entity.Credential{}
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка поиска ключей доступа: %w", err)
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, rows.Err()
+}
+
+func (r *credentialRepository) UpdateSignCount(id string, signCount uint32, usedAt time.Time) (bool, error) {
+	// Authenticators without a counter always report zero
+	query :=
+		`UPDATE webauthn_credentials
+		 SET sign_count = $1, last_used_at = $2
+		 WHERE id = $3 AND (sign_count < $1 OR (sign_count = 0 AND $1 = 0))`
+
+	res, err := r.db.Exec(query, signCount, usedAt, id)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления ключа доступа: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *credentialRepository) Delete(userID int, id string) error {
+	res, err := r.db.Exec(`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("Ошибка удаления ключа доступа: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entity.ErrCredentialNotFound
+	}
+	return nil
+}
+
+func scanCredential(row rowScanner) (entity.Credential, error) {
+	var (
+		credential entity.Credential
+		transports string
+	)
+	err := row.Scan(
+		&credential.ID,
+		&credential.UserID,
+		&credential.Name,
+		&credential.PublicKey,
+		&credential.SignCount,
+		&credential.AAGUID,
+		&transports,
+		&credential.Attestation,
+		&credential.CreatedAt,
+		&credential.LastUsedAt,
+	)
+	if err != nil {
+		return entity.Credential{}, err
+	}
+	credential.Transports = strings.Fields(transports)
+	return credential, nil
+}
+
+type webAuthnChallengeRepository struct {
+	db *sql.DB
+}
+
+func NewWebAuthnChallengeRepository(db *sql.DB) entity.WebAuthnChallengeRepository {
+	return &webAuthnChallengeRepository{db}
+}
+
+func (r *webAuthnChallengeRepository) Create(challenge entity.WebAuthnChallenge) error {
+	query :=
+		`INSERT INTO webauthn_challenges(challenge, ceremony, tenant, user_id, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := r.db.Exec(
+		query,
+		challenge.Challenge,
+		challenge.Ceremony,
+		challenge.Tenant,
+		challenge.UserID,
+		challenge.CreatedAt,
+		challenge.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения запроса WebAuthn: %w", err)
+	}
+	return nil
+}
+
+func (r *webAuthnChallengeRepository) Take(challenge string) (entity.WebAuthnChallenge, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return entity.WebAuthnChallenge{}, fmt.Errorf("Ошибка чтения запроса WebAuthn: %w", err)
+	}
+	defer tx.Rollback()
+
+	var taken entity.WebAuthnChallenge
+	query := `SELECT challenge, ceremony, tenant, user_id, created_at, expires_at FROM webauthn_challenges WHERE challenge = $1`
+	err = tx.QueryRow(query, challenge).Scan(
+		&taken.Challenge,
+		&taken.Ceremony,
+		&taken.Tenant,
+		&taken.UserID,
+		&taken.CreatedAt,
+		&taken.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.WebAuthnChallenge{}, entity.ErrChallengeNotFound
+		}
+		return entity.WebAuthnChallenge{}, fmt.Errorf("Ошибка чтения запроса WebAuthn: %w", err)
+	}
+
+	res, err := tx.Exec(`DELETE FROM webauthn_challenges WHERE challenge = $1`, challenge)
+	if err != nil {
+		return entity.WebAuthnChallenge{}, fmt.Errorf("Ошибка чтения запроса WebAuthn: %w", err)
+	}
+	// A concurrent Take got there first
+	if affected, err := res.RowsAffected(); err != nil || affected != 1 {
+		return entity.WebAuthnChallenge{}, entity.ErrChallengeNotFound
+	}
+	return taken, tx.Commit()
+}
+
+func (r *webAuthnChallengeRepository) DeleteExpired(now time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM webauthn_challenges WHERE expires_at <= $1`, now); err != nil {
+		return fmt.Errorf("Ошибка очистки запросов WebAuthn: %w", err)
+	}
+	return nil
+}
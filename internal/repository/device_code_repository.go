@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type deviceCodeRepository struct {
+	db *sql.DB
+}
+
+func NewDeviceCodeRepository(db *sql.DB) entity.DeviceCodeRepository {
+	return &deviceCodeRepository{db}
+}
+
+const deviceCodeColumns = `device_code_hash, user_code, client_id, scope, status, tenant, user_id,
+	interval_seconds, last_polled_at, decided_at, created_at, expires_at, used_at`
+
+func (r *deviceCodeRepository) Create(code entity.DeviceCode) error {
+	query :=
+		`INSERT INTO device_codes(device_code_hash, user_code, client_id, scope, status, interval_seconds, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := r.db.Exec(
+		query,
+		code.DeviceCodeHash,
+		code.UserCode,
+		code.ClientID,
+		code.Scope,
+		code.Status,
+		int64(code.Interval/time.Second),
+		code.CreatedAt,
+		code.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения кода устройства: %w", err)
+	}
+	return nil
+}
+
+func (r *deviceCodeRepository) GetByHash(hash string) (entity.DeviceCode, error) {
+	query := `SELECT ` + deviceCodeColumns + ` FROM device_codes WHERE device_code_hash = $1`
+	return r.get(query, hash)
+}
+
+func (r *deviceCodeRepository) GetByUserCode(userCode string) (entity.DeviceCode, error) {
+	query := `SELECT ` + deviceCodeColumns + ` FROM device_codes WHERE user_code = $1`
+	return r.get(query, userCode)
+}
+
+func (r *deviceCodeRepository) Poll(hash string, polledAt time.Time, interval time.Duration) error {
+	query :=
+		`UPDATE device_codes
+		 SET last_polled_at = $1, interval_seconds = $2
+		 WHERE device_code_hash = $3`
+
+	if _, err := r.db.Exec(query, polledAt, int64(interval/time.Second), hash); err != nil {
+		return fmt.Errorf("Ошибка обновления кода устройства: %w", err)
+	}
+	return nil
+}
+
+func (r *deviceCodeRepository) Decide(
+	userCode string,
+	status entity.DeviceCodeStatus,
+	tenant string,
+	userID int,
+	decidedAt time.Time,
+) (bool, error) {
+	query :=
+		`UPDATE device_codes
+		 SET status = $1, tenant = $2, user_id = $3, decided_at = $4
+		 WHERE user_code = $5 AND status = $6`
+
+	res, err := r.db.Exec(query, status, tenant, userID, decidedAt, userCode, entity.DeviceCodePending)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления кода устройства: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *deviceCodeRepository) MarkUsed(hash string, usedAt time.Time) (bool, error) {
+	query :=
+		`UPDATE device_codes
+		 SET used_at = $1
+		 WHERE device_code_hash = $2 AND used_at IS NULL`
+
+	res, err := r.db.Exec(query, usedAt, hash)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления кода устройства: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *deviceCodeRepository) DeleteExpired(now time.Time) error {
+	query := `DELETE FROM device_codes WHERE expires_at <= $1`
+
+	if _, err := r.db.Exec(query, now); err != nil {
+		return fmt.Errorf("Ошибка очистки кодов устройств: %w", err)
+	}
+	return nil
+}
+
+func (r *deviceCodeRepository) get(query string, arg any) (entity.DeviceCode, error) {
+	var (
+		code     entity.DeviceCode
+		interval int64
+	)
+	err := r.db.QueryRow(query, arg).Scan(
+		&code.DeviceCodeHash,
+		&code.UserCode,
+		&code.ClientID,
+		&code.Scope,
+		&code.Status,
+		&code.Tenant,
+		&code.UserID,
+		&interval,
+		&code.LastPolledAt,
+		&code.DecidedAt,
+		&code.CreatedAt,
+		&code.ExpiresAt,
+		&code.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.DeviceCode{}, entity.ErrDeviceCodeNotFound
+		}
+		return entity.DeviceCode{}, fmt.Errorf("Ошибка поиска кода устройства: %w", err)
+	}
+	code.Interval = time.Duration(interval) * time.Second
+	return code, nil
+}
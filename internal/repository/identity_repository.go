@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) entity.IdentityRepository {
+	return &identityRepository{db}
+}
+
+func (r *identityRepository) Create(identity entity.Identity) error {
+	query :=
+		`INSERT INTO user_identities(provider, subject, user_id, email, created_at)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT(provider, subject, user_id) DO NOTHING`
+
+	_, err := r.db.Exec(query, identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения внешней учетной записи: %w", err)
+	}
+	return nil
+}
+
+func (r *identityRepository) GetUserIDs(provider string, subject string) ([]int, error) {
+	query := `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2 ORDER BY created_at`
+
+	rows, err := r.db.Query(query, provider, subject)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска внешней учетной записи: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("Ошибка поиска внешней учетной записи: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *identityRepository) Touch(provider string, subject string, userID int, at time.Time) error {
+	query := `UPDATE user_identities SET last_login_at = $1 WHERE provider = $2 AND subject = $3 AND user_id = $4`
+
+	if _, err := r.db.Exec(query, at, provider, subject, userID); err != nil {
+		return fmt.Errorf("Ошибка обновления внешней учетной записи: %w", err)
+	}
+	return nil
+}
+
+type federationStateRepository struct {
+	db *sql.DB
+}
+
+func NewFederationStateRepository(db *sql.DB) entity.FederationStateRepository {
+	return &federationStateRepository{db}
+}
+
+func (r *federationStateRepository) Create(state entity.FederationState) error {
+	query :=
+		`INSERT INTO federation_states(state_hash, provider, tenant, nonce, verifier, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := r.db.Exec(
+		query,
+		state.StateHash,
+		state.Provider,
+		state.Tenant,
+		state.Nonce,
+		state.Verifier,
+		state.CreatedAt,
+		state.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения запроса входа через провайдера: %w", err)
+	}
+	return nil
+}
+
+func (r *federationStateRepository) Take(hash string) (entity.FederationState, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return entity.FederationState{}, fmt.Errorf("Ошибка чтения запроса входа через провайдера: %w", err)
+	}
+	defer tx.Rollback()
+
+	var state entity.FederationState
+	query := `SELECT state_hash, provider, tenant, nonce, verifier, created_at, expires_at FROM federation_states WHERE state_hash = $1`
+	err = tx.QueryRow(query, hash).Scan(
+		&state.StateHash,
+		&state.Provider,
+		&state.Tenant,
+		&state.Nonce,
+		&state.Verifier,
+		&state.CreatedAt,
+		&state.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.FederationState{}, entity.ErrFederationStateNotFound
+		}
+		return entity.FederationState{}, fmt.Errorf("Ошибка чтения запроса входа через провайдера: %w", err)
+	}
+
+	res, err := tx.Exec(`DELETE FROM federation_states WHERE state_hash = $1`, hash)
+	if err != nil {
+		return entity.FederationState{}, fmt.Errorf("Ошибка чтения запроса входа через провайдера: %w", err)
+	}
+	// A concurrent Take got there first
+	if affected, err := res.RowsAffected(); err != nil || affected != 1 {
+		return entity.FederationState{}, entity.ErrFederationStateNotFound
+	}
+	return state, tx.Commit()
+}
+
+func (r *federationStateRepository) DeleteExpired(now time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM federation_states WHERE expires_at <= $1`, now); err != nil {
+		return fmt.Errorf("Ошибка очистки запросов входа через провайдера: %w", err)
+	}
+	return nil
+}
+
+type assertionReplayRepository struct {
+	db *sql.DB
+}
+
+func NewAssertionReplayRepository(db *sql.DB) entity.AssertionReplayRepository {
+	return &assertionReplayRepository{db}
+}
+
+func (r *assertionReplayRepository) Remember(issuer string, id string, expiresAt time.Time) (bool, error) {
+	query :=
+		`INSERT INTO saml_assertions(issuer, assertion_id, expires_at) VALUES ($1, $2, $3)
+		 ON CONFLICT(issuer, assertion_id) DO NOTHING`
+
+	res, err := r.db.Exec(query, issuer, id, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка сохранения SAML утверждения: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *assertionReplayRepository) DeleteExpired(now time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM saml_assertions WHERE expires_at <= $1`, now); err != nil {
+		return fmt.Errorf("Ошибка очистки SAML утверждений: %w", err)
+	}
+	return nil
+}
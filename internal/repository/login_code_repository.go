@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type loginCodeRepository struct {
+	db *sql.DB
+}
+
+func NewLoginCodeRepository(db *sql.DB) entity.LoginCodeRepository {
+	return &loginCodeRepository{db}
+}
+
+const loginCodeColumns = `token_hash, binding_hash, code_hash, user_id, tenant, email, attempts, created_at, expires_at, used_at`
+
+func (r *loginCodeRepository) Create(code entity.LoginCode) error {
+	query :=
+		`INSERT INTO login_codes(` + loginCodeColumns + `)
+		 VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8, NULL)`
+
+	_, err := r.db.Exec(
+		query,
+		code.TokenHash,
+		code.BindingHash,
+		code.CodeHash,
+		code.UserID,
+		code.Tenant,
+		code.Email,
+		code.CreatedAt,
+		code.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения запроса на вход: %w", err)
+	}
+	return nil
+}
+
+func (r *loginCodeRepository) GetByHash(hash string) (entity.LoginCode, error) {
+	return r.get(`SELECT `+loginCodeColumns+` FROM login_codes WHERE token_hash = $1`, hash)
+}
+
+func (r *loginCodeRepository) GetByBinding(bindingHash string) (entity.LoginCode, error) {
+	return r.get(`SELECT `+loginCodeColumns+` FROM login_codes WHERE binding_hash = $1`, bindingHash)
+}
+
+func (r *loginCodeRepository) get(query string, arg string) (entity.LoginCode, error) {
+	var code entity.LoginCode
+	err := r.db.QueryRow(query, arg).Scan(
+		&code.TokenHash,
+		&code.BindingHash,
+		&code.CodeHash,
+		&code.UserID,
+		&code.Tenant,
+		&code.Email,
+		&code.Attempts,
+		&code.CreatedAt,
+		&code.ExpiresAt,
+		&code.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.LoginCode{}, entity.ErrLoginCodeNotFound
+		}
+		return entity.LoginCode{}, fmt.Errorf("Ошибка поиска запроса на вход: %w", err)
+	}
+	return code, nil
+}
+
+func (r *loginCodeRepository) CountAttempt(hash string, max int) (bool, error) {
+	query :=
+		`UPDATE login_codes
+		 SET attempts = attempts + 1
+		 WHERE token_hash = $1 AND attempts < $2`
+
+	res, err := r.db.Exec(query, hash, max)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления запроса на вход: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *loginCodeRepository) MarkUsed(hash string, usedAt time.Time) (bool, error) {
+	query :=
+		`UPDATE login_codes
+		 SET used_at = $1
+		 WHERE token_hash = $2 AND used_at IS NULL`
+
+	res, err := r.db.Exec(query, usedAt, hash)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления запроса на вход: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *loginCodeRepository) DeleteExpired(now time.Time) error {
+	query := `DELETE FROM login_codes WHERE expires_at <= $1`
+
+	if _, err := r.db.Exec(query, now); err != nil {
+		return fmt.Errorf("Ошибка очистки запросов на вход: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type mfaRepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) entity.MFARepository {
+	return &mfaRepository{db}
+}
+
+func (r *mfaRepository) GetTOTP(userID int) (entity.TOTP, error) {
+	query := `SELECT user_id, secret, last_step, created_at, confirmed_at FROM user_totp WHERE user_id = $1`
+
+	var totp entity.TOTP
+	err := r.db.QueryRow(query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.LastStep,
+		&totp.CreatedAt,
+		&totp.ConfirmedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.TOTP{}, entity.ErrTOTPNotFound
+		}
+		return entity.TOTP{}, fmt.Errorf("Ошибка чтения 2FA: %w", err)
+	}
+	return totp, nil
+}
+
+func (r *mfaRepository) SaveTOTP(totp entity.TOTP) error {
+	query :=
+		`INSERT INTO user_totp(user_id, secret, last_step, created_at)
+		 VALUES ($1, $2, 0, $3)
+		 ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = excluded.created_at
+		 WHERE user_totp.confirmed_at IS NULL`
+
+	res, err := r.db.Exec(query, totp.UserID, totp.Secret, totp.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения 2FA: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entity.ErrTOTPEnabled
+	}
+	return nil
+}
+
+func (r *mfaRepository) ConfirmTOTP(userID int, confirmedAt time.Time) error {
+	query := `UPDATE user_totp SET confirmed_at = $1 WHERE user_id = $2 AND confirmed_at IS NULL`
+
+	res, err := r.db.Exec(query, confirmedAt, userID)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения 2FA: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entity.ErrTOTPEnabled
+	}
+	return nil
+}
+
+func (r *mfaRepository) UseStep(userID int, step int64) (bool, error) {
+	query := `UPDATE user_totp SET last_step = $1 WHERE user_id = $2 AND last_step < $1`
+
+	res, err := r.db.Exec(query, step, userID)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка сохранения 2FA: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *mfaRepository) DeleteTOTP(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Ошибка удаления 2FA: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("Ошибка удаления 2FA: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения кодов восстановления: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("Ошибка сохранения кодов восстановления: %w", err)
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes(user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return fmt.Errorf("Ошибка сохранения кодов восстановления: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *mfaRepository) UseRecoveryCode(userID int, hash string, usedAt time.Time) (bool, error) {
+	query :=
+		`UPDATE recovery_codes
+		 SET used_at = $1
+		 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+
+	res, err := r.db.Exec(query, usedAt, userID, hash)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления кода восстановления: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *mfaRepository) RecoveryCodesLeft(userID int) (int, error) {
+	var left int
+	query := `SELECT count(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	if err := r.db.QueryRow(query, userID).Scan(&left); err != nil {
+		return 0, fmt.Errorf("Ошибка чтения кодов восстановления: %w", err)
+	}
+	return left, nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type organizationRepository struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepository(db *sql.DB) entity.OrganizationRepository {
+	return &organizationRepository{db}
+}
+
+func (r *organizationRepository) GetAll() ([]entity.Organization, error) {
+	rows, err := r.db.Query(`SELECT id, name, created_at FROM organizations ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска организаций: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []entity.Organization{}
+	for rows.Next() {
+		var org entity.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Ошибка поиска организаций: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+func (r *organizationRepository) GetByID(id string) (entity.Organization, error) {
+	var org entity.Organization
+	err := r.db.QueryRow(`SELECT id, name, created_at FROM organizations WHERE id = $1`, id).
+		Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Organization{}, entity.ErrOrganizationNotFound
+		}
+		return entity.Organization{}, fmt.Errorf("Ошибка поиска организации: %w", err)
+	}
+	return org, nil
+}
+
+func (r *organizationRepository) Save(org entity.Organization) error {
+	query :=
+		`INSERT INTO organizations(id, name, created_at) VALUES ($1, $2, $3)
+		 ON CONFLICT(id) DO UPDATE SET name = excluded.name`
+
+	if _, err := r.db.Exec(query, org.ID, org.Name, org.CreatedAt); err != nil {
+		return fmt.Errorf("Ошибка сохранения организации: %w", err)
+	}
+	return nil
+}
+
+func (r *organizationRepository) Members(orgID string) ([]entity.Member, error) {
+	query :=
+		`SELECT u.id, u.name, u.email, m.created_at
+		 FROM memberships m JOIN users u ON u.id = m.user_id
+		 WHERE m.org_id = $1
+		 ORDER BY u.id`
+
+	rows, err := r.db.Query(query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска участников организации: %w", err)
+	}
+	defer rows.Close()
+
+	members := []entity.Member{}
+	for rows.Next() {
+		var member entity.Member
+		if err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("Ошибка поиска участников организации: %w", err)
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (r *organizationRepository) IsMember(orgID string, userID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM memberships WHERE org_id = $1 AND user_id = $2)`,
+		orgID, userID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка поиска участников организации: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *organizationRepository) AddMember(orgID string, userID int, joinedAt time.Time) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("Ошибка добавления участника: %w", err)
+	}
+	defer tx.Rollback()
+
+	var email string
+	if err := tx.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, entity.NotFoundUser
+		}
+		return false, fmt.Errorf("Ошибка добавления участника: %w", err)
+	}
+
+	var taken bool
+	err = tx.QueryRow(
+		`SELECT EXISTS(
+		     SELECT 1 FROM memberships m JOIN users u ON u.id = m.user_id
+		     WHERE m.org_id = $1 AND u.email = $2 AND u.id != $3
+		 )`,
+		orgID, email, userID,
+	).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка добавления участника: %w", err)
+	}
+	if taken {
+		return false, entity.ErrUserAlreadyRegistered
+	}
+
+	res, err := tx.Exec(
+		`INSERT OR IGNORE INTO memberships(org_id, user_id, created_at) VALUES ($1, $2, $3)`,
+		orgID, userID, joinedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка добавления участника: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, tx.Commit()
+}
+
+func (r *organizationRepository) RemoveMember(orgID string, userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Ошибка удаления участника: %w", err)
+	}
+	defer tx.Rollback()
+
+	removed, err := removeMembership(tx, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("Ошибка удаления участника: %w", err)
+	}
+	if !removed {
+		return entity.ErrNotMember
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type passwordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) entity.PasswordResetRepository {
+	return &passwordResetRepository{db}
+}
+
+func (r *passwordResetRepository) Create(reset entity.PasswordReset) error {
+	query :=
+		`INSERT INTO password_resets(token_hash, user_id, tenant, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := r.db.Exec(query, reset.TokenHash, reset.UserID, reset.Tenant, reset.CreatedAt, reset.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения запроса на сброс пароля: %w", err)
+	}
+	return nil
+}
+
+func (r *passwordResetRepository) GetByHash(hash string) (entity.PasswordReset, error) {
+	query :=
+		`SELECT token_hash, user_id, tenant, created_at, expires_at, used_at
+		 FROM password_resets WHERE token_hash = $1`
+
+	var reset entity.PasswordReset
+	err := r.db.QueryRow(query, hash).Scan(
+		&reset.TokenHash,
+		&reset.UserID,
+		&reset.Tenant,
+		&reset.CreatedAt,
+		&reset.ExpiresAt,
+		&reset.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.PasswordReset{}, entity.ErrPasswordResetNotFound
+		}
+		return entity.PasswordReset{}, fmt.Errorf("Ошибка поиска запроса на сброс пароля: %w", err)
+	}
+	return reset, nil
+}
+
+func (r *passwordResetRepository) MarkUsed(hash string, usedAt time.Time) (bool, error) {
+	query :=
+		`UPDATE password_resets
+		 SET used_at = $1
+		 WHERE token_hash = $2 AND used_at IS NULL`
+
+	res, err := r.db.Exec(query, usedAt, hash)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления запроса на сброс пароля: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *passwordResetRepository) DeleteByUser(userID int) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL`
+
+	if _, err := r.db.Exec(query, userID); err != nil {
+		return fmt.Errorf("Ошибка удаления запросов на сброс пароля: %w", err)
+	}
+	return nil
+}
+
+func (r *passwordResetRepository) DeleteExpired(now time.Time) error {
+	query := `DELETE FROM password_resets WHERE expires_at <= $1`
+
+	if _, err := r.db.Exec(query, now); err != nil {
+		return fmt.Errorf("Ошибка очистки запросов на сброс пароля: %w", err)
+	}
+	return nil
+}
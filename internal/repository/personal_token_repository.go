@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type personalTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPersonalTokenRepository(db *sql.DB) entity.PersonalTokenRepository {
+	return &personalTokenRepository{db}
+}
+
+const personalTokenColumns = `id, user_id, tenant, name, hint, token_hash, scopes, created_at, expires_at, last_used_at`
+
+func (r *personalTokenRepository) Create(token entity.PersonalToken) error {
+	query :=
+		`INSERT INTO personal_access_tokens(` + personalTokenColumns + `)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULL)`
+
+	_, err := r.db.Exec(
+		query,
+		token.ID,
+		token.UserID,
+		token.Tenant,
+		token.Name,
+		token.Hint,
+		token.TokenHash,
+		strings.Join(token.Scopes, " "),
+		token.CreatedAt,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения токена доступа: %w", err)
+	}
+	return nil
+}
+
+func (r *personalTokenRepository) GetByHash(hash string) (entity.PersonalToken, error) {
+	query := `SELECT ` + personalTokenColumns + ` FROM personal_access_tokens WHERE token_hash = $1`
+
+	token, err := scanPersonalToken(r.db.QueryRow(query, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.PersonalToken{}, entity.ErrPersonalTokenNotFound
+		}
+		return entity.PersonalToken{}, fmt.Errorf("Ошибка поиска токена доступа: %w", err)
+	}
+	return token, nil
+}
+
+func (r *personalTokenRepository) GetByUser(userID int) ([]entity.PersonalToken, error) {
+	query := `SELECT ` + personalTokenColumns + ` FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска токенов доступа: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []entity.PersonalToken{}
+	for rows.Next() {
+		token, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка поиска токенов доступа: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *personalTokenRepository) Touch(id string, usedAt time.Time) error {
+	if _, err := r.db.Exec(`UPDATE personal_access_tokens SET last_used_at = $1 WHERE id = $2`, usedAt, id); err != nil {
+		return fmt.Errorf("Ошибка обновления токена доступа: %w", err)
+	}
+	return nil
+}
+
+func (r *personalTokenRepository) Delete(userID int, id string) error {
+	res, err := r.db.Exec(`DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("Ошибка удаления токена доступа: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entity.ErrPersonalTokenNotFound
+	}
+	return nil
+}
+
+func (r *personalTokenRepository) DeleteByUser(userID int) error {
+	if _, err := r.db.Exec(`DELETE FROM personal_access_tokens WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("Ошибка удаления токенов доступа: %w", err)
+	}
+	return nil
+}
+
+func (r *personalTokenRepository) DeleteExpired(now time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM personal_access_tokens WHERE expires_at <= $1`, now); err != nil {
+		return fmt.Errorf("Ошибка очистки токенов доступа: %w", err)
+	}
+	return nil
+}
+
+func scanPersonalToken(row rowScanner) (entity.PersonalToken, error) {
+	var (
+		token  entity.PersonalToken
+		scopes string
+	)
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Tenant,
+		&token.Name,
+		&token.Hint,
+		&token.TokenHash,
+		&scopes,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+	)
+	if err != nil {
+		return entity.PersonalToken{}, err
+	}
+	token.Scopes = strings.Fields(scopes)
+	return token, nil
+}
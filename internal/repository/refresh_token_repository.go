@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type refreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) entity.RefreshTokenRepository {
+	return &refreshTokenRepository{db}
+}
+
+func (r *refreshTokenRepository) Create(token entity.RefreshToken) error {
+	query :=
+		`INSERT INTO refresh_tokens(id, family_id, parent_id, user_id, token_hash, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := r.db.Exec(
+		query,
+		token.ID,
+		token.FamilyID,
+		token.ParentID,
+		token.UserID,
+		token.TokenHash,
+		token.CreatedAt,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения refresh токена: %w", err)
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) GetByID(id string) (entity.RefreshToken, error) {
+	query :=
+		`SELECT id, family_id, parent_id, user_id, token_hash, created_at, expires_at, used_at, revoked_at
+		 FROM refresh_tokens WHERE id = $1`
+
+	var token entity.RefreshToken
+	err := r.db.QueryRow(query, id).Scan(
+		&token.ID,
+		&token.FamilyID,
+		&token.ParentID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.RefreshToken{}, entity.ErrRefreshTokenNotFound
+		}
+		return entity.RefreshToken{}, fmt.Errorf("Ошибка поиска refresh токена: %w", err)
+	}
+	return token, nil
+}
+
+// MarkUsed reports false when the token had already been used, which lets two
+// concurrent refreshes with the same token be told apart.
+func (r *refreshTokenRepository) MarkUsed(id string, usedAt time.Time) (bool, error) {
+	query :=
+		`UPDATE refresh_tokens
+		 SET used_at = $1
+		 WHERE id = $2 AND used_at IS NULL`
+
+	res, err := r.db.Exec(query, usedAt, id)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка обновления refresh токена: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *refreshTokenRepository) RevokeFamily(familyID string) error {
+	query :=
+		`UPDATE refresh_tokens
+		 SET revoked_at = $1
+		 WHERE family_id = $2 AND revoked_at IS NULL`
+
+	if _, err := r.db.Exec(query, time.Now(), familyID); err != nil {
+		return fmt.Errorf("Ошибка отзыва семейства токенов: %w", err)
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) DeleteExpired(now time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at <= $1`, now); err != nil {
+		return fmt.Errorf("Ошибка очистки refresh токенов: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type revocationRepository struct {
+	db *sql.DB
+}
+
+func NewRevocationRepository(db *sql.DB) entity.RevocationRepository {
+	return &revocationRepository{db}
+}
+
+func (r *revocationRepository) Save(revocation entity.Revocation) error {
+	query :=
+		`INSERT INTO revoked_tokens(kind, value, revoked_at, expires_at)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT(kind, value) DO UPDATE
+		 SET revoked_at = excluded.revoked_at, expires_at = max(expires_at, excluded.expires_at)`
+
+	_, err := r.db.Exec(
+		query,
+		revocation.Kind,
+		revocation.Value,
+		revocation.RevokedAt,
+		revocation.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения отзыва токена: %w", err)
+	}
+	return nil
+}
+
+func (r *revocationRepository) ListActive(now time.Time) ([]entity.Revocation, error) {
+	query :=
+		`SELECT kind, value, revoked_at, expires_at
+		 FROM revoked_tokens WHERE expires_at > $1`
+
+	rows, err := r.db.Query(query, now)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка загрузки отозванных токенов: %w", err)
+	}
+	defer rows.Close()
+
+	var revocations []entity.Revocation
+	for rows.Next() {
+		var revocation entity.Revocation
+		if err := rows.Scan(
+			&revocation.Kind,
+			&revocation.Value,
+			&revocation.RevokedAt,
+			&revocation.ExpiresAt,
+		); err != nil {
+			return nil, fmt.Errorf("Ошибка загрузки отозванных токенов: %w", err)
+		}
+		revocations = append(revocations, revocation)
+	}
+	return revocations, rows.Err()
+}
+
+func (r *revocationRepository) DeleteExpired(now time.Time) (int64, error) {
+	query := `DELETE FROM revoked_tokens WHERE expires_at <= $1`
+
+	res, err := r.db.Exec(query, now)
+	if err != nil {
+		return 0, fmt.Errorf("Ошибка очистки отозванных токенов: %w", err)
+	}
+	return res.RowsAffected()
+}
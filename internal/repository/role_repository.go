@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type roleRepository struct {
+	db *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) entity.RoleRepository {
+	return &roleRepository{db}
+}
+
+func (r *roleRepository) GetAll() ([]entity.Role, error) {
+	rows, err := r.db.Query(`SELECT name, description FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска ролей: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []entity.Role{}
+	for rows.Next() {
+		var role entity.Role
+		if err := rows.Scan(&role.Name, &role.Description); err != nil {
+			return nil, fmt.Errorf("Ошибка поиска ролей: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range roles {
+		if roles[i].Permissions, err = r.permissions(roles[i].Name); err != nil {
+			return nil, err
+		}
+	}
+	return roles, nil
+}
+
+func (r *roleRepository) GetByName(name string) (entity.Role, error) {
+	var role entity.Role
+	err := r.db.QueryRow(`SELECT name, description FROM roles WHERE name = $1`, name).
+		Scan(&role.Name, &role.Description)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Role{}, entity.ErrRoleNotFound
+		}
+		return entity.Role{}, fmt.Errorf("Ошибка поиска роли: %w", err)
+	}
+
+	if role.Permissions, err = r.permissions(name); err != nil {
+		return entity.Role{}, err
+	}
+	return role, nil
+}
+
+func (r *roleRepository) Save(role entity.Role) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения роли: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO roles(name, description) VALUES ($1, $2)
+		 ON CONFLICT(name) DO UPDATE SET description = excluded.description`,
+		role.Name, role.Description,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка сохранения роли: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM role_permissions WHERE role = $1`, role.Name); err != nil {
+		return fmt.Errorf("Ошибка сохранения роли: %w", err)
+	}
+	for _, permission := range role.Permissions {
+		_, err := tx.Exec(
+			`INSERT OR IGNORE INTO role_permissions(role, permission) VALUES ($1, $2)`,
+			role.Name, permission,
+		)
+		if err != nil {
+			return fmt.Errorf("Ошибка сохранения роли: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *roleRepository) Delete(name string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Ошибка удаления роли: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM roles WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("Ошибка удаления роли: %w", err)
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return entity.ErrRoleNotFound
+	}
+
+	for _, query := range []string{
+		`DELETE FROM role_permissions WHERE role = $1`,
+		`DELETE FROM user_roles WHERE role = $1`,
+		`DELETE FROM member_roles WHERE role = $1`,
+	} {
+		if _, err := tx.Exec(query, name); err != nil {
+			return fmt.Errorf("Ошибка удаления роли: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *roleRepository) GetUserRoles(userID int) ([]string, error) {
+	rows, err := r.db.Query(`SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска ролей пользователя: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("Ошибка поиска ролей пользователя: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *roleRepository) Assign(userID int, role string) (bool, error) {
+	res, err := r.db.Exec(`INSERT OR IGNORE INTO user_roles(user_id, role) VALUES ($1, $2)`, userID, role)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка назначения роли: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *roleRepository) Unassign(userID int, role string) error {
+	if _, err := r.db.Exec(`DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userID, role); err != nil {
+		return fmt.Errorf("Ошибка снятия роли: %w", err)
+	}
+	return nil
+}
+
+func (r *roleRepository) GetMemberRoles(tenant string, userID int) ([]string, error) {
+	rows, err := r.db.Query(
+		`SELECT role FROM member_roles WHERE org_id = $1 AND user_id = $2 ORDER BY role`,
+		tenant, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска ролей пользователя: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("Ошибка поиска ролей пользователя: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *roleRepository) AssignMember(tenant string, userID int, role string) (bool, error) {
+	res, err := r.db.Exec(
+		`INSERT OR IGNORE INTO member_roles(org_id, user_id, role) VALUES ($1, $2, $3)`,
+		tenant, userID, role,
+	)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка назначения роли: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *roleRepository) UnassignMember(tenant string, userID int, role string) error {
+	_, err := r.db.Exec(
+		`DELETE FROM member_roles WHERE org_id = $1 AND user_id = $2 AND role = $3`,
+		tenant, userID, role,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка снятия роли: %w", err)
+	}
+	return nil
+}
+
+func (r *roleRepository) permissions(role string) ([]string, error) {
+	rows, err := r.db.Query(`SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission`, role)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска прав роли: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, fmt.Errorf("Ошибка поиска прав роли: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS users(
+		id integer primary key autoincrement,
+		name varchar(100),
+		password varchar(100),
+		email varchar(100)
+	)`,
+	`CREATE TABLE IF NOT EXISTS refresh_tokens(
+		id varchar(64) primary key,
+		family_id varchar(64) not null,
+		parent_id varchar(64),
+		user_id integer not null references users(id) on delete cascade,
+		token_hash varchar(64) not null,
+		created_at datetime not null,
+		expires_at datetime not null,
+		used_at datetime,
+		revoked_at datetime
+	)`,
+	`CREATE INDEX IF NOT EXISTS refresh_tokens_family ON refresh_tokens(family_id)`,
+	`CREATE INDEX IF NOT EXISTS refresh_tokens_user ON refresh_tokens(user_id)`,
+	`CREATE TABLE IF NOT EXISTS sessions(
+		id varchar(64) primary key,
+		user_id integer not null references users(id) on delete cascade,
+		device_name varchar(100) not null default '',
+		user_agent varchar(255) not null default '',
+		ip varchar(45) not null default '',
+		refresh_token_hash varchar(64) not null,
+		created_at datetime not null,
+		last_used_at datetime not null,
+		revoked_at datetime
+	)`,
+	`CREATE INDEX IF NOT EXISTS sessions_user ON sessions(user_id)`,
+	`CREATE TABLE IF NOT EXISTS revoked_tokens(
+		kind varchar(8) not null,
+		value varchar(64) not null,
+		revoked_at datetime not null,
+		expires_at datetime not null,
+		primary key (kind, value)
+	)`,
+	`CREATE TABLE IF NOT EXISTS oauth_clients(
+		id varchar(64) primary key,
+		name varchar(100) not null default '',
+		secret_hash varchar(100) not null default '',
+		created_at datetime not null
+	)`,
+	`CREATE TABLE IF NOT EXISTS authorization_codes(
+		code_hash varchar(64) primary key,
+		client_id varchar(64) not null,
+		user_id integer not null references users(id) on delete cascade,
+		redirect_uri varchar(500) not null,
+		scope varchar(500) not null default '',
+		code_challenge varchar(128) not null,
+		code_challenge_method varchar(8) not null,
+		session_id varchar(64),
+		created_at datetime not null,
+		expires_at datetime not null,
+		used_at datetime
+	)`,
+	`CREATE TABLE IF NOT EXISTS device_codes(
+		device_code_hash varchar(64) primary key,
+		user_code varchar(16) not null unique,
+		client_id varchar(64) not null,
+		scope varchar(500) not null default '',
+		status varchar(16) not null,
+		user_id integer references users(id) on delete cascade,
+		interval_seconds integer not null,
+		last_polled_at datetime,
+		decided_at datetime,
+		created_at datetime not null,
+		expires_at datetime not null,
+		used_at datetime
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_events(
+		id integer primary key autoincrement,
+		action varchar(64) not null,
+		outcome varchar(16) not null,
+		actor_id varchar(64) not null default '',
+		subject_id varchar(64) not null default '',
+		client_id varchar(64) not null default '',
+		details text not null default '',
+		ip varchar(45) not null default '',
+		created_at datetime not null
+	)`,
+	`CREATE TABLE IF NOT EXISTS roles(
+		name varchar(64) primary key,
+		description varchar(255) not null default ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS role_permissions(
+		role varchar(64) not null references roles(name) on delete cascade,
+		permission varchar(64) not null,
+		primary key (role, permission)
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_roles(
+		user_id integer not null references users(id) on delete cascade,
+		role varchar(64) not null references roles(name) on delete cascade,
+		primary key (user_id, role)
+	)`,
+	`CREATE TABLE IF NOT EXISTS organizations(
+		id varchar(64) primary key,
+		name varchar(100) not null default '',
+		created_at datetime not null
+	)`,
+	`CREATE TABLE IF NOT EXISTS memberships(
+		org_id varchar(64) not null references organizations(id) on delete cascade,
+		user_id integer not null references users(id) on delete cascade,
+		created_at datetime not null,
+		primary key (org_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS memberships_user ON memberships(user_id)`,
+	`CREATE TABLE IF NOT EXISTS member_roles(
+		org_id varchar(64) not null,
+		user_id integer not null references users(id) on delete cascade,
+		role varchar(64) not null references roles(name) on delete cascade,
+		primary key (org_id, user_id, role)
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_totp(
+		user_id integer primary key references users(id) on delete cascade,
+		secret varchar(64) not null,
+		last_step integer not null default 0,
+		created_at datetime not null,
+		confirmed_at datetime
+	)`,
+	`CREATE TABLE IF NOT EXISTS recovery_codes(
+		user_id integer not null references users(id) on delete cascade,
+		code_hash varchar(64) not null,
+		used_at datetime,
+		primary key (user_id, code_hash)
+	)`,
+	`CREATE TABLE IF NOT EXISTS webauthn_credentials(
+		id varchar(1400) primary key,
+		user_id integer not null references users(id) on delete cascade,
+		name varchar(100) not null,
+		public_key blob not null,
+		sign_count integer not null default 0,
+		aaguid varchar(36) not null,
+		transports varchar(200) not null default '',
+		attestation varchar(32) not null,
+		created_at datetime not null,
+		last_used_at datetime
+	)`,
+	`CREATE INDEX IF NOT EXISTS webauthn_credentials_user ON webauthn_credentials(user_id)`,
+	`CREATE TABLE IF NOT EXISTS webauthn_challenges(
+		challenge varchar(64) primary key,
+		ceremony varchar(16) not null,
+		tenant varchar(64) not null,
+		user_id integer,
+		created_at datetime not null,
+		expires_at datetime not null
+	)`,
+	`CREATE TABLE IF NOT EXISTS password_resets(
+		token_hash varchar(64) primary key,
+		user_id integer not null references users(id) on delete cascade,
+		tenant varchar(64) not null,
+		created_at datetime not null,
+		expires_at datetime not null,
+		used_at datetime
+	)`,
+	`CREATE INDEX IF NOT EXISTS password_resets_user ON password_resets(user_id)`,
+	`CREATE TABLE IF NOT EXISTS login_codes(
+		token_hash varchar(64) primary key,
+		binding_hash varchar(64) not null unique,
+		code_hash varchar(64) not null,
+		user_id integer not null references users(id) on delete cascade,
+		tenant varchar(64) not null,
+		email varchar(255) not null,
+		attempts integer not null default 0,
+		created_at datetime not null,
+		expires_at datetime not null,
+		used_at datetime
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_identities(
+		provider varchar(64) not null,
+		subject varchar(255) not null,
+		user_id integer not null references users(id) on delete cascade,
+		email varchar(255) not null default '',
+		created_at datetime not null,
+		last_login_at datetime,
+		primary key (provider, subject, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS user_identities_user ON user_identities(user_id)`,
+	`CREATE TABLE IF NOT EXISTS federation_states(
+		state_hash varchar(64) primary key,
+		provider varchar(64) not null,
+		tenant varchar(64) not null,
+		nonce varchar(64) not null,
+		verifier varchar(128) not null,
+		created_at datetime not null,
+		expires_at datetime not null
+	)`,
+	`CREATE TABLE IF NOT EXISTS saml_assertions(
+		issuer varchar(255) not null,
+		assertion_id varchar(255) not null,
+		expires_at datetime not null,
+		primary key (issuer, assertion_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS personal_access_tokens(
+		id varchar(64) primary key,
+		user_id integer not null references users(id) on delete cascade,
+		tenant varchar(64) not null,
+		name varchar(100) not null,
+		hint varchar(32) not null,
+		token_hash varchar(64) not null unique,
+		scopes varchar(500) not null default '',
+		created_at datetime not null,
+		expires_at datetime not null,
+		last_used_at datetime
+	)`,
+	`CREATE INDEX IF NOT EXISTS personal_access_tokens_user ON personal_access_tokens(user_id)`,
+	`CREATE TABLE IF NOT EXISTS api_keys(
+		id varchar(64) primary key,
+		name varchar(100) not null,
+		tenant varchar(64) not null,
+		hint varchar(32) not null,
+		key_hash varchar(64) not null unique,
+		scopes text not null default '[]',
+		allowed_ips text not null default '[]',
+		quota_limit integer not null default 0,
+		quota_period varchar(16) not null default '',
+		total_requests integer not null default 0,
+		window_start datetime,
+		window_count integer not null default 0,
+		last_used_at datetime,
+		last_used_ip varchar(64) not null default '',
+		created_at datetime not null,
+		rotated_at datetime,
+		expires_at datetime,
+		revoked_at datetime
+	)`,
+}
+
+// columns are added to tables created by an earlier version of the schema.
+var columns = []struct {
+	table  string
+	column string
+	ddl    string
+}{
+	{"oauth_clients", "redirect_uris", `redirect_uris text not null default '[]'`},
+	{"oauth_clients", "public", `public boolean not null default false`},
+	{"sessions", "client_id", `client_id varchar(64) not null default ''`},
+	{"sessions", "scope", `scope varchar(500) not null default ''`},
+	{"oauth_clients", "scopes", `scopes text not null default '[]'`},
+	{"oauth_clients", "grant_types", `grant_types text not null default '[]'`},
+	{"oauth_clients", "disabled_at", `disabled_at datetime`},
+	{"sessions", "auth_time", `auth_time datetime`},
+	{"authorization_codes", "nonce", `nonce varchar(255) not null default ''`},
+	{"authorization_codes", "auth_time", `auth_time datetime`},
+	{"sessions", "tenant", `tenant varchar(64) not null default 'default'`},
+	{"authorization_codes", "tenant", `tenant varchar(64) not null default 'default'`},
+	{"device_codes", "tenant", `tenant varchar(64) not null default 'default'`},
+	// Accounts created before verification existed count as verified
+	{"users", "email_verified", `email_verified boolean not null default 1`},
+}
+
+// backfill moves users from before organizations into the default tenant.
+// A user is deleted along with its last membership, so running it again
+// finds no one. $1 is the default tenant.
+var backfill = []string{
+	`INSERT OR IGNORE INTO organizations(id, name, created_at) VALUES ($1, 'Default', $2)`,
+	`INSERT INTO memberships(org_id, user_id, created_at)
+	 SELECT $1, id, $2 FROM users WHERE id NOT IN (SELECT user_id FROM memberships)`,
+}
+
+// Migrate creates the tables the repositories rely on.
+func Migrate(db *sql.DB) error {
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("Ошибка миграции: %w", err)
+		}
+	}
+
+	for _, col := range columns {
+		exists, err := hasColumn(db, col.table, col.column)
+		if err != nil {
+			return fmt.Errorf("Ошибка миграции: %w", err)
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", col.table, col.ddl)); err != nil {
+			return fmt.Errorf("Ошибка миграции: %w", err)
+		}
+	}
+
+	now := time.Now()
+	for _, statement := range backfill {
+		if _, err := db.Exec(statement, entity.DefaultTenant, now); err != nil {
+			return fmt.Errorf("Ошибка миграции: %w", err)
+		}
+	}
+	return nil
+}
+
+func hasColumn(db *sql.DB, table string, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name, kind   string
+			notNull, pk  int
+			defaultValue sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
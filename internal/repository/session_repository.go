@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"JWT/internal/entity"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) entity.SessionRepository {
+	return &sessionRepository{db}
+}
+
+func (s *sessionRepository) Create(session entity.Session) error {
+	query :=
+		`INSERT INTO sessions(id, user_id, tenant, device_name, user_agent, ip, client_id, scope, refresh_token_hash, created_at, last_used_at, auth_time)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	_, err := s.db.Exec(
+		query,
+		session.ID,
+		session.UserID,
+		session.Tenant,
+		session.DeviceName,
+		session.UserAgent,
+		session.IP,
+		session.ClientID,
+		session.Scope,
+		session.RefreshTokenHash,
+		session.CreatedAt,
+		session.LastUsedAt,
+		session.AuthTime,
+	)
+	if err != nil {
+		return fmt.Errorf("Ошибка создания сессии: %w", err)
+	}
+	return nil
+}
+
+func (s *sessionRepository) GetByID(id string) (entity.Session, error) {
+	query :=
+		`SELECT id, user_id, tenant, device_name, user_agent, ip, client_id, scope, refresh_token_hash, created_at, last_used_at, revoked_at, auth_time
+		 FROM sessions WHERE id = $1`
+
+	session, err := scanSession(s.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Session{}, entity.ErrSessionNotFound
+		}
+		return entity.Session{}, fmt.Errorf("Ошибка поиска сессии: %w", err)
+	}
+	return session, nil
+}
+
+func (s *sessionRepository) ListActive(userID int, now time.Time) ([]entity.Session, error) {
+	query :=
+		`SELECT id, user_id, tenant, device_name, user_agent, ip, client_id, scope, refresh_token_hash, created_at, last_used_at, revoked_at, auth_time
+		 FROM sessions
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		   AND EXISTS (
+		       SELECT 1 FROM refresh_tokens t
+		       WHERE t.family_id = sessions.id AND t.token_hash = sessions.refresh_token_hash AND t.expires_at > $2
+		   )
+		 ORDER BY last_used_at DESC`
+
+	rows, err := s.db.Query(query, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка поиска сессий: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []entity.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка поиска сессий: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sessionRepository) Touch(id string, refreshTokenHash string, usedAt time.Time) error {
+	query :=
+		`UPDATE sessions
+		 SET refresh_token_hash = $1, last_used_at = $2
+		 WHERE id = $3`
+
+	if _, err := s.db.Exec(query, refreshTokenHash, usedAt, id); err != nil {
+		return fmt.Errorf("Ошибка обновления сессии: %w", err)
+	}
+	return nil
+}
+
+func (s *sessionRepository) Revoke(id string) error {
+	query :=
+		`UPDATE sessions
+		 SET revoked_at = $1
+		 WHERE id = $2 AND revoked_at IS NULL`
+
+	if _, err := s.db.Exec(query, time.Now(), id); err != nil {
+		return fmt.Errorf("Ошибка завершения сессии: %w", err)
+	}
+	return nil
+}
+
+func (s *sessionRepository) RevokeAll(userID int) error {
+	query :=
+		`UPDATE sessions
+		 SET revoked_at = $1
+		 WHERE user_id = $2 AND revoked_at IS NULL`
+
+	if _, err := s.db.Exec(query, time.Now(), userID); err != nil {
+		return fmt.Errorf("Ошибка завершения сессий: %w", err)
+	}
+	return nil
+}
+
+func (s *sessionRepository) DeleteExpired(now time.Time) error {
+	query :=
+		`DELETE FROM sessions
+		 WHERE NOT EXISTS (
+		     SELECT 1 FROM refresh_tokens t WHERE t.family_id = sessions.id AND t.expires_at > $1
+		 )`
+
+	if _, err := s.db.Exec(query, now); err != nil {
+		return fmt.Errorf("Ошибка очистки сессий: %w", err)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (entity.Session, error) {
+	var (
+		session  entity.Session
+		authTime sql.NullTime
+	)
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Tenant,
+		&session.DeviceName,
+		&session.UserAgent,
+		&session.IP,
+		&session.ClientID,
+		&session.Scope,
+		&session.RefreshTokenHash,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.RevokedAt,
+		&authTime,
+	)
+	// Sessions created before auth_time was recorded started with a login
+	session.AuthTime = session.CreatedAt
+	if authTime.Valid {
+		session.AuthTime = authTime.Time
+	}
+	return session, err
+}
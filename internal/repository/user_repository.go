@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
 type userRepository struct {
@@ -15,17 +16,21 @@ func NewUserRepository(db *sql.DB) entity.UserRepository {
 	return &userRepository{db}
 }
 
-func (u *userRepository) GetAll() ([]entity.User, error) {
-	query := `SELECT * FROM users`
-	users, err := u.db.Query(query)
+// Every query joins memberships: a user outside the tenant does not exist for it.
+const tenantUsers = `users u JOIN memberships m ON m.user_id = u.id AND m.org_id = $1`
+
+func (u *userRepository) GetAll(tenant string) ([]entity.User, error) {
+	query := `SELECT u.id, u.password, u.email, u.name, u.email_verified FROM ` + tenantUsers + ` ORDER BY u.id`
+	users, err := u.db.Query(query, tenant)
 	if err != nil {
 		return nil, fmt.Errorf("Users: %w", entity.ErrSearchUsers)
 	}
+	defer users.Close()
 
 	var searchUsers []entity.User
 	for users.Next() {
 		var user entity.User
-		if err := users.Scan(&user.ID, &user.Password, &user.Email, &user.Name); err != nil {
+		if err := users.Scan(&user.ID, &user.Password, &user.Email, &user.Name, &user.EmailVerified); err != nil {
 			return nil, fmt.Errorf("Users: %w", entity.NotFoundUser)
 		}
 		searchUsers = append(searchUsers, user)
@@ -33,27 +38,27 @@ func (u *userRepository) GetAll() ([]entity.User, error) {
 	return searchUsers, nil
 }
 
-func (u *userRepository) GetByID(id int) (entity.User, error) {
-	query := `SELECT * FROM users WHERE id = $1`
-	searchUser := u.db.QueryRow(query, id)
+func (u *userRepository) GetByID(tenant string, id int) (entity.User, error) {
+	query := `SELECT u.id, u.password, u.email, u.name, u.email_verified FROM ` + tenantUsers + ` WHERE u.id = $2`
+	searchUser := u.db.QueryRow(query, tenant, id)
 
 	var user entity.User
-	if err := searchUser.Scan(&user.ID, &user.Password, &user.Email, &user.Name); err != nil {
+	if err := searchUser.Scan(&user.ID, &user.Password, &user.Email, &user.Name, &user.EmailVerified); err != nil {
 		return entity.User{}, entity.NotFoundUser
 	}
 	return user, nil
 }
 
-func (u *userRepository) GetByEmail(email string) (entity.User, error) {
-	query := `SELECT id, password, email, name, refresh_token FROM users WHERE email = $1`
+func (u *userRepository) GetByEmail(tenant string, email string) (entity.User, error) {
+	query := `SELECT u.id, u.password, u.email, u.name, u.email_verified FROM ` + tenantUsers + ` WHERE u.email = $2`
 
 	var user entity.User
-	err := u.db.QueryRow(query, email).Scan(
+	err := u.db.QueryRow(query, tenant, email).Scan(
 		&user.ID,
 		&user.Password,
 		&user.Email,
 		&user.Name,
-		&user.RefreshToken,
+		&user.EmailVerified,
 	)
 
 	if err != nil {
@@ -65,75 +70,159 @@ func (u *userRepository) GetByEmail(email string) (entity.User, error) {
 	return user, nil
 }
 
-func (u *userRepository) Delete(id int) error {
-	query := `DELETE FROM users WHERE id = $1`
-	res, err := u.db.Exec(query, id)
+func (u *userRepository) Delete(tenant string, id int) error {
+	tx, err := u.db.Begin()
 	if err != nil {
 		return fmt.Errorf("User: %w", entity.ErrDeleteUser)
 	}
+	defer tx.Rollback()
 
-	affected, err := res.RowsAffected()
+	removed, err := removeMembership(tx, tenant, id)
 	if err != nil {
-		return err
+		return fmt.Errorf("User: %w", entity.ErrDeleteUser)
 	}
-	if affected == 0 {
-		return fmt.Errorf("Users: %w %w", entity.ErrDeleteUser, "затронуто 0 строк")
+	if !removed {
+		return fmt.Errorf("Users: %w: затронуто 0 строк", entity.ErrDeleteUser)
 	}
-	return nil
+	return tx.Commit()
 }
 
-func (u *userRepository) Create(user entity.User) (entity.User, error) {
+// removeMembership takes the user out of the tenant with whatever lets it
+// back in there: roles, sessions, tokens and codes. The user itself goes
+// with its last membership. It reports false if the user was not a member.
+func removeMembership(tx *sql.Tx, tenant string, userID int) (bool, error) {
+	res, err := tx.Exec(`DELETE FROM memberships WHERE org_id = $1 AND user_id = $2`, tenant, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+	// The user stays, so nothing cascades from it
+	for _, query := range []string{
+		`DELETE FROM member_roles WHERE org_id = $1 AND user_id = $2`,
+		`DELETE FROM refresh_tokens WHERE family_id IN (SELECT id FROM sessions WHERE tenant = $1 AND user_id = $2)`,
+		`DELETE FROM sessions WHERE tenant = $1 AND user_id = $2`,
+		`DELETE FROM authorization_codes WHERE tenant = $1 AND user_id = $2`,
+		`DELETE FROM device_codes WHERE tenant = $1 AND user_id = $2`,
+		`DELETE FROM password_resets WHERE tenant = $1 AND user_id = $2`,
+		`DELETE FROM login_codes WHERE tenant = $1 AND user_id = $2`,
+		`DELETE FROM personal_access_tokens WHERE tenant = $1 AND user_id = $2`,
+		`DELETE FROM webauthn_challenges WHERE tenant = $1 AND user_id = $2`,
+	} {
+		if _, err := tx.Exec(query, tenant, userID); err != nil {
+			return false, err
+		}
+	}
+
+	// A user in no tenant could not sign in anywhere, and would be moved
+	// into the default tenant by the next migration
+	var remaining int
+	if err := tx.QueryRow(`SELECT count(*) FROM memberships WHERE user_id = $1`, userID).Scan(&remaining); err != nil {
+		return false, err
+	}
+	if remaining > 0 {
+		return true, nil
+	}
+	// Its roles, factors, identities, codes and tokens go with it
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (u *userRepository) Create(tenant string, user entity.User) (entity.User, error) {
 	query :=
-		`INSERT INTO users(name, password, email)
-         VALUES ($1, $2, $3)
-         RETURNING id, name, password, email`
+		`INSERT INTO users(name, password, email, email_verified)
+         VALUES ($1, $2, $3, $4)
+         RETURNING id, name, password, email, email_verified`
 
 	if err := user.HashPassword(); err != nil {
 		return entity.User{}, err
 	}
-	if _, err := u.GetByEmail(user.Email); err != nil {
-		if !errors.Is(err, entity.NotFoundUser) {
-			return entity.User{}, entity.ErrUserAlreadyRegistered
-		}
+	if _, err := u.GetByEmail(tenant, user.Email); err == nil {
+		return entity.User{}, entity.ErrUserAlreadyRegistered
+	} else if !errors.Is(err, entity.NotFoundUser) {
+		return entity.User{}, err
+	}
+
+	tx, err := u.db.Begin()
+	if err != nil {
+		return entity.User{}, entity.ErrCreateUser
 	}
+	defer tx.Rollback()
 
 	var createUser entity.User
-	err := u.db.QueryRow(
+	err = tx.QueryRow(
 		query,
 		user.Name,
 		user.Password,
 		user.Email,
+		user.EmailVerified,
 	).Scan(
 		&createUser.ID,
 		&createUser.Name,
 		&createUser.Password,
 		&createUser.Email,
+		&createUser.EmailVerified,
+	)
+	if err != nil {
+		return entity.User{}, entity.ErrCreateUser
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO memberships(org_id, user_id, created_at) VALUES ($1, $2, $3)`,
+		tenant, createUser.ID, time.Now(),
 	)
 	if err != nil {
-		fmt.Println("-------------->", "Create Error")
+		return entity.User{}, entity.ErrCreateUser
+	}
+	if err := tx.Commit(); err != nil {
 		return entity.User{}, entity.ErrCreateUser
 	}
 
 	return createUser, nil
 }
 
-func (u *userRepository) Login(user entity.User, refresh string) error {
-	query :=
-		`UPDATE users
-		 SET refresh_token = $1
-		 WHERE id = $2;`
+func (u *userRepository) VerifyEmail(id int, email string) (bool, error) {
+	res, err := u.db.Exec(`UPDATE users SET email_verified = 1 WHERE id = $1 AND email = $2`, id, email)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка подтверждения email: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
 
-	res, err := u.db.Exec(query, refresh, user.ID)
+func (u *userRepository) UpdatePassword(id int, password string) error {
+	res, err := u.db.Exec(`UPDATE users SET password = $1 WHERE id = $2`, password, id)
 	if err != nil {
-		return fmt.Errorf("Ошибка обновления refresh токена: %w", err.Error())
+		return fmt.Errorf("Ошибка смены пароля: %w", err)
 	}
-	resAffected, err := res.RowsAffected()
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return entity.NotFoundUser
+	}
+	return nil
+}
 
-	if resAffected == 0 {
-		return fmt.Errorf("пользователь с ID %d не найден", user.ID)
+func (u *userRepository) UpdateName(id int, name string) error {
+	res, err := u.db.Exec(`UPDATE users SET name = $1 WHERE id = $2`, name, id)
+	if err != nil {
+		return fmt.Errorf("Ошибка изменения пользователя: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return entity.NotFoundUser
 	}
 	return nil
 }
@@ -0,0 +1,273 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APIKeyPrefix starts every API key, so that secret scanners can tell them
+// from other strings.
+const APIKeyPrefix = "jwtak_"
+
+var quotaPeriods = map[string]time.Duration{
+	entity.QuotaPerMinute: time.Minute,
+	entity.QuotaPerHour:   time.Hour,
+	entity.QuotaPerDay:    24 * time.Hour,
+}
+
+var (
+	ErrInvalidAPIKey       = errors.New("Невалидный, отозванный или просроченный API ключ")
+	ErrAPIKeyIPNotAllowed  = errors.New("API ключ не разрешен с этого адреса")
+	ErrAPIKeyQuotaExceeded = errors.New("Превышена квота запросов API ключа")
+	ErrAPIKeyName          = errors.New("Не указано название API ключа")
+	ErrInvalidAllowedIP    = errors.New("Неверный адрес или подсеть в списке разрешенных")
+	ErrInvalidQuota        = errors.New("Квота должна быть неотрицательной, с периодом minute, hour или day")
+	ErrAPIKeyExpiry        = errors.New("Срок действия API ключа уже истек")
+)
+
+// APIKeyUseCase manages the keys partner integrations call the API with, and
+// checks them on every request.
+type APIKeyUseCase struct {
+	repo          entity.APIKeyRepository
+	organizations *OrganizationUseCase
+	issuer        string
+}
+
+func NewAPIKeyUseCase(repo entity.APIKeyRepository, organizations *OrganizationUseCase, issuer string) *APIKeyUseCase {
+	return &APIKeyUseCase{repo, organizations, issuer}
+}
+
+// QuotaState is what is left of the quota of a key after a request. Limit is
+// zero for keys without one.
+type QuotaState struct {
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+func (a *APIKeyUseCase) List() ([]entity.APIKey, error) {
+	return a.repo.GetAll()
+}
+
+func (a *APIKeyUseCase) Get(id string) (entity.APIKey, error) {
+	return a.repo.GetByID(id)
+}
+
+// Create stores a new key with a generated ID and returns the key itself,
+// which cannot be recovered later. No tenant means the default one.
+func (a *APIKeyUseCase) Create(key entity.APIKey) (entity.APIKey, string, error) {
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" {
+		return entity.APIKey{}, "", ErrAPIKeyName
+	}
+	tenant, err := a.organizations.Resolve(key.Tenant)
+	if err != nil {
+		return entity.APIKey{}, "", err
+	}
+	key.Tenant = tenant
+	allowed, err := normalizeAllowedIPs(key.AllowedIPs)
+	if err != nil {
+		return entity.APIKey{}, "", err
+	}
+	key.AllowedIPs = allowed
+	if key.Quota.Limit < 0 {
+		return entity.APIKey{}, "", ErrInvalidQuota
+	}
+	if key.Quota.Limit == 0 {
+		key.Quota.Period = ""
+	} else if _, ok := quotaPeriods[key.Quota.Period]; !ok {
+		return entity.APIKey{}, "", ErrInvalidQuota
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return entity.APIKey{}, "", ErrAPIKeyExpiry
+	}
+
+	var scopes []string
+	for _, scope := range key.Scopes {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	key.Scopes = scopes
+	key.ID = auth.RandomString(12)
+	key.CreatedAt = now
+	key.RotatedAt = nil
+	key.RevokedAt = nil
+	key.Usage = entity.APIKeyUsage{}
+
+	secret := setAPIKeySecret(&key)
+	if err := a.repo.Save(key); err != nil {
+		return entity.APIKey{}, "", err
+	}
+	created, err := a.repo.GetByID(key.ID)
+	if err != nil {
+		return entity.APIKey{}, "", err
+	}
+	return created, secret, nil
+}
+
+// Rotate replaces the key. The old one stops working at once; the settings
+// and the usage of the key stay.
+func (a *APIKeyUseCase) Rotate(id string) (entity.APIKey, string, error) {
+	key, err := a.repo.GetByID(id)
+	if err != nil {
+		return entity.APIKey{}, "", err
+	}
+	if key.RevokedAt != nil {
+		return entity.APIKey{}, "", entity.ErrAPIKeyRevoked
+	}
+
+	now := time.Now()
+	key.RotatedAt = &now
+	secret := setAPIKeySecret(&key)
+	if err := a.repo.Save(key); err != nil {
+		return entity.APIKey{}, "", err
+	}
+	return key, secret, nil
+}
+
+// Revoke stops the key for good. It is kept with its usage.
+func (a *APIKeyUseCase) Revoke(id string) error {
+	key, err := a.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return a.repo.Save(key)
+}
+
+// IsAPIKey tells the keys apart from other credentials.
+func IsAPIKey(secret string) bool {
+	return strings.HasPrefix(secret, APIKeyPrefix)
+}
+
+// Authenticate checks a key used from ip and counts the request against its
+// quota. The claims are those of a client acting on its own behalf, limited
+// to the scopes of the key. The state of the quota is returned with
+// ErrAPIKeyQuotaExceeded as well.
+func (a *APIKeyUseCase) Authenticate(secret string, ip string) (*auth.Claims, QuotaState, error) {
+	if !IsAPIKey(secret) {
+		return nil, QuotaState{}, ErrInvalidAPIKey
+	}
+	key, err := a.repo.GetByHash(auth.HashToken(secret))
+	if err != nil {
+		if errors.Is(err, entity.ErrAPIKeyNotFound) {
+			return nil, QuotaState{}, ErrInvalidAPIKey
+		}
+		return nil, QuotaState{}, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, QuotaState{}, ErrInvalidAPIKey
+	}
+	if !ipAllowed(key.AllowedIPs, ip) {
+		return nil, QuotaState{}, ErrAPIKeyIPNotAllowed
+	}
+
+	// Quota windows are fixed, so that every instance counts in the same one.
+	// Keys without a quota count their requests by day.
+	var state QuotaState
+	windowStart := now.UTC().Truncate(24 * time.Hour)
+	if period, ok := quotaPeriods[key.Quota.Period]; ok && key.Quota.Limit > 0 {
+		windowStart = now.UTC().Truncate(period)
+		state = QuotaState{Limit: key.Quota.Limit, ResetAt: windowStart.Add(period)}
+	}
+	count, ok, err := a.repo.Consume(key.ID, windowStart, now, ip)
+	if err != nil {
+		return nil, QuotaState{}, err
+	}
+	if !ok {
+		return nil, state, ErrAPIKeyQuotaExceeded
+	}
+	if state.Limit > 0 {
+		state.Remaining = max(state.Limit-count, 0)
+	}
+
+	issuedAt := key.CreatedAt
+	if key.RotatedAt != nil {
+		issuedAt = *key.RotatedAt
+	}
+	claims := &auth.Claims{
+		TokenUse:  auth.TokenUseAPIKey,
+		Scope:     strings.Join(key.Scopes, " "),
+		ClientID:  key.ID,
+		GrantType: auth.GrantTypeClientCredentials,
+		Tenant:    key.Tenant,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       key.ID,
+			Issuer:   a.issuer,
+			Subject:  key.ID,
+			IssuedAt: jwt.NewNumericDate(issuedAt),
+		},
+	}
+	if key.ExpiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*key.ExpiresAt)
+	}
+	return claims, state, nil
+}
+
+func setAPIKeySecret(key *entity.APIKey) string {
+	secret := APIKeyPrefix + auth.RandomString(32)
+	key.KeyHash = auth.HashToken(secret)
+	key.Hint = secret[:len(APIKeyPrefix)+4]
+	return secret
+}
+
+// normalizeAllowedIPs checks the addresses and ranges and writes them the
+// way they are compared.
+func normalizeAllowedIPs(allowed []string) ([]string, error) {
+	normalized := []string{}
+	for _, entry := range allowed {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, ErrInvalidAllowedIP
+			}
+			entry = prefix.Masked().String()
+		} else {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, ErrInvalidAllowedIP
+			}
+			entry = addr.Unmap().String()
+		}
+		if !slices.Contains(normalized, entry) {
+			normalized = append(normalized, entry)
+		}
+	}
+	return normalized, nil
+}
+
+func ipAllowed(allowed []string, ip string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, entry := range allowed {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+		} else if other, err := netip.ParseAddr(entry); err == nil && other == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"time"
+)
+
+const defaultAuditLimit = 100
+
+type AuditUseCase struct {
+	repo entity.AuditRepository
+}
+
+func NewAuditUseCase(repo entity.AuditRepository) *AuditUseCase {
+	return &AuditUseCase{repo}
+}
+
+// Record writes the event to the audit trail.
+func (a *AuditUseCase) Record(event entity.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	return a.repo.Create(event)
+}
+
+func (a *AuditUseCase) List(limit int) ([]entity.AuditEvent, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = defaultAuditLimit
+	}
+	return a.repo.List(limit)
+}
@@ -0,0 +1,327 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Notifier delivers security events, e.g. security.AdvancedProtection.
+type Notifier interface {
+	Notify(message string)
+}
+
+var (
+	ErrInvalidAccessToken = errors.New("Невалидный токен")
+	ErrAccessTokenRevoked = errors.New("Токен отозван")
+	ErrForeignToken       = errors.New("Токен выдан другому клиенту")
+)
+
+type AuthUseCase struct {
+	users       entity.UserRepository
+	tokens      entity.RefreshTokenRepository
+	sessions    entity.SessionRepository
+	revocations *RevocationUseCase
+	roles       *RoleUseCase
+	signer      auth.Signer
+	notifier    Notifier
+	issuer      string
+	// verification decides whether unverified users get a session.
+	verification EmailVerificationMode
+}
+
+func NewAuthUseCase(
+	users entity.UserRepository,
+	tokens entity.RefreshTokenRepository,
+	sessions entity.SessionRepository,
+	revocations *RevocationUseCase,
+	roles *RoleUseCase,
+	signer auth.Signer,
+	notifier Notifier,
+	issuer string,
+	verification EmailVerificationMode,
+) *AuthUseCase {
+	return &AuthUseCase{users, tokens, sessions, revocations, roles, signer, notifier, issuer, verification}
+}
+
+// issuerFor is the issuer of the tenant's tokens, which differs from the
+// service's for tenants with signing keys of their own.
+func (a *AuthUseCase) issuerFor(tenant string) string {
+	if signer, ok := a.signer.(*auth.TenantSigner); ok {
+		return signer.Issuer(a.issuer, tenant)
+	}
+	return a.issuer
+}
+
+// ValidateAccessToken checks the signature, expiry, token use and revocation
+// state of an access token.
+func (a *AuthUseCase) ValidateAccessToken(tokenString string) (*auth.Claims, error) {
+	claims := &auth.Claims{}
+	token, err := a.signer.Parse(tokenString, claims)
+	if err != nil || !token.Valid || claims.TokenUse != auth.TokenUseAccess {
+		return nil, ErrInvalidAccessToken
+	}
+	if a.revocations.IsRevoked(claims) {
+		return nil, ErrAccessTokenRevoked
+	}
+	return claims, nil
+}
+
+// IssueTokens opens a new session on the device, which starts a new refresh
+// token family.
+func (a *AuthUseCase) IssueTokens(user entity.User, device entity.Device, grant entity.Grant) (auth.TokenResponse, error) {
+	tokens, _, err := a.startSession(user, device, grant)
+	return tokens, err
+}
+
+// CheckEmailVerified refuses unverified users when verification blocks logins.
+func (a *AuthUseCase) CheckEmailVerified(user entity.User) error {
+	if a.verification == EmailVerificationBlock && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+func (a *AuthUseCase) startSession(user entity.User, device entity.Device, grant entity.Grant) (auth.TokenResponse, entity.Session, error) {
+	if err := a.CheckEmailVerified(user); err != nil {
+		return auth.TokenResponse{}, entity.Session{}, err
+	}
+	now := time.Now()
+	authTime := grant.AuthTime
+	if authTime.IsZero() {
+		authTime = now
+	}
+	session := entity.Session{
+		ID:         auth.RandomString(16),
+		UserID:     user.ID,
+		Tenant:     grant.Tenant,
+		DeviceName: device.Name,
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		ClientID:   grant.ClientID,
+		Scope:      grant.Scope,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		AuthTime:   authTime,
+	}
+
+	tokens, hash, err := a.issue(user, session, nil, grant.Nonce)
+	if err != nil {
+		return auth.TokenResponse{}, entity.Session{}, err
+	}
+
+	session.RefreshTokenHash = hash
+	if err := a.sessions.Create(session); err != nil {
+		return auth.TokenResponse{}, entity.Session{}, err
+	}
+	return tokens, session, nil
+}
+
+// IssueClientToken signs an access token for the client itself. There is no
+// session and no refresh token: the client simply asks for a new one.
+func (a *AuthUseCase) IssueClientToken(client entity.Client, scope string) (auth.TokenResponse, error) {
+	now := time.Now()
+	expireAt := now.Add(AccessTokenTTL)
+
+	accessToken, err := a.signer.Sign(&auth.Claims{
+		TokenUse:  auth.TokenUseAccess,
+		Scope:     scope,
+		ClientID:  client.ID,
+		GrantType: auth.GrantTypeClientCredentials,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        auth.RandomString(16),
+			Issuer:    a.issuer,
+			Subject:   client.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expireAt),
+		},
+	})
+	if err != nil {
+		return auth.TokenResponse{}, fmt.Errorf("Ошибка генерации access токена: %w", err)
+	}
+	return auth.TokenResponse{AccessToken: accessToken, ExpiresAt: expireAt.Unix()}, nil
+}
+
+// Refresh exchanges a refresh token for a new pair and invalidates the old one.
+// Presenting a token that has already been exchanged revokes its whole family:
+// either the legitimate client or an attacker holds a stolen copy.
+// clientID is empty for first-party sessions.
+func (a *AuthUseCase) Refresh(refreshToken string, clientID string) (auth.TokenResponse, error) {
+	_, stored, session, err := a.validateRefreshToken(refreshToken)
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+	if session.ClientID != clientID {
+		return auth.TokenResponse{}, entity.ErrInvalidRefreshToken
+	}
+
+	fresh := stored.UsedAt == nil
+	if fresh {
+		if fresh, err = a.tokens.MarkUsed(stored.ID, time.Now()); err != nil {
+			return auth.TokenResponse{}, err
+		}
+	}
+	if !fresh {
+		if err := a.endSession(session.ID); err != nil {
+			return auth.TokenResponse{}, err
+		}
+		a.notifier.Notify(fmt.Sprintf(
+			"Refresh token reuse detected for user %d, token family %s revoked",
+			stored.UserID, stored.FamilyID,
+		))
+		return auth.TokenResponse{}, entity.ErrRefreshTokenReused
+	}
+
+	user, err := a.users.GetByID(session.Tenant, stored.UserID)
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+
+	tokens, hash, err := a.issue(user, session, &stored.ID, "")
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+	if err := a.sessions.Touch(session.ID, hash, time.Now()); err != nil {
+		return auth.TokenResponse{}, err
+	}
+	return tokens, nil
+}
+
+// validateRefreshToken checks the refresh token against its stored record and
+// session. A token that has already been exchanged is still returned: whether
+// that is reuse is up to the caller.
+func (a *AuthUseCase) validateRefreshToken(refreshToken string) (*auth.Claims, entity.RefreshToken, entity.Session, error) {
+	claims := &auth.Claims{}
+	token, err := a.signer.Parse(refreshToken, claims)
+	if err != nil || !token.Valid || claims.TokenUse != auth.TokenUseRefresh {
+		return nil, entity.RefreshToken{}, entity.Session{}, entity.ErrInvalidRefreshToken
+	}
+
+	stored, err := a.tokens.GetByID(claims.ID)
+	if err != nil {
+		if errors.Is(err, entity.ErrRefreshTokenNotFound) {
+			return nil, entity.RefreshToken{}, entity.Session{}, entity.ErrInvalidRefreshToken
+		}
+		return nil, entity.RefreshToken{}, entity.Session{}, err
+	}
+	if stored.TokenHash != auth.HashToken(refreshToken) {
+		return nil, entity.RefreshToken{}, entity.Session{}, entity.ErrInvalidRefreshToken
+	}
+	if stored.RevokedAt != nil {
+		return nil, entity.RefreshToken{}, entity.Session{}, entity.ErrRefreshTokenRevoked
+	}
+
+	session, err := a.sessions.GetByID(stored.FamilyID)
+	if err != nil {
+		return nil, entity.RefreshToken{}, entity.Session{}, err
+	}
+	if session.RevokedAt != nil {
+		return nil, entity.RefreshToken{}, entity.Session{}, entity.ErrSessionRevoked
+	}
+	return claims, stored, session, nil
+}
+
+// endSession revokes the session together with its refresh and access tokens.
+func (a *AuthUseCase) endSession(sessionID string) error {
+	if err := a.tokens.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+	if err := a.sessions.Revoke(sessionID); err != nil {
+		return err
+	}
+	return a.revocations.RevokeSession(sessionID)
+}
+
+// issue signs an access/refresh pair for the session and records the refresh
+// token. Sessions granted the openid scope also get an ID token. It returns
+// the hash of the refresh token for the session row.
+func (a *AuthUseCase) issue(user entity.User, session entity.Session, parentID *string, nonce string) (auth.TokenResponse, string, error) {
+	now := time.Now()
+	accessExpireAt := now.Add(AccessTokenTTL)
+	refreshExpireAt := now.Add(RefreshTokenTTL)
+	subject := strconv.Itoa(user.ID)
+
+	roles, err := a.roles.rolesFor(session.Tenant, user)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+
+	accessToken, err := a.signer.Sign(&auth.Claims{
+		Email:         user.Email,
+		TokenUse:      auth.TokenUseAccess,
+		SessionID:     session.ID,
+		Scope:         session.Scope,
+		ClientID:      session.ClientID,
+		Tenant:        session.Tenant,
+		Roles:         roles,
+		EmailVerified: &user.EmailVerified,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        auth.RandomString(16),
+			Issuer:    a.issuerFor(session.Tenant),
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(accessExpireAt),
+		},
+	})
+	if err != nil {
+		return auth.TokenResponse{}, "", fmt.Errorf("Ошибка генерации access токена: %w", err)
+	}
+
+	refreshID := auth.RandomString(16)
+	refreshToken, err := a.signer.Sign(&auth.Claims{
+		Email:    user.Email,
+		TokenUse: auth.TokenUseRefresh,
+		FamilyID: session.ID,
+		Scope:    session.Scope,
+		ClientID: session.ClientID,
+		Tenant:   session.Tenant,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        refreshID,
+			Issuer:    a.issuerFor(session.Tenant),
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(refreshExpireAt),
+		},
+	})
+	if err != nil {
+		return auth.TokenResponse{}, "", fmt.Errorf("Ошибка генерации refresh токена: %w", err)
+	}
+
+	var idToken string
+	if auth.HasScope(session.Scope, auth.ScopeOpenID) {
+		if idToken, err = a.idToken(user, session, nonce, accessToken); err != nil {
+			return auth.TokenResponse{}, "", err
+		}
+	}
+
+	hash := auth.HashToken(refreshToken)
+	err = a.tokens.Create(entity.RefreshToken{
+		ID:        refreshID,
+		FamilyID:  session.ID,
+		ParentID:  parentID,
+		UserID:    user.ID,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: refreshExpireAt,
+	})
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+
+	return auth.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    accessExpireAt.Unix(),
+		IDToken:      idToken,
+	}, hash, nil
+}
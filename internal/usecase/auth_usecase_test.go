@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/repository"
+	"JWT/pkg/auth"
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	_ "modernc.org/sqlite"
+)
+
+type memoryRevocations struct {
+	revocations []entity.Revocation
+}
+
+func (m *memoryRevocations) Save(revocation entity.Revocation) error {
+	m.revocations = append(m.revocations, revocation)
+	return nil
+}
+
+func (m *memoryRevocations) ListActive(now time.Time) ([]entity.Revocation, error) {
+	var active []entity.Revocation
+	for _, revocation := range m.revocations {
+		if revocation.ExpiresAt.After(now) {
+			active = append(active, revocation)
+		}
+	}
+	return active, nil
+}
+
+func (m *memoryRevocations) DeleteExpired(now time.Time) (int64, error) {
+	return 0, nil
+}
+
+type recordingNotifier struct {
+	messages []string
+}
+
+func (r *recordingNotifier) Notify(message string) {
+	r.messages = append(r.messages, message)
+}
+
+func newTestSigner(t testing.TB) auth.Signer {
+	t.Helper()
+	key, err := auth.GenerateKey("test", auth.AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := auth.NewStaticSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func newTestAuthUseCase(t testing.TB, revocations *RevocationUseCase) *AuthUseCase {
+	t.Helper()
+	return NewAuthUseCase(nil, nil, nil, revocations, nil, newTestSigner(t), nil, "http://test", EmailVerificationAllow)
+}
+
+// openTestDB opens a migrated database of its own for the test.
+func openTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_time_format=sqlite&_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := repository.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newStoredAuthUseCase is an AuthUseCase over a test database, for the flows
+// that end in a session.
+func newStoredAuthUseCase(t testing.TB, db *sql.DB, notifier Notifier) *AuthUseCase {
+	t.Helper()
+	revocations, err := NewRevocationUseCase(repository.NewRevocationRepository(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles, err := NewRoleUseCase(repository.NewRoleRepository(db), revocations, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthUseCase(
+		repository.NewUserRepository(db),
+		repository.NewRefreshTokenRepository(db),
+		repository.NewSessionRepository(db),
+		revocations,
+		roles,
+		newTestSigner(t),
+		notifier,
+		"http://test",
+		EmailVerificationAllow,
+	)
+}
+
+func createTestUser(t testing.TB, users entity.UserRepository, email string, verified bool) entity.User {
+	t.Helper()
+	user, err := users.Create(entity.DefaultTenant, entity.User{
+		Name:          "Test",
+		Email:         email,
+		Password:      "Passw0rd!234",
+		EmailVerified: verified,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func accessToken(t testing.TB, a *AuthUseCase, userID int, issuedAt time.Time) string {
+	t.Helper()
+	token, err := a.signer.Sign(&auth.Claims{
+		TokenUse:  auth.TokenUseAccess,
+		SessionID: auth.RandomString(16),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        auth.RandomString(16),
+			Issuer:    a.issuer,
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(AccessTokenTTL)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRevokeUserSparesTokensIssuedAfterIt(t *testing.T) {
+	revocations, err := NewRevocationUseCase(&memoryRevocations{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAuthUseCase(t, revocations)
+
+	before := accessToken(t, a, 1, time.Now())
+	if err := revocations.RevokeUser(1); err != nil {
+		t.Fatal(err)
+	}
+	// Tokens of the same second are revoked along with the earlier ones
+	sameSecond := accessToken(t, a, 1, time.Now())
+	after := accessToken(t, a, 1, time.Now().Add(time.Second))
+
+	if _, err := a.ValidateAccessToken(before); err != ErrAccessTokenRevoked {
+		t.Errorf("token issued before the revocation: got %v, want %v", err, ErrAccessTokenRevoked)
+	}
+	if _, err := a.ValidateAccessToken(sameSecond); err != ErrAccessTokenRevoked {
+		t.Errorf("token issued in the second of the revocation: got %v, want %v", err, ErrAccessTokenRevoked)
+	}
+	if _, err := a.ValidateAccessToken(after); err != nil {
+		t.Errorf("token issued after the revocation: %v", err)
+	}
+}
+
+func BenchmarkValidateAccessToken(b *testing.B) {
+	populated := &memoryRevocations{}
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	for i := range 10000 {
+		value := strconv.Itoa(i)
+		for _, kind := range []entity.RevocationKind{entity.RevokeToken, entity.RevokeSession, entity.RevokeUser, entity.RevokeClient} {
+			populated.Save(entity.Revocation{Kind: kind, Value: value, RevokedAt: time.Now(), ExpiresAt: expiresAt})
+		}
+	}
+
+	for _, bench := range []struct {
+		name string
+		repo *memoryRevocations
+	}{
+		{"empty", &memoryRevocations{}},
+		{"populated", populated},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			revocations, err := NewRevocationUseCase(bench.repo)
+			if err != nil {
+				b.Fatal(err)
+			}
+			a := newTestAuthUseCase(b, revocations)
+			// The populated cache revokes the user before the token is issued,
+			// so every lookup runs and none of them matches
+			token := accessToken(b, a, 1, time.Now().Add(time.Second))
+
+			b.ResetTimer()
+			for range b.N {
+				if _, err := a.ValidateAccessToken(token); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/directory"
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrInvalidPassword      = errors.New("Неправильный пароль")
+	ErrDirectoryUnavailable = errors.New("Сервис аутентификации недоступен, попробуйте позже")
+)
+
+// Authenticator checks the password of a login and returns the user of the
+// tenant it signs in as. Unknown users are NotFoundUser, wrong passwords
+// ErrInvalidPassword.
+type Authenticator interface {
+	Authenticate(tenant string, email string, password string) (entity.User, error)
+}
+
+// LocalAuthenticator checks the passwords stored with the users.
+type LocalAuthenticator struct {
+	users entity.UserRepository
+}
+
+func NewLocalAuthenticator(users entity.UserRepository) *LocalAuthenticator {
+	return &LocalAuthenticator{users}
+}
+
+func (l *LocalAuthenticator) Authenticate(tenant string, email string, password string) (entity.User, error) {
+	user, err := l.users.GetByEmail(tenant, email)
+	if err != nil {
+		return entity.User{}, err
+	}
+	if !user.CheckPassword(password) {
+		return entity.User{}, ErrInvalidPassword
+	}
+	return user, nil
+}
+
+// LDAPAuthenticator checks the passwords with a directory. Users are created
+// on their first login, and their name and the roles of their groups are
+// taken from the directory on every login.
+type LDAPAuthenticator struct {
+	directory *directory.Directory
+	users     entity.UserRepository
+	roles     *RoleUseCase
+	// groupRoles maps the DNs of groups, in lower case, to the roles their
+	// members hold in the tenant they sign in to.
+	groupRoles map[string][]string
+}
+
+func NewLDAPAuthenticator(
+	dir *directory.Directory,
+	users entity.UserRepository,
+	roles *RoleUseCase,
+	groupRoles map[string][]string,
+) *LDAPAuthenticator {
+	lower := map[string][]string{}
+	for group, groupRoles := range groupRoles {
+		key := strings.ToLower(group)
+		lower[key] = append(lower[key], groupRoles...)
+	}
+	return &LDAPAuthenticator{dir, users, roles, lower}
+}
+
+func (l *LDAPAuthenticator) Authenticate(tenant string, email string, password string) (entity.User, error) {
+	entry, err := l.directory.Authenticate(email, password)
+	switch {
+	case errors.Is(err, directory.ErrInvalidCredentials):
+		return entity.User{}, ErrInvalidPassword
+	case errors.Is(err, directory.ErrNotFound):
+		return entity.User{}, entity.NotFoundUser
+	case err != nil:
+		return entity.User{}, fmt.Errorf("%w: %w", ErrDirectoryUnavailable, err)
+	}
+
+	// The directory may know the user by another address than the login
+	email = cmp.Or(entry.Email, email)
+	user, err := l.users.GetByEmail(tenant, email)
+	switch {
+	case err == nil:
+		if entry.Name != "" && entry.Name != user.Name {
+			if err := l.users.UpdateName(user.ID, entry.Name); err != nil {
+				return entity.User{}, err
+			}
+			user.Name = entry.Name
+		}
+	case errors.Is(err, entity.NotFoundUser):
+		// The password is checked by the directory and never stored here
+		user, err = l.users.Create(tenant, entity.User{
+			Name:          cmp.Or(entry.Name, email),
+			Email:         email,
+			Password:      auth.RandomString(32),
+			EmailVerified: true,
+		})
+		if err != nil {
+			return entity.User{}, err
+		}
+	default:
+		return entity.User{}, err
+	}
+	// The directory vouches for the address
+	if !user.EmailVerified {
+		if _, err := l.users.VerifyEmail(user.ID, user.Email); err != nil {
+			return entity.User{}, err
+		}
+		user.EmailVerified = true
+	}
+
+	if err := l.syncRoles(tenant, user.ID, entry.Groups); err != nil {
+		return entity.User{}, err
+	}
+	return user, nil
+}
+
+// syncRoles grants the roles of the groups the user is in and takes away
+// those of the groups the user left. Roles no group maps to are left alone,
+// so that roles assigned by hand stay.
+func (l *LDAPAuthenticator) syncRoles(tenant string, userID int, groups []string) error {
+	var granted, managed []string
+	for group, roles := range l.groupRoles {
+		managed = append(managed, roles...)
+		if slices.ContainsFunc(groups, func(g string) bool { return strings.EqualFold(g, group) }) {
+			granted = append(granted, roles...)
+		}
+	}
+
+	held, err := l.roles.MemberRoles(tenant, userID)
+	if err != nil {
+		return err
+	}
+	for _, role := range granted {
+		if slices.Contains(held, role) {
+			continue
+		}
+		if err := l.roles.AssignMember(tenant, userID, role); err != nil {
+			return fmt.Errorf("Роль %q группы каталога: %w", role, err)
+		}
+		held = append(held, role)
+	}
+	for _, role := range held {
+		if slices.Contains(managed, role) && !slices.Contains(granted, role) {
+			if err := l.roles.UnassignMember(tenant, userID, role); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DomainAuthenticator picks the authenticator by the domain of the email.
+// Domains without one of their own use the fallback.
+type DomainAuthenticator struct {
+	domains  map[string]DomainBackend
+	fallback Authenticator
+}
+
+// DomainBackend is the authenticator of a domain. With FallbackLocal the
+// local password is tried when the directory does not know the user or can
+// not be reached; a password the directory rejects is never tried locally.
+type DomainBackend struct {
+	Authenticator Authenticator
+	FallbackLocal bool
+}
+
+func NewDomainAuthenticator(domains map[string]DomainBackend, fallback Authenticator) *DomainAuthenticator {
+	lower := map[string]DomainBackend{}
+	for domain, backend := range domains {
+		lower[strings.ToLower(domain)] = backend
+	}
+	return &DomainAuthenticator{lower, fallback}
+}
+
+func (d *DomainAuthenticator) Authenticate(tenant string, email string, password string) (entity.User, error) {
+	_, domain, _ := strings.Cut(email, "@")
+	backend, ok := d.domains[strings.ToLower(domain)]
+	if !ok {
+		return d.fallback.Authenticate(tenant, email, password)
+	}
+	user, err := backend.Authenticator.Authenticate(tenant, email, password)
+	if err != nil && backend.FallbackLocal &&
+		(errors.Is(err, entity.NotFoundUser) || errors.Is(err, ErrDirectoryUnavailable)) {
+		return d.fallback.Authenticate(tenant, email, password)
+	}
+	return user, err
+}
@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/policy"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ActionUsersRead   = entity.PermUsersRead
+	ActionUsersDelete = entity.PermUsersDelete
+)
+
+// DefaultPolicy is used while no policy file exists.
+const DefaultPolicy = `
+# Nothing crosses tenants. Written with not, so that a resource without a
+# tenant is denied as well.
+deny * if subject.type == "user" and not (resource.tenant == subject.tenant)
+
+# Users may read their own record, and delete it unless acting through a
+# client or a personal access token.
+allow users:read if subject.type == "user" and subject.id == resource.id
+allow users:delete if subject.type == "user" and subject.id == resource.id and subject.client_id == "" and subject.token_use == "access"
+
+allow users:read if "users:read" in subject.permissions
+allow users:delete if "users:delete" in subject.permissions
+allow users:* if "users:admin" in subject.permissions
+`
+
+// AuthzUseCase asks the policy engine about a token, an action and a resource.
+type AuthzUseCase struct {
+	engine *policy.Engine
+	roles  *RoleUseCase
+}
+
+func NewAuthzUseCase(engine *policy.Engine, roles *RoleUseCase) *AuthzUseCase {
+	return &AuthzUseCase{engine, roles}
+}
+
+func (a *AuthzUseCase) Check(claims *auth.Claims, action string, resource map[string]any, ip string) policy.Decision {
+	return a.Evaluate(policy.Request{
+		Subject:     a.Subject(claims),
+		Action:      action,
+		Resource:    resource,
+		Environment: Environment(ip),
+	})
+}
+
+func (a *AuthzUseCase) Evaluate(request policy.Request) policy.Decision {
+	return a.engine.Evaluate(request)
+}
+
+// Subject describes the bearer of the token to the policy.
+func (a *AuthzUseCase) Subject(claims *auth.Claims) map[string]any {
+	subject := map[string]any{
+		"client_id":   claims.ClientID,
+		"token_use":   claims.TokenUse,
+		"scopes":      strings.Fields(claims.Scope),
+		"permissions": a.roles.Permissions(claims),
+	}
+	if claims.IsClient() {
+		subject["type"] = "client"
+		subject["id"] = claims.ClientID
+		return subject
+	}
+
+	subject["type"] = "user"
+	subject["tenant"] = claims.Tenant
+	subject["email"] = claims.Email
+	subject["roles"] = claims.Roles
+	subject["session_id"] = claims.SessionID
+	if id, err := strconv.Atoi(claims.Subject); err == nil {
+		subject["id"] = id
+	}
+	if claims.Actor != nil {
+		subject["actor"] = claims.Actor.Subject
+	}
+	return subject
+}
+
+// UserResource describes a user record of the tenant to the policy.
+func UserResource(tenant string, user entity.User) map[string]any {
+	return map[string]any{"type": "user", "tenant": tenant, "id": user.ID, "email": user.Email}
+}
+
+// Environment describes the request to the policy. Times are in UTC.
+func Environment(ip string) map[string]any {
+	now := time.Now().UTC()
+	return map[string]any{
+		"ip":      ip,
+		"time":    now.Format(time.RFC3339),
+		"hour":    now.Hour(),
+		"weekday": strings.ToLower(now.Weekday().String()),
+	}
+}
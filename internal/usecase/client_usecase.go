@@ -0,0 +1,160 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"time"
+)
+
+type ClientUseCase struct {
+	repo        entity.ClientRepository
+	revocations *RevocationUseCase
+}
+
+func NewClientUseCase(repo entity.ClientRepository, revocations *RevocationUseCase) *ClientUseCase {
+	return &ClientUseCase{repo, revocations}
+}
+
+var (
+	ErrPublicClientSecret   = errors.New("Публичный клиент не может иметь секрет")
+	ErrUnsupportedGrantType = errors.New("Неподдерживаемый grant_type")
+)
+
+// Register creates the client or replaces its settings and secret. A client
+// that has been disabled stays disabled.
+func (c *ClientUseCase) Register(client entity.Client, secret string) error {
+	if err := validateGrantTypes(client); err != nil {
+		return err
+	}
+
+	existing, err := c.repo.GetByID(client.ID)
+	switch {
+	case err == nil:
+		client.CreatedAt = existing.CreatedAt
+		client.DisabledAt = existing.DisabledAt
+	case !errors.Is(err, entity.ErrClientNotFound):
+		return err
+	}
+	if client.CreatedAt.IsZero() {
+		client.CreatedAt = time.Now()
+	}
+
+	if client.Public {
+		if secret != "" {
+			return ErrPublicClientSecret
+		}
+		client.SecretHash = ""
+		return c.repo.Save(client)
+	}
+	if err := client.SetSecret(secret); err != nil {
+		return err
+	}
+	return c.repo.Save(client)
+}
+
+// Create registers a new client with a generated ID and secret. The secret is
+// only returned here and cannot be recovered later.
+func (c *ClientUseCase) Create(client entity.Client) (entity.Client, string, error) {
+	client.ID = auth.RandomString(16)
+	client.CreatedAt = time.Now()
+	client.DisabledAt = nil
+
+	var secret string
+	if !client.Public {
+		secret = auth.RandomString(32)
+	}
+	if err := c.Register(client, secret); err != nil {
+		return entity.Client{}, "", err
+	}
+
+	created, err := c.repo.GetByID(client.ID)
+	if err != nil {
+		return entity.Client{}, "", err
+	}
+	return created, secret, nil
+}
+
+// RotateSecret replaces the client secret. Tokens issued with the old secret
+// stay valid until they expire.
+func (c *ClientUseCase) RotateSecret(id string) (string, error) {
+	client, err := c.repo.GetByID(id)
+	if err != nil {
+		return "", err
+	}
+	if client.Public {
+		return "", ErrPublicClientSecret
+	}
+
+	secret := auth.RandomString(32)
+	if err := client.SetSecret(secret); err != nil {
+		return "", err
+	}
+	if err := c.repo.Save(client); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Disable stops the client from authenticating and revokes its access tokens.
+func (c *ClientUseCase) Disable(id string) error {
+	client, err := c.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if client.DisabledAt == nil {
+		now := time.Now()
+		client.DisabledAt = &now
+		if err := c.repo.Save(client); err != nil {
+			return err
+		}
+	}
+	return c.revocations.RevokeClient(id)
+}
+
+func (c *ClientUseCase) List() ([]entity.Client, error) {
+	return c.repo.GetAll()
+}
+
+func (c *ClientUseCase) Get(id string) (entity.Client, error) {
+	return c.repo.GetByID(id)
+}
+
+// Authenticate checks the client credentials. An unknown client and a wrong
+// secret are reported the same way. Public clients authenticate with their
+// client_id alone.
+func (c *ClientUseCase) Authenticate(id string, secret string) (entity.Client, error) {
+	client, err := c.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, entity.ErrClientNotFound) {
+			return entity.Client{}, entity.ErrInvalidClientSecret
+		}
+		return entity.Client{}, err
+	}
+	if client.Public {
+		if secret != "" {
+			return entity.Client{}, entity.ErrInvalidClientSecret
+		}
+	} else if !client.CheckSecret(secret) {
+		return entity.Client{}, entity.ErrInvalidClientSecret
+	}
+	if client.DisabledAt != nil {
+		return entity.Client{}, entity.ErrClientDisabled
+	}
+	return client, nil
+}
+
+func validateGrantTypes(client entity.Client) error {
+	for _, grantType := range client.GrantTypes {
+		switch grantType {
+		case entity.GrantAuthorizationCode, entity.GrantRefreshToken, entity.GrantDeviceCode:
+		case entity.GrantClientCredentials, entity.GrantTokenExchange:
+			if client.Public {
+				return ErrUnsupportedGrantType
+			}
+		default:
+			return ErrUnsupportedGrantType
+		}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	DeviceCodeTTL      = 10 * time.Minute
+	DevicePollInterval = 5 * time.Second
+
+	// userCodeAlphabet has no vowels, to avoid spelling words, and no
+	// characters that are easily confused when typed in.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// DeviceAuthorization is the RFC 8628 section 3.2 response.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// PendingDevice is what the user is shown before approving a user code.
+type PendingDevice struct {
+	UserCode   string    `json:"userCode"`
+	ClientID   string    `json:"clientId"`
+	ClientName string    `json:"clientName"`
+	Scope      string    `json:"scope,omitempty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// DeviceUseCase implements the device authorization grant for clients that
+// have no browser.
+type DeviceUseCase struct {
+	devices         entity.DeviceCodeRepository
+	clients         entity.ClientRepository
+	users           entity.UserRepository
+	auth            *AuthUseCase
+	verificationURI string
+}
+
+func NewDeviceUseCase(
+	devices entity.DeviceCodeRepository,
+	clients entity.ClientRepository,
+	users entity.UserRepository,
+	authUseCase *AuthUseCase,
+	verificationURI string,
+) *DeviceUseCase {
+	return &DeviceUseCase{devices, clients, users, authUseCase, verificationURI}
+}
+
+// Authorize starts a device authorization for the client.
+func (d *DeviceUseCase) Authorize(client entity.Client, scope string) (DeviceAuthorization, error) {
+	if !client.AllowsGrant(entity.GrantDeviceCode) {
+		return DeviceAuthorization{}, oauthError("unauthorized_client", "the client may not use the device authorization grant")
+	}
+	if !client.AllowsScopes(strings.Fields(scope)) {
+		return DeviceAuthorization{}, oauthError("invalid_scope", "requested scope is not allowed for the client")
+	}
+
+	now := time.Now()
+	if err := d.devices.DeleteExpired(now); err != nil {
+		return DeviceAuthorization{}, err
+	}
+
+	deviceCode := auth.RandomString(32)
+	userCode, err := randomCode(userCodeAlphabet, userCodeLength)
+	if err != nil {
+		return DeviceAuthorization{}, err
+	}
+	err = d.devices.Create(entity.DeviceCode{
+		DeviceCodeHash: auth.HashToken(deviceCode),
+		UserCode:       userCode,
+		ClientID:       client.ID,
+		Scope:          normalizeScope(scope),
+		Status:         entity.DeviceCodePending,
+		Interval:       DevicePollInterval,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(DeviceCodeTTL),
+	})
+	if err != nil {
+		return DeviceAuthorization{}, err
+	}
+
+	display := formatUserCode(userCode)
+	return DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                display,
+		VerificationURI:         d.verificationURI,
+		VerificationURIComplete: d.verificationURI + "?user_code=" + display,
+		ExpiresIn:               int64(DeviceCodeTTL / time.Second),
+		Interval:                int64(DevicePollInterval / time.Second),
+	}, nil
+}
+
+// Pending looks up a user code that is still waiting for a decision.
+func (d *DeviceUseCase) Pending(userCode string) (PendingDevice, error) {
+	code, err := d.pending(userCode)
+	if err != nil {
+		return PendingDevice{}, err
+	}
+	client, err := d.clients.GetByID(code.ClientID)
+	if err != nil {
+		return PendingDevice{}, err
+	}
+	return PendingDevice{
+		UserCode:   formatUserCode(code.UserCode),
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Scope:      code.Scope,
+		ExpiresAt:  code.ExpiresAt,
+	}, nil
+}
+
+// Decide records the user's approval or denial of a user code. The device
+// signs in to the tenant the user was signed in to.
+func (d *DeviceUseCase) Decide(userCode string, tenant string, userID int, approve bool) error {
+	code, err := d.pending(userCode)
+	if err != nil {
+		return err
+	}
+
+	status := entity.DeviceCodeDenied
+	if approve {
+		status = entity.DeviceCodeApproved
+	}
+	decided, err := d.devices.Decide(code.UserCode, status, tenant, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !decided {
+		return entity.ErrDeviceCodeProcessed
+	}
+	return nil
+}
+
+// Exchange answers a token request of a polling device. Until the user
+// decides it gets authorization_pending, or slow_down when it polls faster
+// than the interval; every slow_down adds five seconds to the interval.
+func (d *DeviceUseCase) Exchange(client entity.Client, deviceCode string, device entity.Device) (auth.TokenResponse, string, error) {
+	code, err := d.devices.GetByHash(auth.HashToken(deviceCode))
+	if err != nil {
+		if errors.Is(err, entity.ErrDeviceCodeNotFound) {
+			return auth.TokenResponse{}, "", oauthError("invalid_grant", "unknown device_code")
+		}
+		return auth.TokenResponse{}, "", err
+	}
+	if code.ClientID != client.ID {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "device_code was issued to another client")
+	}
+
+	now := time.Now()
+	if !now.Before(code.ExpiresAt) {
+		return auth.TokenResponse{}, "", oauthError("expired_token", "device_code expired")
+	}
+	if code.UsedAt != nil {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "device_code already used")
+	}
+
+	interval := code.Interval
+	tooFast := code.LastPolledAt != nil && now.Sub(*code.LastPolledAt) < interval
+	if tooFast {
+		interval += DevicePollInterval
+	}
+	if err := d.devices.Poll(code.DeviceCodeHash, now, interval); err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	if tooFast {
+		return auth.TokenResponse{}, "", oauthError("slow_down", "polling too fast")
+	}
+
+	switch code.Status {
+	case entity.DeviceCodePending:
+		return auth.TokenResponse{}, "", oauthError("authorization_pending", "the user has not yet approved the request")
+	case entity.DeviceCodeDenied:
+		return auth.TokenResponse{}, "", oauthError("access_denied", "the user denied the request")
+	}
+
+	fresh, err := d.devices.MarkUsed(code.DeviceCodeHash, now)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	if !fresh || code.UserID == nil {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "device_code already used")
+	}
+
+	user, err := d.users.GetByID(code.Tenant, *code.UserID)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	grant := entity.Grant{Tenant: code.Tenant, ClientID: client.ID, Scope: code.Scope}
+	if code.DecidedAt != nil {
+		grant.AuthTime = *code.DecidedAt
+	}
+	tokens, err := d.auth.IssueTokens(user, device, grant)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	return tokens, code.Scope, nil
+}
+
+// pending finds a user code that can still be decided. Expired codes are
+// reported as unknown.
+func (d *DeviceUseCase) pending(userCode string) (entity.DeviceCode, error) {
+	code, err := d.devices.GetByUserCode(normalizeUserCode(userCode))
+	if err != nil {
+		return entity.DeviceCode{}, err
+	}
+	if !time.Now().Before(code.ExpiresAt) {
+		return entity.DeviceCode{}, entity.ErrDeviceCodeNotFound
+	}
+	if code.Status != entity.DeviceCodePending {
+		return entity.DeviceCode{}, entity.ErrDeviceCodeProcessed
+	}
+	return code, nil
+}
+
+// randomCode picks length characters of the alphabet uniformly.
+func randomCode(alphabet string, length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode splits the code in two halves for readability: BDFH-KLMN.
+func formatUserCode(code string) string {
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
+
+// normalizeUserCode accepts the code in any case, with or without the dash.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/repository"
+	"JWT/pkg/auth"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestDeviceUseCase registers a client that may use the device grant.
+func newTestDeviceUseCase(t *testing.T) (*DeviceUseCase, entity.DeviceCodeRepository, entity.Client, entity.User) {
+	t.Helper()
+	db := openTestDB(t)
+	a := newStoredAuthUseCase(t, db, &recordingNotifier{})
+	clients := repository.NewClientRepository(db)
+	devices := repository.NewDeviceCodeRepository(db)
+	users := repository.NewUserRepository(db)
+
+	client, _, err := NewClientUseCase(clients, a.revocations).Create(entity.Client{
+		Name:       "TV",
+		GrantTypes: []string{entity.GrantDeviceCode},
+		Public:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDeviceUseCase(devices, clients, users, a, "http://test/device")
+	return d, devices, client, createTestUser(t, users, "device@example.com", true)
+}
+
+func TestDeviceExchangeSlowsDownFastPolling(t *testing.T) {
+	d, devices, client, _ := newTestDeviceUseCase(t)
+	authorization, err := d.Authorize(client, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := auth.HashToken(authorization.DeviceCode)
+
+	if _, _, err := d.Exchange(client, authorization.DeviceCode, entity.Device{}); oauthErrorCode(err) != "authorization_pending" {
+		t.Fatalf("first poll: got %v, want authorization_pending", err)
+	}
+	for i, want := range []time.Duration{DevicePollInterval * 2, DevicePollInterval * 3} {
+		if _, _, err := d.Exchange(client, authorization.DeviceCode, entity.Device{}); oauthErrorCode(err) != "slow_down" {
+			t.Fatalf("poll %d right after the last: got %v, want slow_down", i+2, err)
+		}
+		code, err := devices.GetByHash(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code.Interval != want {
+			t.Errorf("interval after slow_down %d: got %v, want %v", i+1, code.Interval, want)
+		}
+	}
+
+	// Waiting out the longer interval is fine again
+	code, err := devices.GetByHash(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := devices.Poll(hash, time.Now().Add(-code.Interval), code.Interval); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.Exchange(client, authorization.DeviceCode, entity.Device{}); oauthErrorCode(err) != "authorization_pending" {
+		t.Errorf("poll after the interval: got %v, want authorization_pending", err)
+	}
+}
+
+func TestDeviceExchangeExpires(t *testing.T) {
+	d, devices, client, user := newTestDeviceUseCase(t)
+	deviceCode := auth.RandomString(32)
+	now := time.Now()
+	err := devices.Create(entity.DeviceCode{
+		DeviceCodeHash: auth.HashToken(deviceCode),
+		UserCode:       "BCDFGHJK",
+		ClientID:       client.ID,
+		Status:         entity.DeviceCodePending,
+		Interval:       DevicePollInterval,
+		CreatedAt:      now.Add(-DeviceCodeTTL),
+		ExpiresAt:      now.Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Decide("BCDF-GHJK", entity.DefaultTenant, user.ID, true); !errors.Is(err, entity.ErrDeviceCodeNotFound) {
+		t.Errorf("approval of an expired code: got %v, want %v", err, entity.ErrDeviceCodeNotFound)
+	}
+	if _, _, err := d.Exchange(client, deviceCode, entity.Device{}); oauthErrorCode(err) != "expired_token" {
+		t.Errorf("got %v, want expired_token", err)
+	}
+}
+
+func TestDeviceExchangeAfterDecision(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		approve bool
+		want    string
+	}{
+		{"approved", true, ""},
+		{"denied", false, "access_denied"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _, client, user := newTestDeviceUseCase(t)
+			authorization, err := d.Authorize(client, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Decide(authorization.UserCode, entity.DefaultTenant, user.ID, tt.approve); err != nil {
+				t.Fatal(err)
+			}
+
+			tokens, _, err := d.Exchange(client, authorization.DeviceCode, entity.Device{})
+			if oauthErrorCode(err) != tt.want || (tt.want == "" && (err != nil || tokens.AccessToken == "")) {
+				t.Fatalf("got %v, want %q", err, tt.want)
+			}
+			if err := d.Decide(authorization.UserCode, entity.DefaultTenant, user.ID, !tt.approve); !errors.Is(err, entity.ErrDeviceCodeProcessed) {
+				t.Errorf("second decision: got %v, want %v", err, entity.ErrDeviceCodeProcessed)
+			}
+		})
+	}
+}
+
+func TestDeviceCodeIsExchangedOnce(t *testing.T) {
+	d, devices, client, user := newTestDeviceUseCase(t)
+	authorization, err := d.Authorize(client, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Decide(authorization.UserCode, entity.DefaultTenant, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.Exchange(client, authorization.DeviceCode, entity.Device{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not even after the interval
+	hash := auth.HashToken(authorization.DeviceCode)
+	if err := devices.Poll(hash, time.Now().Add(-DevicePollInterval), DevicePollInterval); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.Exchange(client, authorization.DeviceCode, entity.Device{}); oauthErrorCode(err) != "invalid_grant" {
+		t.Errorf("second exchange: got %v, want invalid_grant", err)
+	}
+}
@@ -0,0 +1,217 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/mail"
+	"JWT/pkg/security"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+// EmailLoginMethod is what the email carries.
+type EmailLoginMethod string
+
+const (
+	EmailLoginLink EmailLoginMethod = "link"
+	EmailLoginCode EmailLoginMethod = "code"
+)
+
+// emailLoginInterval is the least time between two login emails to an address.
+const emailLoginInterval = time.Minute
+
+var (
+	ErrInvalidLoginCode   = errors.New("Неверный или просроченный код входа")
+	ErrInvalidLoginMethod = errors.New("Невалидный способ входа")
+)
+
+// EmailLoginUseCase signs users in without a password: the email carries a
+// link or a 6 digit code that only works in the browser that asked for it.
+type EmailLoginUseCase struct {
+	codes  entity.LoginCodeRepository
+	users  entity.UserRepository
+	sender mail.Sender
+	// link is the page that redeems the token, the token is appended to it.
+	link        string
+	ttl         time.Duration
+	maxAttempts int
+	perAddress  *security.RateLimiter
+	perIP       *security.RateLimiter
+}
+
+func NewEmailLoginUseCase(
+	codes entity.LoginCodeRepository,
+	users entity.UserRepository,
+	sender mail.Sender,
+	link string,
+	ttl time.Duration,
+	maxAttempts int,
+	perHour int,
+) *EmailLoginUseCase {
+	return &EmailLoginUseCase{
+		codes:       codes,
+		users:       users,
+		sender:      sender,
+		link:        link,
+		ttl:         ttl,
+		maxAttempts: maxAttempts,
+		perAddress:  security.NewRateLimiter(1, emailLoginInterval),
+		perIP:       security.NewRateLimiter(perHour, time.Hour),
+	}
+}
+
+// Start emails the link or the code. It returns the binding the browser must
+// present to redeem it, for unknown addresses as well, so the answer does not
+// tell whether the address is registered.
+func (e *EmailLoginUseCase) Start(tenant string, email string, method EmailLoginMethod, ip string) (string, error) {
+	if method == "" {
+		method = EmailLoginLink
+	}
+	if method != EmailLoginLink && method != EmailLoginCode {
+		return "", ErrInvalidLoginMethod
+	}
+	if !e.perIP.Allow(ip) {
+		return "", ErrTooManyRequests
+	}
+
+	binding := auth.RandomString(32)
+	user, err := e.users.GetByEmail(tenant, email)
+	if err != nil {
+		if errors.Is(err, entity.NotFoundUser) {
+			return binding, nil
+		}
+		return "", err
+	}
+	if !e.perAddress.Allow(user.Email) {
+		return binding, nil
+	}
+
+	now := time.Now()
+	if err := e.codes.DeleteExpired(now); err != nil {
+		return "", err
+	}
+	token := auth.RandomString(32)
+	code, err := randomCode("0123456789", 6)
+	if err != nil {
+		return "", err
+	}
+	login := entity.LoginCode{
+		TokenHash:   auth.HashToken(token),
+		BindingHash: auth.HashToken(binding),
+		UserID:      user.ID,
+		Tenant:      tenant,
+		Email:       user.Email,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(e.ttl),
+	}
+	login.CodeHash = hashLoginCode(login, code)
+	if err := e.codes.Create(login); err != nil {
+		return "", err
+	}
+
+	var body string
+	if method == EmailLoginLink {
+		body = fmt.Sprintf(
+			"Здравствуйте, %s!\n\nЧтобы войти, перейдите по ссылке в том же браузере, в котором запросили вход:\n%s\n\n",
+			user.Name,
+			e.link+"?token="+url.QueryEscape(token),
+		)
+	} else {
+		body = fmt.Sprintf("Здравствуйте, %s!\n\nКод для входа: %s\n\n", user.Name, code)
+	}
+	body += fmt.Sprintf(
+		"Действителен до %s. Если вы не запрашивали вход, просто проигнорируйте это письмо.\n",
+		login.ExpiresAt.Format("02.01.2006 15:04 MST"),
+	)
+
+	// In the background, or the time to answer would tell the address is registered
+	go func() {
+		err := e.sender.Send(mail.Message{To: user.Email, Subject: "Вход без пароля", Body: body})
+		if err != nil {
+			log.Printf("Login email to user %d: %v", user.ID, err)
+		}
+	}()
+	return binding, nil
+}
+
+// Find looks up the login the browser is redeeming: by the token of the link
+// or, for a code, by the binding alone.
+func (e *EmailLoginUseCase) Find(binding string, token string) (entity.LoginCode, error) {
+	if binding == "" {
+		return entity.LoginCode{}, ErrInvalidLoginCode
+	}
+	bindingHash := auth.HashToken(binding)
+
+	var (
+		login entity.LoginCode
+		err   error
+	)
+	if token != "" {
+		login, err = e.codes.GetByHash(auth.HashToken(token))
+	} else {
+		login, err = e.codes.GetByBinding(bindingHash)
+	}
+	if err != nil {
+		if errors.Is(err, entity.ErrLoginCodeNotFound) {
+			return entity.LoginCode{}, ErrInvalidLoginCode
+		}
+		return entity.LoginCode{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(login.BindingHash), []byte(bindingHash)) != 1 {
+		return entity.LoginCode{}, ErrInvalidLoginCode
+	}
+	if login.UsedAt != nil || !time.Now().Before(login.ExpiresAt) {
+		return entity.LoginCode{}, ErrInvalidLoginCode
+	}
+	return login, nil
+}
+
+// Redeem checks the code, unless the login was found by the token of the
+// link, and returns the user to sign in. The login can not be redeemed again.
+func (e *EmailLoginUseCase) Redeem(login entity.LoginCode, viaLink bool, code string) (entity.User, error) {
+	if !viaLink {
+		counted, err := e.codes.CountAttempt(login.TokenHash, e.maxAttempts)
+		if err != nil {
+			return entity.User{}, err
+		}
+		if !counted {
+			return entity.User{}, ErrInvalidLoginCode
+		}
+		if subtle.ConstantTimeCompare([]byte(hashLoginCode(login, code)), []byte(login.CodeHash)) != 1 {
+			return entity.User{}, ErrInvalidLoginCode
+		}
+	}
+	fresh, err := e.codes.MarkUsed(login.TokenHash, time.Now())
+	if err != nil {
+		return entity.User{}, err
+	}
+	if !fresh {
+		return entity.User{}, ErrInvalidLoginCode
+	}
+
+	user, err := e.users.GetByID(login.Tenant, login.UserID)
+	if err != nil {
+		if errors.Is(err, entity.NotFoundUser) {
+			return entity.User{}, ErrInvalidLoginCode
+		}
+		return entity.User{}, err
+	}
+	// The email reached the user, so the address is theirs
+	if !user.EmailVerified {
+		if _, err := e.users.VerifyEmail(user.ID, user.Email); err != nil {
+			return entity.User{}, err
+		}
+		user.EmailVerified = true
+	}
+	return user, nil
+}
+
+// hashLoginCode salts the code with its login, so that equal codes of two
+// logins do not hash alike.
+func hashLoginCode(login entity.LoginCode, code string) string {
+	return auth.HashToken(login.TokenHash + ":" + code)
+}
@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/mail"
+	"JWT/pkg/security"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EmailVerificationMode decides what users may do before they verify their email.
+type EmailVerificationMode string
+
+const (
+	EmailVerificationAllow    EmailVerificationMode = "allow"
+	EmailVerificationRestrict EmailVerificationMode = "restrict"
+	EmailVerificationBlock    EmailVerificationMode = "block"
+)
+
+var (
+	ErrEmailNotVerified         = errors.New("Email не подтвержден")
+	ErrInvalidVerificationToken = errors.New("Невалидная ссылка подтверждения")
+	ErrTooManyRequests          = errors.New("Слишком много запросов, попробуйте позже")
+	ErrInvalidEmailVerification = errors.New("Невалидный режим подтверждения email")
+)
+
+// ParseEmailVerificationMode checks the mode named in the config.
+func ParseEmailVerificationMode(mode string) (EmailVerificationMode, error) {
+	switch m := EmailVerificationMode(mode); m {
+	case EmailVerificationAllow, EmailVerificationRestrict, EmailVerificationBlock:
+		return m, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidEmailVerification, mode)
+}
+
+// EmailVerificationUseCase sends the verification links and follows them.
+// The links carry a signed token, so nothing is stored until the email is
+// verified.
+type EmailVerificationUseCase struct {
+	users  entity.UserRepository
+	auth   *AuthUseCase
+	sender mail.Sender
+	// link is the URL of the verify endpoint, the token is appended to it.
+	link       string
+	ttl        time.Duration
+	perAddress *security.RateLimiter
+	perIP      *security.RateLimiter
+}
+
+func NewEmailVerificationUseCase(
+	users entity.UserRepository,
+	auth *AuthUseCase,
+	sender mail.Sender,
+	link string,
+	ttl time.Duration,
+	resendInterval time.Duration,
+	resendPerHour int,
+) *EmailVerificationUseCase {
+	return &EmailVerificationUseCase{
+		users:      users,
+		auth:       auth,
+		sender:     sender,
+		link:       link,
+		ttl:        ttl,
+		perAddress: security.NewRateLimiter(1, resendInterval),
+		perIP:      security.NewRateLimiter(resendPerHour, time.Hour),
+	}
+}
+
+// Send emails the link to a newly registered user.
+func (e *EmailVerificationUseCase) Send(tenant string, user entity.User) error {
+	if !e.perAddress.Allow(user.Email) {
+		return ErrTooManyRequests
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(e.ttl)
+	token, err := e.auth.signer.Sign(&auth.Claims{
+		Email:    user.Email,
+		TokenUse: auth.TokenUseEmailVerification,
+		Tenant:   tenant,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        auth.RandomString(16),
+			Issuer:    e.auth.issuerFor(tenant),
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.sender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Подтверждение email",
+		Body: fmt.Sprintf(
+			"Здравствуйте, %s!\n\nЧтобы подтвердить адрес, перейдите по ссылке:\n%s\n\nСсылка действительна до %s.\n",
+			user.Name,
+			e.link+"?token="+url.QueryEscape(token),
+			expiresAt.Format("02.01.2006 15:04 MST"),
+		),
+	})
+}
+
+// Resend emails a new link. Unknown and verified addresses are not
+// reported, so the endpoint can not be used to find accounts.
+func (e *EmailVerificationUseCase) Resend(tenant string, email string, ip string) error {
+	if !e.perIP.Allow(ip) {
+		return ErrTooManyRequests
+	}
+	user, err := e.users.GetByEmail(tenant, email)
+	if err != nil {
+		if errors.Is(err, entity.NotFoundUser) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return e.Send(tenant, user)
+}
+
+// Verify follows a link. It can be followed more than once.
+func (e *EmailVerificationUseCase) Verify(tokenString string) error {
+	claims := &auth.Claims{}
+	token, err := e.auth.signer.Parse(tokenString, claims)
+	if err != nil || !token.Valid || claims.TokenUse != auth.TokenUseEmailVerification {
+		return ErrInvalidVerificationToken
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	verified, err := e.users.VerifyEmail(userID, claims.Email)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/oidc"
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+)
+
+// FederationTimeout is how long a login may stay at the provider.
+const FederationTimeout = 10 * time.Minute
+
+var (
+	ErrUnknownProvider       = errors.New("Неизвестный провайдер входа")
+	ErrInvalidFederation     = errors.New("Невалидный или просроченный запрос входа через провайдера")
+	ErrFederatedEmail        = errors.New("Провайдер не подтвердил email")
+	ErrFederatedEmailClaimed = errors.New("Email занят учетной записью, которая его не подтвердила")
+)
+
+// FederatedProvider is an upstream provider as configured.
+type FederatedProvider struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	*oidc.Provider `json:"-"`
+}
+
+// FederationUseCase signs users in with upstream OpenID Connect providers.
+// On the first login the account is linked to the user of the tenant with
+// the same email, or a user is created for it.
+type FederationUseCase struct {
+	providers  map[string]FederatedProvider
+	order      []FederatedProvider
+	states     entity.FederationStateRepository
+	identities entity.IdentityRepository
+	users      entity.UserRepository
+}
+
+func NewFederationUseCase(
+	providers []FederatedProvider,
+	states entity.FederationStateRepository,
+	identities entity.IdentityRepository,
+	users entity.UserRepository,
+) *FederationUseCase {
+	byID := map[string]FederatedProvider{}
+	for _, provider := range providers {
+		byID[provider.ID] = provider
+	}
+	return &FederationUseCase{byID, providers, states, identities, users}
+}
+
+// Providers lists the providers for the login page.
+func (f *FederationUseCase) Providers() []FederatedProvider {
+	return f.order
+}
+
+// Begin returns the URL to send the browser to, and the state the browser
+// must come back with.
+func (f *FederationUseCase) Begin(ctx context.Context, providerID string, tenant string) (string, string, error) {
+	provider, ok := f.providers[providerID]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	now := time.Now()
+	if err := f.states.DeleteExpired(now); err != nil {
+		return "", "", err
+	}
+	state := auth.RandomString(32)
+	nonce := auth.RandomString(16)
+	verifier := auth.RandomString(32)
+	url, err := provider.AuthCodeURL(ctx, state, nonce, auth.PKCEChallenge(verifier))
+	if err != nil {
+		return "", "", err
+	}
+	err = f.states.Create(entity.FederationState{
+		StateHash: auth.HashToken(state),
+		Provider:  provider.ID,
+		Tenant:    tenant,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		CreatedAt: now,
+		ExpiresAt: now.Add(FederationTimeout),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return url, state, nil
+}
+
+// Finish redeems the code the provider sent back and returns the user to
+// sign in, with the tenant they asked for. browserState is the state the
+// browser kept, which must match the one in the callback.
+func (f *FederationUseCase) Finish(
+	ctx context.Context,
+	providerID string,
+	state string,
+	browserState string,
+	code string,
+) (entity.User, string, error) {
+	provider, ok := f.providers[providerID]
+	if !ok {
+		return entity.User{}, "", ErrUnknownProvider
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return entity.User{}, "", ErrInvalidFederation
+	}
+	stored, err := f.states.Take(auth.HashToken(state))
+	if err != nil {
+		if errors.Is(err, entity.ErrFederationStateNotFound) {
+			return entity.User{}, "", ErrInvalidFederation
+		}
+		return entity.User{}, "", err
+	}
+	if stored.Provider != provider.ID || !time.Now().Before(stored.ExpiresAt) {
+		return entity.User{}, "", ErrInvalidFederation
+	}
+
+	tokens, err := provider.Exchange(ctx, code, stored.Verifier)
+	if err != nil {
+		return entity.User{}, "", err
+	}
+	idToken, err := provider.VerifyIDToken(ctx, tokens.IDToken, stored.Nonce)
+	if err != nil {
+		return entity.User{}, "", err
+	}
+
+	user, err := linkAccount(f.identities, f.users, provider.ID, stored.Tenant, externalAccount{
+		Subject:       idToken.Subject,
+		Email:         idToken.Email,
+		EmailVerified: bool(idToken.EmailVerified),
+		Name:          idToken.Name,
+	})
+	if err != nil {
+		return entity.User{}, "", err
+	}
+	return user, stored.Tenant, nil
+}
+
+// externalAccount is the account of a user at an upstream provider.
+type externalAccount struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// linkAccount finds the user the account signs in as: the linked user of the
+// tenant, else the user with the same email, else a new user. Emails are
+// only trusted when both sides verified them; otherwise whoever registered
+// the address first would get the account of its owner.
+func linkAccount(
+	identities entity.IdentityRepository,
+	users entity.UserRepository,
+	provider string,
+	tenant string,
+	account externalAccount,
+) (entity.User, error) {
+	user, err := resolveAccount(identities, users, provider, tenant, account)
+	if err != nil {
+		return entity.User{}, err
+	}
+	if err := identities.Touch(provider, account.Subject, user.ID, time.Now()); err != nil {
+		return entity.User{}, err
+	}
+	return user, nil
+}
+
+func resolveAccount(
+	identities entity.IdentityRepository,
+	users entity.UserRepository,
+	provider string,
+	tenant string,
+	account externalAccount,
+) (entity.User, error) {
+	ids, err := identities.GetUserIDs(provider, account.Subject)
+	if err != nil {
+		return entity.User{}, err
+	}
+	for _, id := range ids {
+		user, err := users.GetByID(tenant, id)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, entity.NotFoundUser) {
+			return entity.User{}, err
+		}
+	}
+
+	if account.Email == "" || !account.EmailVerified {
+		return entity.User{}, ErrFederatedEmail
+	}
+	user, err := users.GetByEmail(tenant, account.Email)
+	switch {
+	case err == nil:
+		if !user.EmailVerified {
+			return entity.User{}, ErrFederatedEmailClaimed
+		}
+	case errors.Is(err, entity.NotFoundUser):
+		// The password is never told to anyone; it can be reset by email
+		user, err = users.Create(tenant, entity.User{
+			Name:          cmp.Or(account.Name, account.Email),
+			Email:         account.Email,
+			Password:      auth.RandomString(32),
+			EmailVerified: true,
+		})
+		if err != nil {
+			return entity.User{}, err
+		}
+	default:
+		return entity.User{}, err
+	}
+
+	err = identities.Create(entity.Identity{
+		Provider:  provider,
+		Subject:   account.Subject,
+		UserID:    user.ID,
+		Email:     account.Email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return entity.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,305 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/repository"
+	"JWT/pkg/auth"
+	"JWT/pkg/oidc"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testFederationClientID = "login-example"
+	testFederationSecret   = "federation-secret"
+	testFederationRedirect = "https://login.example.com/v1/login/federated/idp/callback"
+)
+
+// mockIdP is an OpenID Connect provider with discovery, keys and a token
+// endpoint. Its authorization endpoint is never browsed to: authorize plays
+// the part of the browser and the user signing in there.
+type mockIdP struct {
+	server *httptest.Server
+	signer auth.Signer
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+	// account is who signs in at the provider.
+	account mockAccount
+	// nonce replaces the nonce of the request in the ID token when set.
+	nonce string
+}
+
+// mockAccount is the user at the provider.
+type mockAccount struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// mockGrant is what a code was issued for.
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T, account mockAccount) *mockIdP {
+	t.Helper()
+	idp := &mockIdP{signer: newTestSigner(t), codes: map[string]mockGrant{}, account: account}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/.well-known/openid-configuration", func(c *gin.Context) {
+		c.JSON(http.StatusOK, oidc.Metadata{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	router.GET("/jwks", func(c *gin.Context) {
+		c.JSON(http.StatusOK, idp.signer.JWKS())
+	})
+	router.POST("/token", idp.token)
+	idp.server = httptest.NewServer(router)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (m *mockIdP) provider() FederatedProvider {
+	return FederatedProvider{
+		ID:   "idp",
+		Name: "IdP",
+		Provider: oidc.NewProvider(
+			m.server.URL,
+			testFederationClientID,
+			testFederationSecret,
+			testFederationRedirect,
+			[]string{"openid", "email", "profile"},
+			m.server.Client(),
+		),
+	}
+}
+
+// authorize signs the user in at the provider and returns the code and the
+// state it redirects back with.
+func (m *mockIdP) authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != testFederationClientID || query.Get("redirect_uri") != testFederationRedirect {
+		t.Fatalf("authorization request %s", authURL)
+	}
+	if query.Get("code_challenge_method") != auth.PKCEMethodS256 || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without PKCE: %s", authURL)
+	}
+
+	code := auth.RandomString(16)
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	m.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (m *mockIdP) token(c *gin.Context) {
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok || clientID != testFederationClientID || secret != testFederationSecret {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+	m.mu.Lock()
+	grant, ok := m.codes[c.PostForm("code")]
+	delete(m.codes, c.PostForm("code"))
+	account, nonce := m.account, m.nonce
+	m.mu.Unlock()
+	if !ok || c.PostForm("redirect_uri") != testFederationRedirect ||
+		!auth.VerifyPKCE(c.PostForm("code_verifier"), grant.challenge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+	if nonce == "" {
+		nonce = grant.nonce
+	}
+
+	now := time.Now()
+	idToken, err := m.signer.Sign(jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            testFederationClientID,
+		"sub":            account.Subject,
+		"email":          account.Email,
+		"email_verified": account.EmailVerified,
+		"name":           account.Name,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	c.JSON(http.StatusOK, oidc.Tokens{AccessToken: auth.RandomString(16), TokenType: "Bearer", IDToken: idToken})
+}
+
+func newTestFederationUseCase(db *sql.DB, idp *mockIdP) *FederationUseCase {
+	return NewFederationUseCase(
+		[]FederatedProvider{idp.provider()},
+		repository.NewFederationStateRepository(db),
+		repository.NewIdentityRepository(db),
+		repository.NewUserRepository(db),
+	)
+}
+
+// beginFederation starts a login and returns the state the browser keeps,
+// and the code and state the provider redirects back with.
+func beginFederation(t *testing.T, f *FederationUseCase, idp *mockIdP) (string, string, string) {
+	t.Helper()
+	authURL, browserState, err := f.Begin(context.Background(), "idp", entity.DefaultTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.authorize(t, authURL)
+	return browserState, code, state
+}
+
+func federatedLogin(t *testing.T, f *FederationUseCase, idp *mockIdP) (entity.User, error) {
+	t.Helper()
+	browserState, code, state := beginFederation(t, f, idp)
+	user, _, err := f.Finish(context.Background(), "idp", state, browserState, code)
+	return user, err
+}
+
+var verifiedAccount = mockAccount{
+	Subject:       "idp-user-1",
+	Email:         "federated@example.com",
+	EmailVerified: true,
+	Name:          "Federated User",
+}
+
+func TestFederationLinksVerifiedEmail(t *testing.T) {
+	db := openTestDB(t)
+	idp := newMockIdP(t, verifiedAccount)
+	f := newTestFederationUseCase(db, idp)
+	local := createTestUser(t, repository.NewUserRepository(db), verifiedAccount.Email, true)
+
+	user, err := federatedLogin(t, f, idp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != local.ID {
+		t.Fatalf("signed in as user %d, want %d", user.ID, local.ID)
+	}
+
+	// The link holds when the provider changes the address
+	idp.account.Email = "renamed@example.com"
+	user, err = federatedLogin(t, f, idp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != local.ID {
+		t.Errorf("signed in as user %d after the email changed, want %d", user.ID, local.ID)
+	}
+}
+
+func TestFederationCreatesUser(t *testing.T) {
+	idp := newMockIdP(t, verifiedAccount)
+	f := newTestFederationUseCase(openTestDB(t), idp)
+
+	user, err := federatedLogin(t, f, idp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != verifiedAccount.Email || user.Name != verifiedAccount.Name || !user.EmailVerified {
+		t.Errorf("created %+v", user)
+	}
+}
+
+func TestFederationRefusesUnverifiedEmails(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		db := openTestDB(t)
+		idp := newMockIdP(t, verifiedAccount)
+		f := newTestFederationUseCase(db, idp)
+		createTestUser(t, repository.NewUserRepository(db), verifiedAccount.Email, false)
+
+		if _, err := federatedLogin(t, f, idp); !errors.Is(err, ErrFederatedEmailClaimed) {
+			t.Fatalf("got %v, want %v", err, ErrFederatedEmailClaimed)
+		}
+	})
+
+	t.Run("at the provider", func(t *testing.T) {
+		account := verifiedAccount
+		account.EmailVerified = false
+		db := openTestDB(t)
+		idp := newMockIdP(t, account)
+		f := newTestFederationUseCase(db, idp)
+		createTestUser(t, repository.NewUserRepository(db), account.Email, true)
+
+		if _, err := federatedLogin(t, f, idp); !errors.Is(err, ErrFederatedEmail) {
+			t.Fatalf("got %v, want %v", err, ErrFederatedEmail)
+		}
+	})
+}
+
+func TestFederationChecksStateNonceAndPKCE(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("state of another browser", func(t *testing.T) {
+		idp := newMockIdP(t, verifiedAccount)
+		f := newTestFederationUseCase(openTestDB(t), idp)
+		_, code, state := beginFederation(t, f, idp)
+		otherState, _, _ := beginFederation(t, f, idp)
+
+		if _, _, err := f.Finish(ctx, "idp", state, otherState, code); !errors.Is(err, ErrInvalidFederation) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidFederation)
+		}
+	})
+
+	t.Run("state used twice", func(t *testing.T) {
+		idp := newMockIdP(t, verifiedAccount)
+		f := newTestFederationUseCase(openTestDB(t), idp)
+		browserState, code, state := beginFederation(t, f, idp)
+		if _, _, err := f.Finish(ctx, "idp", state, browserState, code); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := f.Finish(ctx, "idp", state, browserState, code); !errors.Is(err, ErrInvalidFederation) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidFederation)
+		}
+	})
+
+	t.Run("nonce of another login", func(t *testing.T) {
+		idp := newMockIdP(t, verifiedAccount)
+		f := newTestFederationUseCase(openTestDB(t), idp)
+		idp.nonce = "replayed-nonce"
+
+		if _, err := federatedLogin(t, f, idp); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Fatalf("got %v, want %v", err, oidc.ErrInvalidIDToken)
+		}
+	})
+
+	t.Run("code of another login", func(t *testing.T) {
+		// A code injected into the callback was issued for the challenge of
+		// another verifier
+		idp := newMockIdP(t, verifiedAccount)
+		f := newTestFederationUseCase(openTestDB(t), idp)
+		browserState, _, state := beginFederation(t, f, idp)
+		_, injected, _ := beginFederation(t, f, idp)
+
+		if _, _, err := f.Finish(ctx, "idp", state, browserState, injected); !errors.Is(err, oidc.ErrExchange) {
+			t.Fatalf("got %v, want %v", err, oidc.ErrExchange)
+		}
+	})
+}
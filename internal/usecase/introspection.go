@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"time"
+)
+
+const (
+	TokenTypeHintAccess  = "access_token"
+	TokenTypeHintRefresh = "refresh_token"
+)
+
+// Introspection is the RFC 7662 view of a token. Inactive tokens carry no
+// other members.
+type Introspection struct {
+	Active    bool        `json:"active"`
+	Subject   string      `json:"sub,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+	IssuedAt  int64       `json:"iat,omitempty"`
+	JTI       string      `json:"jti,omitempty"`
+	SessionID string      `json:"sid,omitempty"`
+	Tenant    string      `json:"tenant,omitempty"`
+	Actor     *auth.Actor `json:"act,omitempty"`
+}
+
+// Introspect describes any access or refresh token issued by this service.
+func (a *AuthUseCase) Introspect(token string, hint string) (Introspection, error) {
+	claims, err := a.identify(token, hint)
+	if err != nil {
+		if isInactive(err) {
+			return Introspection{Active: false}, nil
+		}
+		return Introspection{}, err
+	}
+
+	introspection := Introspection{
+		Active:    true,
+		Subject:   claims.Subject,
+		Username:  claims.Email,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: TokenTypeHintAccess,
+		JTI:       claims.ID,
+		SessionID: claims.SessionID,
+		Tenant:    claims.Tenant,
+		Actor:     claims.Actor,
+	}
+	if claims.TokenUse == auth.TokenUseRefresh {
+		introspection.TokenType = TokenTypeHintRefresh
+		introspection.SessionID = claims.FamilyID
+	}
+	if claims.ExpiresAt != nil {
+		introspection.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		introspection.IssuedAt = claims.IssuedAt.Unix()
+	}
+	return introspection, nil
+}
+
+// Revoke implements RFC 7009. Unknown and already invalid tokens are not an
+// error. A client may only revoke the tokens issued to it, which leaves out
+// first-party tokens. Revoking a refresh token ends its whole session.
+func (a *AuthUseCase) Revoke(token string, hint string, clientID string) error {
+	claims, err := a.identify(token, hint)
+	if err != nil {
+		if isInactive(err) {
+			return nil
+		}
+		return err
+	}
+	if claims.ClientID != clientID {
+		return ErrForeignToken
+	}
+
+	if claims.TokenUse == auth.TokenUseRefresh {
+		return a.endSession(claims.FamilyID)
+	}
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return a.revocations.RevokeToken(claims.ID, expiresAt)
+}
+
+// identify validates the token as the hinted type first and falls back to the
+// other one, as RFC 7662 and RFC 7009 ask.
+func (a *AuthUseCase) identify(token string, hint string) (*auth.Claims, error) {
+	validators := []func(string) (*auth.Claims, error){a.ValidateAccessToken, a.validateActiveRefreshToken}
+	if hint == TokenTypeHintRefresh {
+		validators[0], validators[1] = validators[1], validators[0]
+	}
+
+	var err error
+	for _, validate := range validators {
+		var claims *auth.Claims
+		if claims, err = validate(token); err == nil {
+			return claims, nil
+		}
+		if !isInactive(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// validateActiveRefreshToken treats an already exchanged refresh token as
+// inactive instead of raising a reuse alarm.
+func (a *AuthUseCase) validateActiveRefreshToken(token string) (*auth.Claims, error) {
+	claims, stored, _, err := a.validateRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if stored.UsedAt != nil {
+		return nil, entity.ErrRefreshTokenReused
+	}
+	return claims, nil
+}
+
+func isInactive(err error) bool {
+	return errors.Is(err, ErrInvalidAccessToken) ||
+		errors.Is(err, ErrAccessTokenRevoked) ||
+		errors.Is(err, entity.ErrInvalidRefreshToken) ||
+		errors.Is(err, entity.ErrRefreshTokenRevoked) ||
+		errors.Is(err, entity.ErrRefreshTokenReused) ||
+		errors.Is(err, entity.ErrSessionRevoked) ||
+		errors.Is(err, entity.ErrSessionNotFound)
+}
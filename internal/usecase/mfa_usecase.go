@@ -0,0 +1,286 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/otp"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// MFAPendingTTL is how long the user has to enter the code after the password.
+	MFAPendingTTL = 5 * time.Minute
+
+	// totpSkew accepts the codes of the previous and the next time step as
+	// well, for clocks that drift.
+	totpSkew           = 1
+	qrCodeSize         = 256
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+var (
+	ErrInvalidMFACode  = errors.New("Неверный код подтверждения")
+	ErrInvalidMFAToken = errors.New("Невалидный токен 2FA")
+)
+
+// MFAEnrollment is shown to the user once, to set up the authenticator app.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	// QRCode is the URI as a PNG image in a data: URI.
+	QRCode string `json:"qrCode"`
+}
+
+type MFAStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// MFAChallenge answers a login with the right password when the user has a
+// second factor. The token is exchanged for the real ones at /v1/login/mfa.
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	ExpiresAt   int64  `json:"expiresAt"`
+}
+
+// MFAPending are the claims of the mfa_pending token. They carry what the
+// login asked for until the second factor is verified.
+type MFAPending struct {
+	auth.Claims
+	Nonce  string `json:"nonce,omitempty"`
+	Device string `json:"device,omitempty"`
+}
+
+// MFAUseCase manages TOTP second factors and completes the logins that need one.
+type MFAUseCase struct {
+	repo  entity.MFARepository
+	users entity.UserRepository
+	auth  *AuthUseCase
+	// issuer is the name authenticator apps show next to the account.
+	issuer string
+}
+
+func NewMFAUseCase(
+	repo entity.MFARepository,
+	users entity.UserRepository,
+	auth *AuthUseCase,
+	issuer string,
+) *MFAUseCase {
+	return &MFAUseCase{repo, users, auth, issuer}
+}
+
+func (m *MFAUseCase) Status(userID int) (MFAStatus, error) {
+	enabled, err := m.Required(userID)
+	if err != nil || !enabled {
+		return MFAStatus{}, err
+	}
+	left, err := m.repo.RecoveryCodesLeft(userID)
+	if err != nil {
+		return MFAStatus{}, err
+	}
+	return MFAStatus{Enabled: true, RecoveryCodesLeft: left}, nil
+}
+
+// Required reports whether logins of the user need a second factor.
+func (m *MFAUseCase) Required(userID int) (bool, error) {
+	totp, err := m.repo.GetTOTP(userID)
+	if err != nil {
+		if errors.Is(err, entity.ErrTOTPNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return totp.Enabled(), nil
+}
+
+// Enroll generates a new secret. It has no effect on logins until Confirm.
+func (m *MFAUseCase) Enroll(userID int, account string) (MFAEnrollment, error) {
+	secret, err := otp.GenerateSecret()
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	if err := m.repo.SaveTOTP(entity.TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now()}); err != nil {
+		return MFAEnrollment{}, err
+	}
+
+	uri := otp.ProvisioningURI(m.issuer, account, secret)
+	png, err := otp.QRCode(uri, qrCodeSize)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	return MFAEnrollment{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// Confirm enables the second factor once the user proves the authenticator
+// app works. The recovery codes are returned only this once.
+func (m *MFAUseCase) Confirm(userID int, code string) ([]string, error) {
+	totp, err := m.repo.GetTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp.Enabled() {
+		return nil, entity.ErrTOTPEnabled
+	}
+	if err := m.verifyTOTP(totp, code); err != nil {
+		return nil, err
+	}
+	if err := m.repo.ConfirmTOTP(userID, time.Now()); err != nil {
+		return nil, err
+	}
+	return m.newRecoveryCodes(userID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, e.g. when they run out.
+func (m *MFAUseCase) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	if err := m.Verify(userID, code); err != nil {
+		return nil, err
+	}
+	return m.newRecoveryCodes(userID)
+}
+
+// Disable removes the second factor. It takes a code, so that a stolen
+// access token is not enough.
+func (m *MFAUseCase) Disable(userID int, code string) error {
+	if err := m.Verify(userID, code); err != nil {
+		return err
+	}
+	return m.repo.DeleteTOTP(userID)
+}
+
+// Verify accepts a code of the authenticator app or an unused recovery code.
+// Either can only be used once.
+func (m *MFAUseCase) Verify(userID int, code string) error {
+	totp, err := m.repo.GetTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Enabled() {
+		return entity.ErrTOTPNotFound
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == otp.Digits {
+		return m.verifyTOTP(totp, code)
+	}
+	used, err := m.repo.UseRecoveryCode(userID, auth.HashToken(normalizeUserCode(code)), time.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (m *MFAUseCase) verifyTOTP(totp entity.TOTP, code string) error {
+	step, ok := otp.Validate(totp.Secret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	// A code seen by someone looking over the shoulder is no good any more
+	fresh, err := m.repo.UseStep(totp.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (m *MFAUseCase) newRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := randomCode(userCodeAlphabet, recoveryCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = formatUserCode(code)
+		hashes[i] = auth.HashToken(code)
+	}
+	if err := m.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Challenge is issued instead of tokens once the password of a user with a
+// second factor has been checked.
+func (m *MFAUseCase) Challenge(user entity.User, grant entity.Grant, device string) (MFAChallenge, error) {
+	now := time.Now()
+	expiresAt := now.Add(MFAPendingTTL)
+	token, err := m.auth.signer.Sign(&MFAPending{
+		Claims: auth.Claims{
+			Email:    user.Email,
+			TokenUse: auth.TokenUseMFAPending,
+			Scope:    grant.Scope,
+			Tenant:   grant.Tenant,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        auth.RandomString(16),
+				Issuer:    m.auth.issuerFor(grant.Tenant),
+				Subject:   strconv.Itoa(user.ID),
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+			},
+		},
+		Nonce:  grant.Nonce,
+		Device: device,
+	})
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+	return MFAChallenge{MFARequired: true, MFAToken: token, ExpiresAt: expiresAt.Unix()}, nil
+}
+
+// Pending validates an mfa_pending token.
+func (m *MFAUseCase) Pending(tokenString string) (*MFAPending, error) {
+	pending := &MFAPending{}
+	token, err := m.auth.signer.Parse(tokenString, pending)
+	if err != nil || !token.Valid || pending.TokenUse != auth.TokenUseMFAPending {
+		return nil, ErrInvalidMFAToken
+	}
+	if m.auth.revocations.IsRevoked(&pending.Claims) {
+		return nil, ErrInvalidMFAToken
+	}
+	return pending, nil
+}
+
+// CompleteLogin checks the second factor and issues the tokens the login
+// asked for. The mfa_pending token can not be used again afterwards.
+func (m *MFAUseCase) CompleteLogin(pending *MFAPending, code string, device entity.Device) (auth.TokenResponse, error) {
+	userID, err := strconv.Atoi(pending.Subject)
+	if err != nil {
+		return auth.TokenResponse{}, ErrInvalidMFAToken
+	}
+	if err := m.Verify(userID, code); err != nil {
+		return auth.TokenResponse{}, err
+	}
+	if err := m.auth.revocations.RevokeToken(pending.ID, pending.ExpiresAt.Time); err != nil {
+		return auth.TokenResponse{}, err
+	}
+
+	user, err := m.users.GetByID(pending.Tenant, userID)
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+	device.Name = pending.Device
+	return m.auth.IssueTokens(user, device, entity.Grant{
+		Tenant:   pending.Tenant,
+		Scope:    pending.Scope,
+		Nonce:    pending.Nonce,
+		AuthTime: pending.IssuedAt.Time,
+	})
+}
@@ -0,0 +1,228 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const AuthorizationCodeTTL = time.Minute
+
+// OAuthError is an error response defined by RFC 6749 section 5.2.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func oauthError(code string, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+var (
+	// ErrInvalidRedirect must never be answered with a redirect: the
+	// redirect_uri cannot be trusted.
+	ErrInvalidRedirect = errors.New("Невалидный client_id или redirect_uri")
+)
+
+type AuthorizeRequest struct {
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	ResponseType        string `form:"response_type"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Nonce               string `form:"nonce"`
+	// Tenant is the organization the user signs in to, the default one if empty.
+	Tenant string `form:"tenant"`
+}
+
+type OAuthUseCase struct {
+	clients entity.ClientRepository
+	codes   entity.AuthorizationCodeRepository
+	users   entity.UserRepository
+	auth    *AuthUseCase
+}
+
+func NewOAuthUseCase(
+	clients entity.ClientRepository,
+	codes entity.AuthorizationCodeRepository,
+	users entity.UserRepository,
+	authUseCase *AuthUseCase,
+) *OAuthUseCase {
+	return &OAuthUseCase{clients, codes, users, authUseCase}
+}
+
+// ValidateAuthorize checks an authorization request. ErrInvalidRedirect means
+// the error has to be shown to the user; an *OAuthError can be sent back to
+// the client's redirect_uri.
+func (o *OAuthUseCase) ValidateAuthorize(request AuthorizeRequest) (entity.Client, error) {
+	client, err := o.clients.GetByID(request.ClientID)
+	if err != nil {
+		if errors.Is(err, entity.ErrClientNotFound) {
+			return entity.Client{}, ErrInvalidRedirect
+		}
+		return entity.Client{}, err
+	}
+	if !client.HasRedirectURI(request.RedirectURI) {
+		return entity.Client{}, ErrInvalidRedirect
+	}
+	if client.DisabledAt != nil {
+		return entity.Client{}, entity.ErrClientDisabled
+	}
+	if !client.AllowsGrant(entity.GrantAuthorizationCode) {
+		return client, oauthError("unauthorized_client", "the client may not use the authorization code grant")
+	}
+
+	if request.ResponseType != "code" {
+		return client, oauthError("unsupported_response_type", "only response_type=code is supported")
+	}
+	if request.CodeChallenge == "" {
+		return client, oauthError("invalid_request", "code_challenge is required")
+	}
+	if request.CodeChallengeMethod != auth.PKCEMethodS256 {
+		return client, oauthError("invalid_request", "code_challenge_method must be S256")
+	}
+	if !client.AllowsScopes(strings.Fields(request.Scope)) {
+		return client, oauthError("invalid_scope", "requested scope is not allowed for the client")
+	}
+	return client, nil
+}
+
+// IssueCode records the user's consent and returns the code for the redirect.
+// An *OAuthError can be sent back to the client's redirect_uri.
+func (o *OAuthUseCase) IssueCode(client entity.Client, user entity.User, request AuthorizeRequest) (string, error) {
+	if !client.AllowsScopes(strings.Fields(request.Scope)) {
+		return "", oauthError("invalid_scope", "requested scope is not allowed for the client")
+	}
+	now := time.Now()
+	if err := o.codes.DeleteExpired(now); err != nil {
+		return "", err
+	}
+
+	code := auth.RandomString(32)
+	err := o.codes.Create(entity.AuthorizationCode{
+		CodeHash:            auth.HashToken(code),
+		ClientID:            client.ID,
+		UserID:              user.ID,
+		Tenant:              request.Tenant,
+		RedirectURI:         request.RedirectURI,
+		Scope:               normalizeScope(request.Scope),
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		Nonce:               request.Nonce,
+		AuthTime:            now,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(AuthorizationCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code at the token endpoint. A code
+// presented twice revokes the session created by its first use (RFC 6749
+// section 4.1.2).
+func (o *OAuthUseCase) ExchangeCode(
+	client entity.Client,
+	code string,
+	redirectURI string,
+	verifier string,
+	device entity.Device,
+) (auth.TokenResponse, string, error) {
+	stored, err := o.codes.GetByHash(auth.HashToken(code))
+	if err != nil {
+		if errors.Is(err, entity.ErrAuthorizationCodeNotFound) {
+			return auth.TokenResponse{}, "", oauthError("invalid_grant", "unknown authorization code")
+		}
+		return auth.TokenResponse{}, "", err
+	}
+	if stored.ClientID != client.ID {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "code was issued to another client")
+	}
+	if !time.Now().Before(stored.ExpiresAt) {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "authorization code expired")
+	}
+
+	fresh, err := o.codes.MarkUsed(stored.CodeHash, time.Now())
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	if !fresh {
+		if stored.SessionID != nil {
+			if err := o.auth.endSession(*stored.SessionID); err != nil {
+				return auth.TokenResponse{}, "", err
+			}
+		}
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "authorization code already used")
+	}
+
+	if stored.RedirectURI != redirectURI {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "redirect_uri mismatch")
+	}
+	if !auth.VerifyPKCE(verifier, stored.CodeChallenge) {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "code_verifier mismatch")
+	}
+
+	user, err := o.users.GetByID(stored.Tenant, stored.UserID)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+
+	tokens, session, err := o.auth.startSession(user, device, entity.Grant{
+		Tenant:   stored.Tenant,
+		ClientID: client.ID,
+		Scope:    stored.Scope,
+		Nonce:    stored.Nonce,
+		AuthTime: stored.AuthTime,
+	})
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	if err := o.codes.SetSession(stored.CodeHash, session.ID); err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	return tokens, stored.Scope, nil
+}
+
+// ClientCredentials issues an access token to the client itself. Without a
+// requested scope the client gets every scope it is registered for.
+func (o *OAuthUseCase) ClientCredentials(client entity.Client, scope string) (auth.TokenResponse, string, error) {
+	if client.Public {
+		return auth.TokenResponse{}, "", oauthError("unauthorized_client", "public clients may not use client_credentials")
+	}
+
+	scope = normalizeScope(scope)
+	if scope == "" {
+		scope = strings.Join(client.Scopes, " ")
+	} else if !client.AllowsScopes(strings.Fields(scope)) {
+		return auth.TokenResponse{}, "", oauthError("invalid_scope", "requested scope is not allowed for the client")
+	}
+
+	tokens, err := o.auth.IssueClientToken(client, scope)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	return tokens, scope, nil
+}
+
+// normalizeScope removes duplicates and extra whitespace.
+func normalizeScope(scope string) string {
+	var result []string
+	seen := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return strings.Join(result, " ")
+}
@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/repository"
+	"JWT/pkg/auth"
+	"errors"
+	"testing"
+)
+
+const testRedirectURI = "https://app.example.com/callback"
+
+// newTestOAuthUseCase registers a public client and a user who signs in to it.
+func newTestOAuthUseCase(t *testing.T) (*OAuthUseCase, *AuthUseCase, entity.Client, entity.User) {
+	t.Helper()
+	db := openTestDB(t)
+	a := newStoredAuthUseCase(t, db, &recordingNotifier{})
+	clients := repository.NewClientRepository(db)
+	users := repository.NewUserRepository(db)
+
+	client, _, err := NewClientUseCase(clients, a.revocations).Create(entity.Client{
+		Name:         "App",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{auth.ScopeOpenID},
+		Public:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := NewOAuthUseCase(clients, repository.NewAuthorizationCodeRepository(db), users, a)
+	return o, a, client, createTestUser(t, users, "oauth@example.com", true)
+}
+
+// issueTestCode has the user consent and returns the code for the verifier.
+func issueTestCode(t *testing.T, o *OAuthUseCase, client entity.Client, user entity.User, verifier string) string {
+	t.Helper()
+	request := AuthorizeRequest{
+		ClientID:            client.ID,
+		RedirectURI:         testRedirectURI,
+		ResponseType:        "code",
+		Scope:               auth.ScopeOpenID,
+		CodeChallenge:       auth.PKCEChallenge(verifier),
+		CodeChallengeMethod: auth.PKCEMethodS256,
+		Tenant:              entity.DefaultTenant,
+	}
+	if _, err := o.ValidateAuthorize(request); err != nil {
+		t.Fatal(err)
+	}
+	code, err := o.IssueCode(client, user, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// oauthErrorCode is the code of an *OAuthError, empty for any other error.
+func oauthErrorCode(err error) string {
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+	return ""
+}
+
+func TestExchangeCodeChecksTheVerifier(t *testing.T) {
+	verifier := auth.RandomString(32)
+	for _, tt := range []struct {
+		name     string
+		verifier string
+	}{
+		{"another verifier", auth.RandomString(32)},
+		{"no verifier", ""},
+		{"the challenge itself", auth.PKCEChallenge(verifier)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _, client, user := newTestOAuthUseCase(t)
+			code := issueTestCode(t, o, client, user, verifier)
+
+			if _, _, err := o.ExchangeCode(client, code, testRedirectURI, tt.verifier, entity.Device{}); oauthErrorCode(err) != "invalid_grant" {
+				t.Fatalf("got %v, want invalid_grant", err)
+			}
+			// A guess spends the code
+			if _, _, err := o.ExchangeCode(client, code, testRedirectURI, verifier, entity.Device{}); oauthErrorCode(err) != "invalid_grant" {
+				t.Errorf("code after a wrong verifier: got %v, want invalid_grant", err)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeTwiceEndsTheSession(t *testing.T) {
+	o, a, client, user := newTestOAuthUseCase(t)
+	verifier := auth.RandomString(32)
+	code := issueTestCode(t, o, client, user, verifier)
+
+	tokens, scope, err := o.ExchangeCode(client, code, testRedirectURI, verifier, entity.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scope != auth.ScopeOpenID || tokens.IDToken == "" {
+		t.Errorf("scope %q, ID token %q", scope, tokens.IDToken)
+	}
+
+	if _, _, err := o.ExchangeCode(client, code, testRedirectURI, verifier, entity.Device{}); oauthErrorCode(err) != "invalid_grant" {
+		t.Fatalf("second exchange: got %v, want invalid_grant", err)
+	}
+	if _, err := a.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrAccessTokenRevoked) {
+		t.Errorf("access token of the first exchange: got %v, want %v", err, ErrAccessTokenRevoked)
+	}
+	if _, err := a.Refresh(tokens.RefreshToken, client.ID); err == nil {
+		t.Error("refresh token of the first exchange still works")
+	}
+}
+
+func TestExchangeCodeChecksClientAndRedirect(t *testing.T) {
+	o, _, client, user := newTestOAuthUseCase(t)
+	verifier := auth.RandomString(32)
+
+	other := client
+	other.ID = "other"
+	if _, _, err := o.ExchangeCode(other, issueTestCode(t, o, client, user, verifier), testRedirectURI, verifier, entity.Device{}); oauthErrorCode(err) != "invalid_grant" {
+		t.Errorf("code of another client: got %v, want invalid_grant", err)
+	}
+	if _, _, err := o.ExchangeCode(client, issueTestCode(t, o, client, user, verifier), "https://evil.example.com/callback", verifier, entity.Device{}); oauthErrorCode(err) != "invalid_grant" {
+		t.Errorf("another redirect_uri: got %v, want invalid_grant", err)
+	}
+	if _, _, err := o.ExchangeCode(client, "unknown", testRedirectURI, verifier, entity.Device{}); oauthErrorCode(err) != "invalid_grant" {
+		t.Errorf("unknown code: got %v, want invalid_grant", err)
+	}
+}
@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const IDTokenTTL = time.Hour
+
+var (
+	ErrInsufficientScope = errors.New("Недостаточно прав для запрошенных данных")
+	ErrInvalidScope      = errors.New("Недопустимый scope")
+)
+
+// FirstPartyGrant builds the grant of a /v1/login. Without a client only the
+// OpenID Connect scopes can be requested.
+func FirstPartyGrant(tenant string, scope string, nonce string) (entity.Grant, error) {
+	scope = normalizeScope(scope)
+	for _, s := range strings.Fields(scope) {
+		if s != auth.ScopeOpenID && s != auth.ScopeProfile && s != auth.ScopeEmail {
+			return entity.Grant{}, ErrInvalidScope
+		}
+	}
+	return entity.Grant{Tenant: tenant, Scope: scope, Nonce: nonce}, nil
+}
+
+// UserInfo is the OpenID Connect userinfo response. Like the ID token it only
+// carries the claims of the granted scopes.
+type UserInfo struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name,omitempty"`
+	Email   string `json:"email,omitempty"`
+}
+
+// UserInfo describes the user an access token was issued for. The token must
+// have been granted the openid scope.
+func (a *AuthUseCase) UserInfo(claims *auth.Claims) (UserInfo, error) {
+	if claims.IsClient() || !auth.HasScope(claims.Scope, auth.ScopeOpenID) {
+		return UserInfo{}, ErrInsufficientScope
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return UserInfo{}, ErrInvalidAccessToken
+	}
+	user, err := a.users.GetByID(claims.Tenant, id)
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	info := UserInfo{Subject: claims.Subject}
+	if auth.HasScope(claims.Scope, auth.ScopeProfile) {
+		info.Name = user.Name
+	}
+	if auth.HasScope(claims.Scope, auth.ScopeEmail) {
+		info.Email = user.Email
+	}
+	return info, nil
+}
+
+// idToken signs the ID token that accompanies accessToken. Its audience is the
+// client; first-party logins have none, so the service itself is the audience.
+func (a *AuthUseCase) idToken(user entity.User, session entity.Session, nonce string, accessToken string) (string, error) {
+	atHash, err := auth.AccessTokenHash(accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	audience := session.ClientID
+	if audience == "" {
+		audience = a.issuerFor(session.Tenant)
+	}
+
+	now := time.Now()
+	claims := &auth.IDTokenClaims{
+		Nonce:           nonce,
+		AuthTime:        session.AuthTime.Unix(),
+		AtHash:          atHash,
+		AuthorizedParty: session.ClientID,
+		Tenant:          session.Tenant,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    a.issuerFor(session.Tenant),
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(IDTokenTTL)),
+		},
+	}
+	if auth.HasScope(session.Scope, auth.ScopeProfile) {
+		claims.Name = user.Name
+	}
+	if auth.HasScope(session.Scope, auth.ScopeEmail) {
+		claims.Email = user.Email
+	}
+
+	idToken, err := a.signer.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка генерации id токена: %w", err)
+	}
+	return idToken, nil
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"errors"
+	"regexp"
+	"time"
+)
+
+var ErrInvalidOrganization = errors.New("Невалидный идентификатор организации")
+
+// organizationID keeps tenant IDs usable in URLs and in the tenant claim.
+var organizationID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// OrganizationUseCase manages tenants, their members and the roles members
+// hold within them.
+type OrganizationUseCase struct {
+	repo        entity.OrganizationRepository
+	roles       *RoleUseCase
+	revocations *RevocationUseCase
+}
+
+func NewOrganizationUseCase(
+	repo entity.OrganizationRepository,
+	roles *RoleUseCase,
+	revocations *RevocationUseCase,
+) *OrganizationUseCase {
+	return &OrganizationUseCase{repo, roles, revocations}
+}
+
+// Resolve checks the tenant named in a request. No tenant means the default one.
+func (o *OrganizationUseCase) Resolve(tenant string) (string, error) {
+	if tenant == "" {
+		return entity.DefaultTenant, nil
+	}
+	if _, err := o.repo.GetByID(tenant); err != nil {
+		return "", err
+	}
+	return tenant, nil
+}
+
+func (o *OrganizationUseCase) List() ([]entity.Organization, error) {
+	return o.repo.GetAll()
+}
+
+func (o *OrganizationUseCase) Get(id string) (entity.Organization, error) {
+	return o.repo.GetByID(id)
+}
+
+// Save creates the organization or renames an existing one.
+func (o *OrganizationUseCase) Save(org entity.Organization) error {
+	if !organizationID.MatchString(org.ID) {
+		return ErrInvalidOrganization
+	}
+	org.CreatedAt = time.Now()
+	return o.repo.Save(org)
+}
+
+func (o *OrganizationUseCase) Members(id string) ([]entity.Member, error) {
+	if _, err := o.repo.GetByID(id); err != nil {
+		return nil, err
+	}
+	return o.repo.Members(id)
+}
+
+// AddMember lets an existing user sign in to the organization as well.
+func (o *OrganizationUseCase) AddMember(id string, userID int) error {
+	if _, err := o.repo.GetByID(id); err != nil {
+		return err
+	}
+	_, err := o.repo.AddMember(id, userID, time.Now())
+	return err
+}
+
+// RemoveMember revokes the user's tokens for the organization, since they
+// stay valid otherwise. Those of its other organizations are left alone.
+func (o *OrganizationUseCase) RemoveMember(id string, userID int) error {
+	if err := o.repo.RemoveMember(id, userID); err != nil {
+		return err
+	}
+	return o.revocations.RevokeMember(id, userID)
+}
+
+func (o *OrganizationUseCase) MemberRoles(id string, userID int) ([]string, error) {
+	if err := o.requireMember(id, userID); err != nil {
+		return nil, err
+	}
+	return o.roles.MemberRoles(id, userID)
+}
+
+func (o *OrganizationUseCase) AssignRole(id string, userID int, role string) error {
+	if err := o.requireMember(id, userID); err != nil {
+		return err
+	}
+	return o.roles.AssignMember(id, userID, role)
+}
+
+func (o *OrganizationUseCase) UnassignRole(id string, userID int, role string) error {
+	if err := o.requireMember(id, userID); err != nil {
+		return err
+	}
+	return o.roles.UnassignMember(id, userID, role)
+}
+
+func (o *OrganizationUseCase) requireMember(id string, userID int) error {
+	member, err := o.repo.IsMember(id, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return entity.ErrNotMember
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/repository"
+	"errors"
+	"testing"
+)
+
+func TestRemoveMemberEndsOnlyThatTenant(t *testing.T) {
+	db := openTestDB(t)
+	a := newStoredAuthUseCase(t, db, &recordingNotifier{})
+	o := NewOrganizationUseCase(repository.NewOrganizationRepository(db), a.roles, a.revocations)
+	users := repository.NewUserRepository(db)
+	user := createTestUser(t, users, "member@example.com", true)
+	if err := o.Save(entity.Organization{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddMember("acme", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	inDefault, err := a.IssueTokens(user, entity.Device{}, entity.Grant{Tenant: entity.DefaultTenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inAcme, err := a.IssueTokens(user, entity.Device{}, entity.Grant{Tenant: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.RemoveMember("acme", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ValidateAccessToken(inAcme.AccessToken); !errors.Is(err, ErrAccessTokenRevoked) {
+		t.Errorf("access token of the tenant left: got %v, want %v", err, ErrAccessTokenRevoked)
+	}
+	if _, err := a.Refresh(inAcme.RefreshToken, ""); !errors.Is(err, entity.ErrInvalidRefreshToken) {
+		t.Errorf("refresh token of the tenant left: got %v, want %v", err, entity.ErrInvalidRefreshToken)
+	}
+	if _, err := a.ValidateAccessToken(inDefault.AccessToken); err != nil {
+		t.Errorf("access token of the other tenant: %v", err)
+	}
+	if _, err := a.Refresh(inDefault.RefreshToken, ""); err != nil {
+		t.Errorf("refresh token of the other tenant: %v", err)
+	}
+
+	// Without a membership left the user is gone, and stays gone after the
+	// next migration
+	if err := o.RemoveMember(entity.DefaultTenant, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.GetByID(entity.DefaultTenant, user.ID); !errors.Is(err, entity.NotFoundUser) {
+		t.Errorf("user without a tenant: got %v, want %v", err, entity.NotFoundUser)
+	}
+}
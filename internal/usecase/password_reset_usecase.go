@@ -0,0 +1,171 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/mail"
+	"JWT/pkg/security"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+// passwordResetInterval is the least time between two reset emails to an address.
+const passwordResetInterval = time.Minute
+
+var ErrInvalidResetToken = errors.New("Невалидная или просроченная ссылка для сброса пароля")
+
+// PasswordResetUseCase lets users who forgot the password set a new one
+// through a link sent to their email.
+type PasswordResetUseCase struct {
+	resets   entity.PasswordResetRepository
+	users    entity.UserRepository
+	sessions *SessionUseCase
+	auth     *AuthUseCase
+	sender   mail.Sender
+	// link is the page that asks for the new password, the token is appended to it.
+	link       string
+	ttl        time.Duration
+	perAddress *security.RateLimiter
+	perIP      *security.RateLimiter
+}
+
+func NewPasswordResetUseCase(
+	resets entity.PasswordResetRepository,
+	users entity.UserRepository,
+	sessions *SessionUseCase,
+	auth *AuthUseCase,
+	sender mail.Sender,
+	link string,
+	ttl time.Duration,
+	perHour int,
+) *PasswordResetUseCase {
+	return &PasswordResetUseCase{
+		resets:     resets,
+		users:      users,
+		sessions:   sessions,
+		auth:       auth,
+		sender:     sender,
+		link:       link,
+		ttl:        ttl,
+		perAddress: security.NewRateLimiter(1, passwordResetInterval),
+		perIP:      security.NewRateLimiter(perHour, time.Hour),
+	}
+}
+
+// Forgot emails a reset link. Whether the address is registered is not
+// reported, and the email is sent in the background so that the time to
+// answer does not tell either.
+func (p *PasswordResetUseCase) Forgot(tenant string, email string, ip string) error {
+	if !p.perIP.Allow(ip) {
+		return ErrTooManyRequests
+	}
+	user, err := p.users.GetByEmail(tenant, email)
+	if err != nil {
+		if errors.Is(err, entity.NotFoundUser) {
+			return nil
+		}
+		return err
+	}
+	if !p.perAddress.Allow(user.Email) {
+		return nil
+	}
+
+	now := time.Now()
+	if err := p.resets.DeleteExpired(now); err != nil {
+		return err
+	}
+	token := auth.RandomString(32)
+	reset := entity.PasswordReset{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Tenant:    tenant,
+		CreatedAt: now,
+		ExpiresAt: now.Add(p.ttl),
+	}
+	if err := p.resets.Create(reset); err != nil {
+		return err
+	}
+
+	go p.send(user, mail.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf(
+			"Здравствуйте, %s!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+				"Ссылка действительна до %s. Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n",
+			user.Name,
+			p.link+"?token="+url.QueryEscape(token),
+			reset.ExpiresAt.Format("02.01.2006 15:04 MST"),
+		),
+	})
+	return nil
+}
+
+// Reset sets the new password. Every session of the user ends, wherever
+// it was signed in.
+func (p *PasswordResetUseCase) Reset(token string, password string) error {
+	reset, err := p.resets.GetByHash(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, entity.ErrPasswordResetNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if reset.UsedAt != nil || !time.Now().Before(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	fresh, err := p.resets.MarkUsed(reset.TokenHash, time.Now())
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidResetToken
+	}
+
+	user, err := p.users.GetByID(reset.Tenant, reset.UserID)
+	if err != nil {
+		if errors.Is(err, entity.NotFoundUser) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	user.Password = password
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+	if err := p.users.UpdatePassword(user.ID, user.Password); err != nil {
+		return err
+	}
+	// Following the link proved the address belongs to the user
+	if !user.EmailVerified {
+		if _, err := p.users.VerifyEmail(user.ID, user.Email); err != nil {
+			return err
+		}
+	}
+	if err := p.resets.DeleteByUser(user.ID); err != nil {
+		return err
+	}
+	if err := p.sessions.RevokeAll(user.ID); err != nil {
+		return err
+	}
+
+	p.auth.notifier.Notify(fmt.Sprintf("Password reset: user %d (%s) in tenant %s", user.ID, user.Email, reset.Tenant))
+	go p.send(user, mail.Message{
+		To:      user.Email,
+		Subject: "Пароль изменен",
+		Body: fmt.Sprintf(
+			"Здравствуйте, %s!\n\nПароль вашей учетной записи был изменен, все сеансы завершены.\n"+
+				"Если это были не вы, немедленно восстановите доступ и свяжитесь с поддержкой.\n",
+			user.Name,
+		),
+	})
+	return nil
+}
+
+func (p *PasswordResetUseCase) send(user entity.User, msg mail.Message) {
+	if err := p.sender.Send(msg); err != nil {
+		log.Printf("Password reset email to user %d: %v", user.ID, err)
+	}
+}
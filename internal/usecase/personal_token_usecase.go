@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PersonalTokenPrefix starts every personal access token, so that secret
+// scanners can tell them from other strings.
+const PersonalTokenPrefix = "jwtpat_"
+
+const (
+	DefaultPersonalTokenTTL = 30 * 24 * time.Hour
+	MaxPersonalTokenTTL     = 366 * 24 * time.Hour
+	// maxPersonalTokens limits the tokens of a user.
+	maxPersonalTokens = 50
+	// personalTokenTouchInterval limits how often a use of a token is written down.
+	personalTokenTouchInterval = time.Minute
+)
+
+var (
+	ErrInvalidPersonalToken  = errors.New("Невалидный или просроченный токен доступа")
+	ErrPersonalTokenScope    = errors.New("Токену нельзя дать права, которых нет у пользователя")
+	ErrPersonalTokenTTL      = errors.New("Срок действия токена должен быть не больше года")
+	ErrPersonalTokenName     = errors.New("Не указано название токена")
+	ErrTooManyPersonalTokens = errors.New("Слишком много токенов доступа")
+	// ErrPersonalTokenNotAllowed is for what needs a login, not a token.
+	ErrPersonalTokenNotAllowed = errors.New("Действие недоступно с токеном доступа, войдите в аккаунт")
+)
+
+// PersonalTokenUseCase manages the personal access tokens users script the
+// API with. A token acts for its user in the tenant it was created in, with
+// the roles the user holds at the time of each request, limited to the
+// token's scopes.
+type PersonalTokenUseCase struct {
+	tokens entity.PersonalTokenRepository
+	users  entity.UserRepository
+	roles  *RoleUseCase
+	issuer string
+}
+
+func NewPersonalTokenUseCase(
+	tokens entity.PersonalTokenRepository,
+	users entity.UserRepository,
+	roles *RoleUseCase,
+	issuer string,
+) *PersonalTokenUseCase {
+	return &PersonalTokenUseCase{tokens, users, roles, issuer}
+}
+
+// CreatedPersonalToken is a new token. Token is only ever shown here.
+type CreatedPersonalToken struct {
+	entity.PersonalToken
+	Token string `json:"token"`
+}
+
+func (p *PersonalTokenUseCase) List(userID int) ([]entity.PersonalToken, error) {
+	return p.tokens.GetByUser(userID)
+}
+
+// Create issues a token. Its scopes are permissions the user holds in the
+// tenant; a ttl of zero is DefaultPersonalTokenTTL.
+func (p *PersonalTokenUseCase) Create(
+	tenant string,
+	userID int,
+	name string,
+	scopes []string,
+	ttl time.Duration,
+) (CreatedPersonalToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return CreatedPersonalToken{}, ErrPersonalTokenName
+	}
+	if ttl == 0 {
+		ttl = DefaultPersonalTokenTTL
+	}
+	if ttl < 0 || ttl > MaxPersonalTokenTTL {
+		return CreatedPersonalToken{}, ErrPersonalTokenTTL
+	}
+
+	roles, err := p.roles.TenantRoles(tenant, userID)
+	if err != nil {
+		return CreatedPersonalToken{}, err
+	}
+	var granted []string
+	for _, scope := range scopes {
+		if !p.roles.Grants(roles, scope) {
+			return CreatedPersonalToken{}, ErrPersonalTokenScope
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	now := time.Now()
+	if err := p.tokens.DeleteExpired(now); err != nil {
+		return CreatedPersonalToken{}, err
+	}
+	existing, err := p.tokens.GetByUser(userID)
+	if err != nil {
+		return CreatedPersonalToken{}, err
+	}
+	if len(existing) >= maxPersonalTokens {
+		return CreatedPersonalToken{}, ErrTooManyPersonalTokens
+	}
+
+	secret := PersonalTokenPrefix + auth.RandomString(32)
+	token := entity.PersonalToken{
+		ID:        auth.RandomString(12),
+		UserID:    userID,
+		Tenant:    tenant,
+		Name:      name,
+		Hint:      secret[:len(PersonalTokenPrefix)+4],
+		TokenHash: auth.HashToken(secret),
+		Scopes:    granted,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+	if err := p.tokens.Create(token); err != nil {
+		return CreatedPersonalToken{}, err
+	}
+	return CreatedPersonalToken{PersonalToken: token, Token: secret}, nil
+}
+
+func (p *PersonalTokenUseCase) Delete(userID int, id string) error {
+	return p.tokens.Delete(userID, id)
+}
+
+// RevokeAll deletes every token of the user.
+func (p *PersonalTokenUseCase) RevokeAll(userID int) error {
+	return p.tokens.DeleteByUser(userID)
+}
+
+// IsPersonalToken tells the tokens apart from JWTs.
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix)
+}
+
+// Validate returns the claims the token stands for, as if it were an access
+// token: the roles are those the user holds now, and the scope limits them.
+func (p *PersonalTokenUseCase) Validate(secret string) (*auth.Claims, error) {
+	if !IsPersonalToken(secret) {
+		return nil, ErrInvalidPersonalToken
+	}
+	token, err := p.tokens.GetByHash(auth.HashToken(secret))
+	if err != nil {
+		if errors.Is(err, entity.ErrPersonalTokenNotFound) {
+			return nil, ErrInvalidPersonalToken
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if !now.Before(token.ExpiresAt) {
+		return nil, ErrInvalidPersonalToken
+	}
+	// The user may have left the tenant since
+	user, err := p.users.GetByID(token.Tenant, token.UserID)
+	if err != nil {
+		if errors.Is(err, entity.NotFoundUser) {
+			return nil, ErrInvalidPersonalToken
+		}
+		return nil, err
+	}
+	roles, err := p.roles.TenantRoles(token.Tenant, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= personalTokenTouchInterval {
+		if err := p.tokens.Touch(token.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	return &auth.Claims{
+		Email:         user.Email,
+		TokenUse:      auth.TokenUsePersonalAccess,
+		Scope:         strings.Join(token.Scopes, " "),
+		Tenant:        token.Tenant,
+		Roles:         roles,
+		EmailVerified: &user.EmailVerified,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        token.ID,
+			Issuer:    p.issuer,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(token.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
+		},
+	}, nil
+}
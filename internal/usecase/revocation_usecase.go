@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type revocationKey struct {
+	kind  entity.RevocationKind
+	value string
+}
+
+// RevocationUseCase answers "is this access token revoked" from memory. Every
+// revocation is written through to the repository, and the cache is reloaded
+// from it on every sweep so that revocations made by other instances show up.
+type RevocationUseCase struct {
+	repo  entity.RevocationRepository
+	lock  sync.RWMutex
+	cache map[revocationKey]entity.Revocation
+}
+
+func NewRevocationUseCase(repo entity.RevocationRepository) (*RevocationUseCase, error) {
+	r := &RevocationUseCase{repo: repo}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// IsRevoked checks the token's jti, its session, its user and its client.
+func (r *RevocationUseCase) IsRevoked(claims *auth.Claims) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if len(r.cache) == 0 {
+		return false
+	}
+	if _, ok := r.cache[revocationKey{entity.RevokeToken, claims.ID}]; ok && claims.ID != "" {
+		return true
+	}
+	if _, ok := r.cache[revocationKey{entity.RevokeSession, claims.SessionID}]; ok && claims.SessionID != "" {
+		return true
+	}
+	if revocation, ok := r.cache[revocationKey{entity.RevokeClient, claims.ClientID}]; ok && claims.ClientID != "" {
+		if issuedBefore(claims, revocation) {
+			return true
+		}
+	}
+	if claims.IsClient() {
+		return false
+	}
+	if revocation, ok := r.cache[revocationKey{entity.RevokeUser, claims.Subject}]; ok && issuedBefore(claims, revocation) {
+		return true
+	}
+	if revocation, ok := r.cache[revocationKey{entity.RevokeMember, memberKey(claims.Tenant, claims.Subject)}]; ok {
+		return issuedBefore(claims, revocation)
+	}
+	return false
+}
+
+// issuedBefore reports whether the token predates the revocation. IssuedAt
+// only has whole seconds, so a token from the second of the revocation is
+// treated as revoked too.
+func issuedBefore(claims *auth.Claims, revocation entity.Revocation) bool {
+	return claims.IssuedAt == nil || !claims.IssuedAt.After(revocation.RevokedAt.Truncate(time.Second))
+}
+
+// RevokeToken revokes a single access token until it expires.
+func (r *RevocationUseCase) RevokeToken(jti string, expiresAt time.Time) error {
+	return r.save(entity.RevokeToken, jti, expiresAt)
+}
+
+func (r *RevocationUseCase) RevokeSession(sessionID string) error {
+	return r.save(entity.RevokeSession, sessionID, time.Now().Add(AccessTokenTTL))
+}
+
+// RevokeUser revokes every access token issued to the user so far.
+func (r *RevocationUseCase) RevokeUser(userID int) error {
+	return r.save(entity.RevokeUser, strconv.Itoa(userID), time.Now().Add(AccessTokenTTL))
+}
+
+// RevokeMember revokes the access tokens issued to the user in the tenant so
+// far, and leaves those of its other tenants alone.
+func (r *RevocationUseCase) RevokeMember(tenant string, userID int) error {
+	return r.save(entity.RevokeMember, memberKey(tenant, strconv.Itoa(userID)), time.Now().Add(AccessTokenTTL))
+}
+
+func memberKey(tenant string, subject string) string {
+	return tenant + "/" + subject
+}
+
+// RevokeClient revokes every access token issued to the client so far.
+func (r *RevocationUseCase) RevokeClient(clientID string) error {
+	return r.save(entity.RevokeClient, clientID, time.Now().Add(AccessTokenTTL))
+}
+
+// RunSweeper drops expired revocations every interval until ctx is done,
+// along with whatever else expires, such as old sessions.
+func (r *RevocationUseCase) RunSweeper(ctx context.Context, interval time.Duration, sweeps ...func(now time.Time) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			for _, sweep := range sweeps {
+				if err := sweep(now); err != nil {
+					log.Printf("Sweep failed: %v", err)
+				}
+			}
+			if _, err := r.repo.DeleteExpired(now); err != nil {
+				log.Printf("Revocation sweep failed: %v", err)
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Printf("Revocation reload failed: %v", err)
+			}
+		}
+	}
+}
+
+func (r *RevocationUseCase) save(kind entity.RevocationKind, value string, expiresAt time.Time) error {
+	revocation := entity.Revocation{
+		Kind:      kind,
+		Value:     value,
+		RevokedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := r.repo.Save(revocation); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := revocationKey{kind, value}
+	if existing, ok := r.cache[key]; ok && existing.ExpiresAt.After(revocation.ExpiresAt) {
+		revocation.ExpiresAt = existing.ExpiresAt
+	}
+	r.cache[key] = revocation
+	return nil
+}
+
+func (r *RevocationUseCase) reload() error {
+	started := time.Now()
+	revocations, err := r.repo.ListActive(started)
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[revocationKey]entity.Revocation, len(revocations))
+	for _, revocation := range revocations {
+		cache[revocationKey{revocation.Kind, revocation.Value}] = revocation
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// Keep revocations saved while the list was being loaded
+	for key, revocation := range r.cache {
+		if !revocation.RevokedAt.Before(started) {
+			cache[key] = revocation
+		}
+	}
+	r.cache = cache
+	return nil
+}
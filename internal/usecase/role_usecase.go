@@ -0,0 +1,266 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidRole = errors.New("Невалидное имя роли")
+
+// defaultRoles are created at first startup.
+var defaultRoles = []entity.Role{
+	{Name: entity.RoleAdmin, Description: "Полный доступ", Permissions: []string{"*"}},
+	{
+		Name:        entity.RoleSupport,
+		Description: "Служба поддержки",
+		Permissions: []string{entity.PermUsersRead, entity.PermUsersImpersonate},
+	},
+}
+
+// RoleUseCase manages roles and answers permission checks from an in-memory
+// copy of the role table, refreshed on every change.
+type RoleUseCase struct {
+	repo        entity.RoleRepository
+	revocations *RevocationUseCase
+	// bootstrap maps an email to the roles it is granted on every login
+	bootstrap map[string][]string
+
+	lock  sync.RWMutex
+	roles map[string]entity.Role
+}
+
+// NewRoleUseCase seeds the default roles. The bootstrap emails get their
+// roles the next time tokens are issued for them, so the first admin only has
+// to be listed in the config and log in.
+func NewRoleUseCase(repo entity.RoleRepository, revocations *RevocationUseCase, bootstrap map[string][]string) (*RoleUseCase, error) {
+	r := &RoleUseCase{repo: repo, revocations: revocations, bootstrap: map[string][]string{}}
+	for email, roles := range bootstrap {
+		r.bootstrap[strings.ToLower(email)] = roles
+	}
+
+	for _, role := range defaultRoles {
+		if _, err := repo.GetByName(role.Name); err == nil {
+			continue
+		} else if !errors.Is(err, entity.ErrRoleNotFound) {
+			return nil, err
+		}
+		if err := repo.Save(role); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RoleUseCase) List() ([]entity.Role, error) {
+	return r.repo.GetAll()
+}
+
+func (r *RoleUseCase) Save(role entity.Role) error {
+	if role.Name == "" || strings.ContainsAny(role.Name, " \t\n") {
+		return ErrInvalidRole
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	if err := r.repo.Save(role); err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+func (r *RoleUseCase) Delete(name string) error {
+	if name == entity.RoleAdmin {
+		return entity.ErrRoleProtected
+	}
+	if err := r.repo.Delete(name); err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+func (r *RoleUseCase) UserRoles(userID int) ([]string, error) {
+	return r.repo.GetUserRoles(userID)
+}
+
+func (r *RoleUseCase) Assign(userID int, role string) error {
+	if _, err := r.repo.GetByName(role); err != nil {
+		return err
+	}
+	_, err := r.repo.Assign(userID, role)
+	return err
+}
+
+// Unassign takes the role away. The user's access tokens still carry it, so
+// they are revoked; a refresh picks up the new set of roles.
+func (r *RoleUseCase) Unassign(userID int, role string) error {
+	if err := r.repo.Unassign(userID, role); err != nil {
+		return err
+	}
+	return r.revocations.RevokeUser(userID)
+}
+
+func (r *RoleUseCase) MemberRoles(tenant string, userID int) ([]string, error) {
+	return r.repo.GetMemberRoles(tenant, userID)
+}
+
+// AssignMember grants the role within one organization only.
+func (r *RoleUseCase) AssignMember(tenant string, userID int, role string) error {
+	if _, err := r.repo.GetByName(role); err != nil {
+		return err
+	}
+	_, err := r.repo.AssignMember(tenant, userID, role)
+	return err
+}
+
+func (r *RoleUseCase) UnassignMember(tenant string, userID int, role string) error {
+	if err := r.repo.UnassignMember(tenant, userID, role); err != nil {
+		return err
+	}
+	return r.revocations.RevokeUser(userID)
+}
+
+// TenantRoles are the roles the user holds in the tenant: its global roles
+// and those of its membership.
+func (r *RoleUseCase) TenantRoles(tenant string, userID int) ([]string, error) {
+	global, err := r.repo.GetUserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+	member, err := r.repo.GetMemberRoles(tenant, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := global
+	for _, role := range member {
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles, nil
+}
+
+// rolesFor returns the roles to put in the user's tokens, granting the
+// bootstrap roles from the config first. Those are global roles, so only the
+// default tenant's user with the email gets them, and only once the email is
+// verified: anyone can sign up with that email in another tenant, or before
+// its owner does.
+func (r *RoleUseCase) rolesFor(tenant string, user entity.User) ([]string, error) {
+	if tenant == entity.DefaultTenant && user.EmailVerified {
+		for _, role := range r.bootstrap[strings.ToLower(user.Email)] {
+			if _, err := r.repo.Assign(user.ID, role); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r.TenantRoles(tenant, user.ID)
+}
+
+// HasPermission checks the roles claim of a token. A token issued to a client
+// is limited by its scope as well: a third party acting for an admin only gets
+// what the admin consented to. So is a personal access token.
+func (r *RoleUseCase) HasPermission(claims *auth.Claims, permission string) bool {
+	if claims.IsClient() {
+		return auth.HasScope(claims.Scope, permission)
+	}
+	if (claims.ClientID != "" || claims.IsPersonalAccess()) && !auth.HasScope(claims.Scope, permission) {
+		return false
+	}
+	return r.Grants(claims.Roles, permission)
+}
+
+// HasPlatformPermission is HasPermission for what all tenants share, such as
+// clients and role definitions. Roles held within an organization do not
+// count: only the global roles the token carries.
+func (r *RoleUseCase) HasPlatformPermission(claims *auth.Claims, permission string) (bool, error) {
+	if !r.HasPermission(claims, permission) {
+		return false, nil
+	}
+	if claims.IsClient() {
+		return true, nil
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return false, nil
+	}
+	global, err := r.repo.GetUserRoles(id)
+	if err != nil {
+		return false, err
+	}
+
+	var roles []string
+	for _, role := range global {
+		if slices.Contains(claims.Roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return r.Grants(roles, permission), nil
+}
+
+// Permissions lists what the token may do, in the same terms HasPermission
+// uses: the role permissions (wildcards included) of a first-party token, the
+// scopes of a client token, and for a token issued to a client on behalf of
+// a user or a personal access token, the scopes its roles allow.
+func (r *RoleUseCase) Permissions(claims *auth.Claims) []string {
+	scopes := strings.Fields(claims.Scope)
+	if claims.IsClient() {
+		return scopes
+	}
+	if claims.ClientID != "" || claims.IsPersonalAccess() {
+		permissions := []string{}
+		for _, scope := range scopes {
+			if r.Grants(claims.Roles, scope) {
+				permissions = append(permissions, scope)
+			}
+		}
+		return permissions
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	permissions := []string{}
+	for _, name := range claims.Roles {
+		permissions = append(permissions, r.roles[name].Permissions...)
+	}
+	return permissions
+}
+
+// Grants reports whether any of the roles includes the permission.
+func (r *RoleUseCase) Grants(roles []string, permission string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, name := range roles {
+		if role, ok := r.roles[name]; ok && role.Grants(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RoleUseCase) reload() error {
+	roles, err := r.repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[string]entity.Role, len(roles))
+	for _, role := range roles {
+		cache[role.Name] = role
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.roles = cache
+	return nil
+}
@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/saml"
+	"errors"
+	"time"
+)
+
+var (
+	ErrAssertionReplayed = errors.New("SAML утверждение уже было использовано")
+	ErrIdPInitiatedLogin = errors.New("Вход, начатый провайдером SAML, не разрешен")
+)
+
+// SAMLProvider is an upstream SAML identity provider as configured.
+type SAMLProvider struct {
+	ID                     string `json:"id"`
+	Name                   string `json:"name"`
+	*saml.IdentityProvider `json:"-"`
+	// Tenant is where the logins the provider starts itself sign in to.
+	Tenant            string `json:"-"`
+	AllowIdPInitiated bool   `json:"-"`
+	// EmailAttribute and NameAttribute name the attributes the user is made
+	// of. Without an email attribute the NameID is the email, provided its
+	// format says so.
+	EmailAttribute string `json:"-"`
+	NameAttribute  string `json:"-"`
+}
+
+// SAMLUseCase signs users in with SAML identity providers, in logins started
+// here or at the provider. The accounts are linked to users as with OpenID
+// Connect providers.
+type SAMLUseCase struct {
+	sp         *saml.ServiceProvider
+	providers  map[string]SAMLProvider
+	byEntityID map[string]SAMLProvider
+	order      []SAMLProvider
+	states     entity.FederationStateRepository
+	replays    entity.AssertionReplayRepository
+	identities entity.IdentityRepository
+	users      entity.UserRepository
+}
+
+func NewSAMLUseCase(
+	sp *saml.ServiceProvider,
+	providers []SAMLProvider,
+	states entity.FederationStateRepository,
+	replays entity.AssertionReplayRepository,
+	identities entity.IdentityRepository,
+	users entity.UserRepository,
+) *SAMLUseCase {
+	byID := map[string]SAMLProvider{}
+	byEntityID := map[string]SAMLProvider{}
+	for _, provider := range providers {
+		byID[provider.ID] = provider
+		byEntityID[provider.EntityID] = provider
+	}
+	return &SAMLUseCase{sp, byID, byEntityID, providers, states, replays, identities, users}
+}
+
+// Metadata is the metadata of the service provider.
+func (s *SAMLUseCase) Metadata() ([]byte, error) {
+	return s.sp.Metadata()
+}
+
+// Providers lists the providers for the login page.
+func (s *SAMLUseCase) Providers() []SAMLProvider {
+	return s.order
+}
+
+// Begin returns the URL to send the browser to. The AuthnRequest is kept by
+// the RelayState, which the provider posts back with the response.
+func (s *SAMLUseCase) Begin(providerID string, tenant string) (string, error) {
+	provider, ok := s.providers[providerID]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	now := time.Now()
+	if err := s.states.DeleteExpired(now); err != nil {
+		return "", err
+	}
+	relayState := auth.RandomString(32)
+	requestID := "_" + auth.RandomString(20)
+	url, err := s.sp.AuthnRequestURL(provider.IdentityProvider, requestID, relayState)
+	if err != nil {
+		return "", err
+	}
+	err = s.states.Create(entity.FederationState{
+		StateHash: auth.HashToken(relayState),
+		Provider:  samlIdentityProvider(provider.ID),
+		Tenant:    tenant,
+		Nonce:     requestID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(FederationTimeout),
+	})
+	if err != nil {
+		return "", err
+	}
+	return url, nil
+}
+
+// Finish consumes the response posted to the ACS and returns the user to
+// sign in, with the tenant they sign in to.
+func (s *SAMLUseCase) Finish(encoded string, relayState string) (entity.User, string, error) {
+	response, err := saml.ParseResponse(encoded)
+	if err != nil {
+		return entity.User{}, "", err
+	}
+	provider, ok := s.byEntityID[response.Issuer]
+	if !ok {
+		return entity.User{}, "", ErrUnknownProvider
+	}
+
+	requestID, tenant, err := s.request(provider, relayState, response.InResponseTo)
+	if err != nil {
+		return entity.User{}, "", err
+	}
+	assertion, err := s.sp.Validate(response, provider.IdentityProvider, requestID)
+	if err != nil {
+		return entity.User{}, "", err
+	}
+
+	if err := s.replays.DeleteExpired(time.Now()); err != nil {
+		return entity.User{}, "", err
+	}
+	fresh, err := s.replays.Remember(provider.EntityID, assertion.ID, assertion.ExpiresAt)
+	if err != nil {
+		return entity.User{}, "", err
+	}
+	if !fresh {
+		return entity.User{}, "", ErrAssertionReplayed
+	}
+
+	email := assertion.Attribute(provider.EmailAttribute)
+	if provider.EmailAttribute == "" && assertion.NameIDFormat == saml.NameIDFormatEmail {
+		email = assertion.NameID
+	}
+	// The provider is trusted with the addresses of its users, as configured
+	user, err := linkAccount(s.identities, s.users, samlIdentityProvider(provider.ID), tenant, externalAccount{
+		Subject:       assertion.NameID,
+		Email:         email,
+		EmailVerified: email != "",
+		Name:          assertion.Attribute(provider.NameAttribute),
+	})
+	if err != nil {
+		return entity.User{}, "", err
+	}
+	return user, tenant, nil
+}
+
+// request finds the AuthnRequest the response answers by the RelayState.
+// Without one it is a login the provider started, if that is allowed; such
+// a login may come with a RelayState of its own, which is not ours.
+func (s *SAMLUseCase) request(provider SAMLProvider, relayState string, inResponseTo string) (string, string, error) {
+	if relayState != "" {
+		stored, err := s.states.Take(auth.HashToken(relayState))
+		switch {
+		case err == nil:
+			if stored.Provider != samlIdentityProvider(provider.ID) || !time.Now().Before(stored.ExpiresAt) {
+				return "", "", ErrInvalidFederation
+			}
+			return stored.Nonce, stored.Tenant, nil
+		case !errors.Is(err, entity.ErrFederationStateNotFound):
+			return "", "", err
+		}
+	}
+	if inResponseTo != "" {
+		return "", "", ErrInvalidFederation
+	}
+	if !provider.AllowIdPInitiated {
+		return "", "", ErrIdPInitiatedLogin
+	}
+	return "", provider.Tenant, nil
+}
+
+// samlIdentityProvider keeps the SAML providers apart from the OpenID
+// Connect ones in the federation tables.
+func samlIdentityProvider(id string) string {
+	return "saml:" + id
+}
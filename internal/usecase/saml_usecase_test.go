@@ -0,0 +1,343 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/repository"
+	"JWT/pkg/saml"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	testSPEntityID  = "https://login.example.com/v1/saml/metadata"
+	testACSURL      = "https://login.example.com/v1/saml/acs"
+	testIdPEntityID = "https://idp.example.com/saml"
+)
+
+// testIdP is a SAML identity provider with a certificate of its own.
+type testIdP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdP{key, cert}
+}
+
+// samlAssertion is what the provider asserts; the tests change it to break
+// one condition at a time.
+type samlAssertion struct {
+	ID           string
+	InResponseTo string
+	NameID       string
+	Recipient    string
+	Audience     string
+	NotOnOrAfter time.Time
+}
+
+func validAssertion(inResponseTo string, email string) samlAssertion {
+	return samlAssertion{
+		ID:           "_a" + time.Now().Format("150405.000000000"),
+		InResponseTo: inResponseTo,
+		NameID:       email,
+		Recipient:    testACSURL,
+		Audience:     testSPEntityID,
+		NotOnOrAfter: time.Now().Add(5 * time.Minute),
+	}
+}
+
+func (i *testIdP) assertion(a samlAssertion) *etree.Element {
+	format := func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+	now := time.Now()
+
+	el := etree.NewElement("saml:Assertion")
+	el.CreateAttr("xmlns:saml", "urn:oasis:names:tc:SAML:2.0:assertion")
+	el.CreateAttr("ID", a.ID)
+	el.CreateAttr("Version", "2.0")
+	el.CreateAttr("IssueInstant", format(now))
+	el.CreateElement("saml:Issuer").SetText(testIdPEntityID)
+
+	subject := el.CreateElement("saml:Subject")
+	nameID := subject.CreateElement("saml:NameID")
+	nameID.CreateAttr("Format", saml.NameIDFormatEmail)
+	nameID.SetText(a.NameID)
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", "urn:oasis:names:tc:SAML:2.0:cm:bearer")
+	data := confirmation.CreateElement("saml:SubjectConfirmationData")
+	data.CreateAttr("Recipient", a.Recipient)
+	data.CreateAttr("NotOnOrAfter", format(a.NotOnOrAfter))
+	if a.InResponseTo != "" {
+		data.CreateAttr("InResponseTo", a.InResponseTo)
+	}
+
+	conditions := el.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", format(now.Add(-time.Minute)))
+	conditions.CreateAttr("NotOnOrAfter", format(a.NotOnOrAfter))
+	conditions.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(a.Audience)
+
+	statement := el.CreateElement("saml:AuthnStatement")
+	statement.CreateAttr("AuthnInstant", format(now))
+	statement.CreateAttr("SessionIndex", "session-1")
+	attribute := el.CreateElement("saml:AttributeStatement").CreateElement("saml:Attribute")
+	attribute.CreateAttr("Name", "displayName")
+	attribute.CreateElement("saml:AttributeValue").SetText("SAML User")
+	return el
+}
+
+func (i *testIdP) sign(t *testing.T, el *etree.Element) *etree.Element {
+	t.Helper()
+	ctx := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore{
+		PrivateKey:  i.key,
+		Certificate: [][]byte{i.cert.Raw},
+	})
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed, err := ctx.SignEnveloped(el)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// response wraps the assertions in a response posted by the browser.
+func (i *testIdP) response(t *testing.T, inResponseTo string, assertions ...*etree.Element) string {
+	t.Helper()
+	response := etree.NewElement("samlp:Response")
+	response.CreateAttr("xmlns:samlp", "urn:oasis:names:tc:SAML:2.0:protocol")
+	response.CreateAttr("xmlns:saml", "urn:oasis:names:tc:SAML:2.0:assertion")
+	response.CreateAttr("ID", "_r"+time.Now().Format("150405.000000000"))
+	response.CreateAttr("Version", "2.0")
+	response.CreateAttr("IssueInstant", time.Now().UTC().Format(time.RFC3339))
+	response.CreateAttr("Destination", testACSURL)
+	if inResponseTo != "" {
+		response.CreateAttr("InResponseTo", inResponseTo)
+	}
+	response.CreateElement("saml:Issuer").SetText(testIdPEntityID)
+	response.CreateElement("samlp:Status").
+		CreateElement("samlp:StatusCode").
+		CreateAttr("Value", "urn:oasis:names:tc:SAML:2.0:status:Success")
+	for _, assertion := range assertions {
+		response.AddChild(assertion)
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(response)
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func newTestSAMLUseCase(db *sql.DB, idp *testIdP, allowIdPInitiated bool) *SAMLUseCase {
+	return NewSAMLUseCase(
+		&saml.ServiceProvider{EntityID: testSPEntityID, ACSURL: testACSURL},
+		[]SAMLProvider{{
+			ID:   "idp",
+			Name: "IdP",
+			IdentityProvider: &saml.IdentityProvider{
+				EntityID:     testIdPEntityID,
+				SSOURL:       "https://idp.example.com/saml/sso",
+				Certificates: []*x509.Certificate{idp.cert},
+			},
+			Tenant:            entity.DefaultTenant,
+			AllowIdPInitiated: allowIdPInitiated,
+			NameAttribute:     "displayName",
+		}},
+		repository.NewFederationStateRepository(db),
+		repository.NewAssertionReplayRepository(db),
+		repository.NewIdentityRepository(db),
+		repository.NewUserRepository(db),
+	)
+}
+
+// beginSAML starts a login and returns the RelayState and the ID of the
+// AuthnRequest the provider is sent.
+func beginSAML(t *testing.T, s *SAMLUseCase) (string, string) {
+	t.Helper()
+	redirect, err := s.Begin("idp", entity.DefaultTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	deflated, err := base64.StdEncoding.DecodeString(query.Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request struct {
+		ID string `xml:"ID,attr"`
+	}
+	if err := xml.Unmarshal(data, &request); err != nil {
+		t.Fatal(err)
+	}
+	return query.Get("RelayState"), request.ID
+}
+
+func TestSAMLLoginWithSignedAssertion(t *testing.T) {
+	db := openTestDB(t)
+	idp := newTestIdP(t)
+	s := newTestSAMLUseCase(db, idp, false)
+	relayState, requestID := beginSAML(t, s)
+	assertion := idp.sign(t, idp.assertion(validAssertion(requestID, "saml@example.com")))
+
+	user, tenant, err := s.Finish(idp.response(t, requestID, assertion), relayState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant != entity.DefaultTenant || user.Email != "saml@example.com" || user.Name != "SAML User" {
+		t.Errorf("signed in %+v to %q", user, tenant)
+	}
+	if _, err := repository.NewUserRepository(db).GetByEmail(entity.DefaultTenant, "saml@example.com"); err != nil {
+		t.Errorf("user was not created: %v", err)
+	}
+}
+
+func TestSAMLRejectsWrappedAssertions(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		assertions func(t *testing.T, idp *testIdP, signed *etree.Element) []*etree.Element
+		want       error
+	}{
+		{"forged assertion before the signed one", func(t *testing.T, idp *testIdP, signed *etree.Element) []*etree.Element {
+			forged := signed.Copy()
+			forged.FindElement("./Subject/NameID").SetText("victim@example.com")
+			forged.RemoveChild(forged.FindElement("./Signature"))
+			return []*etree.Element{forged, signed}
+		}, saml.ErrInvalidResponse},
+		{"second signed assertion", func(t *testing.T, idp *testIdP, signed *etree.Element) []*etree.Element {
+			second := validAssertion("", "victim@example.com")
+			second.ID += "-2"
+			return []*etree.Element{signed, idp.sign(t, idp.assertion(second))}
+		}, saml.ErrInvalidResponse},
+		{"tampered signed assertion", func(t *testing.T, idp *testIdP, signed *etree.Element) []*etree.Element {
+			signed.FindElement("./Subject/NameID").SetText("victim@example.com")
+			return []*etree.Element{signed}
+		}, saml.ErrInvalidSignature},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			idp := newTestIdP(t)
+			s := newTestSAMLUseCase(db, idp, false)
+			relayState, requestID := beginSAML(t, s)
+			signed := idp.sign(t, idp.assertion(validAssertion(requestID, "saml@example.com")))
+
+			encoded := idp.response(t, requestID, tt.assertions(t, idp, signed)...)
+			if _, _, err := s.Finish(encoded, relayState); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if _, err := repository.NewUserRepository(db).GetByEmail(entity.DefaultTenant, "victim@example.com"); !errors.Is(err, entity.NotFoundUser) {
+				t.Errorf("forged user: %v", err)
+			}
+		})
+	}
+}
+
+func TestSAMLRejectsInvalidConditions(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(a *samlAssertion)
+	}{
+		{"other audience", func(a *samlAssertion) { a.Audience = "https://other.example.com" }},
+		{"other recipient", func(a *samlAssertion) { a.Recipient = "https://other.example.com/acs" }},
+		{"expired", func(a *samlAssertion) { a.NotOnOrAfter = time.Now().Add(-5 * time.Minute) }},
+		{"other request", func(a *samlAssertion) { a.InResponseTo = "_other" }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			idp := newTestIdP(t)
+			s := newTestSAMLUseCase(db, idp, false)
+			relayState, requestID := beginSAML(t, s)
+			claims := validAssertion(requestID, "saml@example.com")
+			tt.change(&claims)
+
+			encoded := idp.response(t, requestID, idp.sign(t, idp.assertion(claims)))
+			if _, _, err := s.Finish(encoded, relayState); !errors.Is(err, saml.ErrInvalidAssertion) {
+				t.Fatalf("got %v, want %v", err, saml.ErrInvalidAssertion)
+			}
+		})
+	}
+}
+
+func TestSAMLRejectsReplayedAssertions(t *testing.T) {
+	t.Run("idp initiated", func(t *testing.T) {
+		idp := newTestIdP(t)
+		s := newTestSAMLUseCase(openTestDB(t), idp, true)
+		assertion := idp.sign(t, idp.assertion(validAssertion("", "saml@example.com")))
+		encoded := idp.response(t, "", assertion)
+
+		if _, _, err := s.Finish(encoded, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.Finish(encoded, ""); !errors.Is(err, ErrAssertionReplayed) {
+			t.Fatalf("got %v, want %v", err, ErrAssertionReplayed)
+		}
+	})
+
+	t.Run("sp initiated", func(t *testing.T) {
+		idp := newTestIdP(t)
+		s := newTestSAMLUseCase(openTestDB(t), idp, true)
+		relayState, requestID := beginSAML(t, s)
+		assertion := idp.sign(t, idp.assertion(validAssertion(requestID, "saml@example.com")))
+		encoded := idp.response(t, requestID, assertion)
+
+		if _, _, err := s.Finish(encoded, relayState); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.Finish(encoded, relayState); !errors.Is(err, ErrInvalidFederation) {
+			t.Fatalf("got %v, want %v", err, ErrInvalidFederation)
+		}
+	})
+}
+
+func TestSAMLRejectsIdPInitiatedLoginUnlessAllowed(t *testing.T) {
+	idp := newTestIdP(t)
+	s := newTestSAMLUseCase(openTestDB(t), idp, false)
+	assertion := idp.sign(t, idp.assertion(validAssertion("", "saml@example.com")))
+
+	_, _, err := s.Finish(idp.response(t, "", assertion), "")
+	if !errors.Is(err, ErrIdPInitiatedLogin) {
+		t.Fatalf("got %v, want %v", err, ErrIdPInitiatedLogin)
+	}
+}
@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"time"
+)
+
+type SessionUseCase struct {
+	sessions    entity.SessionRepository
+	tokens      entity.RefreshTokenRepository
+	revocations *RevocationUseCase
+}
+
+func NewSessionUseCase(
+	sessions entity.SessionRepository,
+	tokens entity.RefreshTokenRepository,
+	revocations *RevocationUseCase,
+) *SessionUseCase {
+	return &SessionUseCase{sessions, tokens, revocations}
+}
+
+func (s *SessionUseCase) List(userID int) ([]entity.Session, error) {
+	return s.sessions.ListActive(userID, time.Now())
+}
+
+// Revoke ends one of the user's sessions and invalidates its refresh and
+// access tokens.
+func (s *SessionUseCase) Revoke(userID int, sessionID string) error {
+	session, err := s.sessions.GetByID(sessionID)
+	if err != nil {
+		return err
+	}
+	// Do not reveal sessions of other users
+	if session.UserID != userID {
+		return entity.ErrSessionNotFound
+	}
+
+	if err := s.sessions.Revoke(session.ID); err != nil {
+		return err
+	}
+	if err := s.tokens.RevokeFamily(session.ID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeSession(session.ID)
+}
+
+func (s *SessionUseCase) RevokeAll(userID int) error {
+	sessions, err := s.sessions.ListActive(userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := s.sessions.RevokeAll(userID); err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := s.tokens.RevokeFamily(session.ID); err != nil {
+			return err
+		}
+	}
+	return s.revocations.RevokeUser(userID)
+}
+
+// DeleteExpired drops the sessions that can no longer be refreshed, and the
+// refresh tokens past their expiry. Sessions go first: they are found by
+// their refresh tokens.
+func (s *SessionUseCase) DeleteExpired(now time.Time) error {
+	if err := s.sessions.DeleteExpired(now); err != nil {
+		return err
+	}
+	return s.tokens.DeleteExpired(now)
+}
@@ -0,0 +1,343 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	// TokenTypeUserID is specific to this service: the subject_token is a user
+	// ID and the actor_token of a support agent is required.
+	TokenTypeUserID = "urn:jwt-golang:params:oauth:token-type:user_id"
+
+	AuditDelegation    = "token_exchange.delegation"
+	AuditImpersonation = "token_exchange.impersonation"
+)
+
+type TokenExchangeRequest struct {
+	SubjectToken       string `form:"subject_token"`
+	SubjectTokenType   string `form:"subject_token_type"`
+	ActorToken         string `form:"actor_token"`
+	ActorTokenType     string `form:"actor_token_type"`
+	Scope              string `form:"scope"`
+	Audience           string `form:"audience"`
+	RequestedTokenType string `form:"requested_token_type"`
+}
+
+// ImpersonationPolicy decides who may impersonate whom within a tenant.
+type ImpersonationPolicy interface {
+	CanImpersonate(tenant string, actor entity.User, subject entity.User) (bool, error)
+}
+
+// RoleImpersonationPolicy lets users with the users:impersonate permission
+// impersonate users whose roles they hold themselves, both counted in the
+// tenant. Impersonating another impersonator, or yourself, is never allowed.
+type RoleImpersonationPolicy struct {
+	roles *RoleUseCase
+}
+
+func NewRoleImpersonationPolicy(roles *RoleUseCase) *RoleImpersonationPolicy {
+	return &RoleImpersonationPolicy{roles}
+}
+
+func (p *RoleImpersonationPolicy) CanImpersonate(tenant string, actor entity.User, subject entity.User) (bool, error) {
+	if actor.ID == subject.ID {
+		return false, nil
+	}
+	actorRoles, err := p.roles.TenantRoles(tenant, actor.ID)
+	if err != nil {
+		return false, err
+	}
+	subjectRoles, err := p.roles.TenantRoles(tenant, subject.ID)
+	if err != nil {
+		return false, err
+	}
+	if !p.roles.Grants(actorRoles, entity.PermUsersImpersonate) ||
+		p.roles.Grants(subjectRoles, entity.PermUsersImpersonate) {
+		return false, nil
+	}
+
+	held := map[string]bool{}
+	for _, role := range actorRoles {
+		held[role] = true
+	}
+	for _, role := range subjectRoles {
+		if !held[role] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// TokenExchangeUseCase implements RFC 8693. Delegation narrows a user's token
+// for a downstream service; impersonation lets support staff act as a user.
+// Either way the result names the acting party in its act claim and every
+// attempt ends up in the audit trail.
+type TokenExchangeUseCase struct {
+	auth   *AuthUseCase
+	users  entity.UserRepository
+	policy ImpersonationPolicy
+	audit  *AuditUseCase
+}
+
+func NewTokenExchangeUseCase(
+	authUseCase *AuthUseCase,
+	users entity.UserRepository,
+	policy ImpersonationPolicy,
+	audit *AuditUseCase,
+) *TokenExchangeUseCase {
+	return &TokenExchangeUseCase{authUseCase, users, policy, audit}
+}
+
+func (t *TokenExchangeUseCase) Exchange(client entity.Client, request TokenExchangeRequest, ip string) (auth.TokenResponse, string, error) {
+	event := entity.AuditEvent{Action: AuditDelegation, ClientID: client.ID, IP: ip}
+	tokens, scope, err := t.exchange(client, request, &event)
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) {
+			event.Outcome = entity.AuditDenied
+			event.Details = oauthErr.Error()
+			if err := t.audit.Record(event); err != nil {
+				return auth.TokenResponse{}, "", err
+			}
+		}
+		return auth.TokenResponse{}, "", err
+	}
+
+	event.Outcome = entity.AuditGranted
+	if scope != "" {
+		event.Details = "scope: " + scope
+	}
+	if err := t.audit.Record(event); err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	return tokens, scope, nil
+}
+
+func (t *TokenExchangeUseCase) exchange(client entity.Client, request TokenExchangeRequest, event *entity.AuditEvent) (auth.TokenResponse, string, error) {
+	if client.Public {
+		return auth.TokenResponse{}, "", oauthError("unauthorized_client", "public clients may not exchange tokens")
+	}
+	if request.RequestedTokenType != "" && request.RequestedTokenType != TokenTypeAccessToken {
+		return auth.TokenResponse{}, "", oauthError("invalid_request", "only access tokens can be requested")
+	}
+	if request.SubjectToken == "" {
+		return auth.TokenResponse{}, "", oauthError("invalid_request", "subject_token is required")
+	}
+
+	var actor *auth.Claims
+	if request.ActorToken != "" {
+		if !isAccessTokenType(request.ActorTokenType) {
+			return auth.TokenResponse{}, "", oauthError("invalid_request", "unsupported actor_token_type")
+		}
+		claims, err := t.auth.ValidateAccessToken(request.ActorToken)
+		if err != nil {
+			return auth.TokenResponse{}, "", oauthError("invalid_grant", "invalid actor_token")
+		}
+		actor = claims
+		event.ActorID = claims.Subject
+	}
+
+	switch {
+	case isAccessTokenType(request.SubjectTokenType):
+		return t.delegate(client, request, actor, event)
+	case request.SubjectTokenType == TokenTypeUserID:
+		event.Action = AuditImpersonation
+		return t.impersonate(client, request, actor, event)
+	default:
+		return auth.TokenResponse{}, "", oauthError("invalid_request", "unsupported subject_token_type")
+	}
+}
+
+// delegate narrows the subject token. The acting party is the actor token's
+// subject or, without one, the client itself.
+func (t *TokenExchangeUseCase) delegate(
+	client entity.Client,
+	request TokenExchangeRequest,
+	actor *auth.Claims,
+	event *entity.AuditEvent,
+) (auth.TokenResponse, string, error) {
+	subject, err := t.auth.ValidateAccessToken(request.SubjectToken)
+	if err != nil {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "invalid subject_token")
+	}
+	event.SubjectID = subject.Subject
+	if subject.IsClient() {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "subject_token must belong to a user")
+	}
+
+	act := &auth.Actor{Subject: client.ID, ClientID: client.ID, Actor: subject.Actor}
+	if actor != nil {
+		act.Subject = actor.Subject
+	}
+	if event.ActorID == "" {
+		event.ActorID = client.ID
+	}
+
+	scope, err := narrowScope(request.Scope, strings.Fields(subject.Scope), client)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+
+	user, err := t.subjectUser(subject.Tenant, subject.Subject)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	tokens, err := t.sign(user, subject.Tenant, client, act, subject.SessionID, scope, request.Audience, subject.ExpiresAt)
+	return tokens, scope, err
+}
+
+// impersonate issues a token for the user named in subject_token to the
+// support agent presenting actor_token, if the policy allows it.
+func (t *TokenExchangeUseCase) impersonate(
+	client entity.Client,
+	request TokenExchangeRequest,
+	actor *auth.Claims,
+	event *entity.AuditEvent,
+) (auth.TokenResponse, string, error) {
+	event.SubjectID = request.SubjectToken
+	if actor == nil {
+		return auth.TokenResponse{}, "", oauthError("invalid_request", "actor_token is required for impersonation")
+	}
+	if actor.IsClient() {
+		return auth.TokenResponse{}, "", oauthError("invalid_grant", "actor_token must belong to a user")
+	}
+
+	// Only users of the agent's own tenant can be impersonated
+	agent, err := t.subjectUser(actor.Tenant, actor.Subject)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	user, err := t.subjectUser(actor.Tenant, request.SubjectToken)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	allowed, err := t.policy.CanImpersonate(actor.Tenant, agent, user)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+	if !allowed {
+		return auth.TokenResponse{}, "", oauthError("access_denied", fmt.Sprintf("user %d may not impersonate user %d", agent.ID, user.ID))
+	}
+
+	scope, err := narrowScope(request.Scope, nil, client)
+	if err != nil {
+		return auth.TokenResponse{}, "", err
+	}
+
+	// The token lives in the agent's session: logging out ends the impersonation.
+	act := &auth.Actor{Subject: actor.Subject, ClientID: client.ID, Actor: actor.Actor}
+	tokens, err := t.sign(user, actor.Tenant, client, act, actor.SessionID, scope, request.Audience, actor.ExpiresAt)
+	return tokens, scope, err
+}
+
+func (t *TokenExchangeUseCase) subjectUser(tenant string, subject string) (entity.User, error) {
+	id, err := strconv.Atoi(subject)
+	if err != nil {
+		return entity.User{}, oauthError("invalid_grant", "unknown subject")
+	}
+	user, err := t.users.GetByID(tenant, id)
+	if err != nil {
+		return entity.User{}, oauthError("invalid_grant", "unknown subject")
+	}
+	return user, nil
+}
+
+// sign issues the exchanged access token. It never outlives the token it was
+// exchanged from.
+func (t *TokenExchangeUseCase) sign(
+	user entity.User,
+	tenant string,
+	client entity.Client,
+	act *auth.Actor,
+	sessionID string,
+	scope string,
+	audience string,
+	notAfter *jwt.NumericDate,
+) (auth.TokenResponse, error) {
+	now := time.Now()
+	expireAt := now.Add(AccessTokenTTL)
+	if notAfter != nil && notAfter.Before(expireAt) {
+		expireAt = notAfter.Time
+	}
+
+	roles, err := t.auth.roles.TenantRoles(tenant, user.ID)
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+
+	claims := &auth.Claims{
+		Email:     user.Email,
+		Tenant:    tenant,
+		Roles:     roles,
+		TokenUse:  auth.TokenUseAccess,
+		SessionID: sessionID,
+		Scope:     scope,
+		ClientID:  client.ID,
+		Actor:     act,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        auth.RandomString(16),
+			Issuer:    t.auth.issuerFor(tenant),
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expireAt),
+		},
+	}
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+
+	accessToken, err := t.auth.signer.Sign(claims)
+	if err != nil {
+		return auth.TokenResponse{}, fmt.Errorf("Ошибка генерации access токена: %w", err)
+	}
+	return auth.TokenResponse{AccessToken: accessToken, ExpiresAt: expireAt.Unix()}, nil
+}
+
+// narrowScope checks the requested scope against what may be granted: the
+// subject token's scope, if there is one, and the client's registered scopes.
+// A client without registered scopes passes on the subject token's scope; a
+// nil subject scope (impersonation) is only limited by the client, so such a
+// client gets nothing. Without a requested scope everything allowed is granted.
+func narrowScope(requested string, subject []string, client entity.Client) (string, error) {
+	allowed := func(scope string) bool {
+		if subject == nil {
+			return client.AllowsScopes([]string{scope})
+		}
+		if !auth.HasScope(strings.Join(subject, " "), scope) {
+			return false
+		}
+		return len(client.Scopes) == 0 || client.AllowsScopes([]string{scope})
+	}
+
+	requested = normalizeScope(requested)
+	if requested == "" {
+		var granted []string
+		for _, scope := range subject {
+			if allowed(scope) {
+				granted = append(granted, scope)
+			}
+		}
+		return strings.Join(granted, " "), nil
+	}
+
+	for _, scope := range strings.Fields(requested) {
+		if !allowed(scope) {
+			return "", oauthError("invalid_scope", "requested scope exceeds the subject_token or the client")
+		}
+	}
+	return requested, nil
+}
+
+func isAccessTokenType(tokenType string) bool {
+	return tokenType == TokenTypeAccessToken || tokenType == TokenTypeJWT
+}
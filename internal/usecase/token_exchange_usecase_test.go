@@ -0,0 +1,183 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/repository"
+	"strconv"
+	"testing"
+)
+
+func TestRoleImpersonationPolicy(t *testing.T) {
+	db := openTestDB(t)
+	a := newStoredAuthUseCase(t, db, &recordingNotifier{})
+	users := repository.NewUserRepository(db)
+	roles := a.roles
+	if err := roles.Save(entity.Role{Name: "editor", Permissions: []string{entity.PermUsersRead}}); err != nil {
+		t.Fatal(err)
+	}
+	orgs := NewOrganizationUseCase(repository.NewOrganizationRepository(db), roles, a.revocations)
+	if err := orgs.Save(entity.Organization{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+
+	user := func(email string, globalRoles ...string) entity.User {
+		t.Helper()
+		created := createTestUser(t, users, email, true)
+		for _, role := range globalRoles {
+			if err := roles.Assign(created.ID, role); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return created
+	}
+	agent := user("agent@example.com", entity.RoleSupport)
+	otherAgent := user("other-agent@example.com", entity.RoleSupport)
+	editingAgent := user("editing-agent@example.com", entity.RoleSupport, "editor")
+	admin := user("admin@example.com", entity.RoleAdmin)
+	editor := user("editor@example.com", "editor")
+	plain := user("plain@example.com")
+	acmeAgent := user("acme-agent@example.com")
+	if err := roles.AssignMember("acme", acmeAgent.ID, entity.RoleSupport); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := NewRoleImpersonationPolicy(roles)
+	for _, tt := range []struct {
+		name           string
+		tenant         string
+		actor, subject entity.User
+		want           bool
+	}{
+		{"agent and user without roles", entity.DefaultTenant, agent, plain, true},
+		{"agent and user with roles the agent holds", entity.DefaultTenant, editingAgent, editor, true},
+		{"agent and user with roles the agent lacks", entity.DefaultTenant, agent, editor, false},
+		{"agent and themselves", entity.DefaultTenant, agent, agent, false},
+		{"agent and another agent", entity.DefaultTenant, agent, otherAgent, false},
+		{"agent and admin", entity.DefaultTenant, agent, admin, false},
+		{"admin and agent", entity.DefaultTenant, admin, agent, false},
+		{"user without the permission", entity.DefaultTenant, editor, plain, false},
+		{"agent of the tenant", "acme", acmeAgent, plain, true},
+		{"agent of another tenant", entity.DefaultTenant, acmeAgent, plain, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.CanImpersonate(tt.tenant, tt.actor, tt.subject)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNarrowScope(t *testing.T) {
+	scoped := entity.Client{Scopes: []string{"read", "write"}}
+	readOnly := entity.Client{Scopes: []string{"read"}}
+	unscoped := entity.Client{}
+
+	for _, tt := range []struct {
+		name      string
+		requested string
+		subject   []string
+		client    entity.Client
+		want      string
+		wantErr   bool
+	}{
+		{"everything the subject and client allow", "", []string{"read", "write", "admin"}, readOnly, "read", false},
+		{"everything the subject has without client scopes", "", []string{"read", "write"}, unscoped, "read write", false},
+		{"part of the subject scope", "read", []string{"read", "write"}, scoped, "read", false},
+		{"duplicates", " read  read ", []string{"read"}, scoped, "read", false},
+		{"more than the subject has", "write", []string{"read"}, scoped, "", true},
+		{"more than the client may have", "write", []string{"read", "write"}, readOnly, "", true},
+		{"subject token without scope", "read", []string{}, scoped, "", true},
+		{"impersonation within the client scopes", "write", nil, scoped, "write", false},
+		{"impersonation beyond the client scopes", "write", nil, readOnly, "", true},
+		{"impersonation through a client without scopes", "read", nil, unscoped, "", true},
+		{"impersonation without a requested scope", "", nil, scoped, "", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := narrowScope(tt.requested, tt.subject, tt.client)
+			if tt.wantErr {
+				if oauthErrorCode(err) != "invalid_scope" {
+					t.Fatalf("got %q, %v, want invalid_scope", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImpersonationIsAudited(t *testing.T) {
+	db := openTestDB(t)
+	a := newStoredAuthUseCase(t, db, &recordingNotifier{})
+	users := repository.NewUserRepository(db)
+	audit := NewAuditUseCase(repository.NewAuditRepository(db))
+	exchange := NewTokenExchangeUseCase(a, users, NewRoleImpersonationPolicy(a.roles), audit)
+	client := entity.Client{ID: "support-console", Scopes: []string{"read"}}
+
+	agent := createTestUser(t, users, "agent@example.com", true)
+	if err := a.roles.Assign(agent.ID, entity.RoleSupport); err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, users, "user@example.com", true)
+	agentTokens, err := a.IssueTokens(agent, entity.Device{}, entity.Grant{Tenant: entity.DefaultTenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userTokens, err := a.IssueTokens(user, entity.Device{}, entity.Grant{Tenant: entity.DefaultTenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(actorToken string, subject entity.User) TokenExchangeRequest {
+		return TokenExchangeRequest{
+			SubjectToken:     strconv.Itoa(subject.ID),
+			SubjectTokenType: TokenTypeUserID,
+			ActorToken:       actorToken,
+			ActorTokenType:   TokenTypeAccessToken,
+			Scope:            "read",
+		}
+	}
+
+	tokens, _, err := exchange.Exchange(client, request(agentTokens.AccessToken, user), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := a.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != strconv.Itoa(user.ID) || claims.Actor == nil || claims.Actor.Subject != strconv.Itoa(agent.ID) {
+		t.Errorf("impersonation token for %s acting as %+v", claims.Subject, claims.Actor)
+	}
+
+	// The user may not turn the tables
+	if _, _, err := exchange.Exchange(client, request(userTokens.AccessToken, agent), "192.0.2.2"); oauthErrorCode(err) != "access_denied" {
+		t.Fatalf("got %v, want access_denied", err)
+	}
+
+	events, err := audit.List(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[entity.AuditOutcome]entity.AuditEvent{
+		entity.AuditGranted: {ActorID: strconv.Itoa(agent.ID), SubjectID: strconv.Itoa(user.ID), IP: "192.0.2.1"},
+		entity.AuditDenied:  {ActorID: strconv.Itoa(user.ID), SubjectID: strconv.Itoa(agent.ID), IP: "192.0.2.2"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d audit events, want %d", len(events), len(want))
+	}
+	for _, event := range events {
+		expected := want[event.Outcome]
+		if event.Action != AuditImpersonation || event.ClientID != client.ID ||
+			event.ActorID != expected.ActorID || event.SubjectID != expected.SubjectID || event.IP != expected.IP {
+			t.Errorf("audit event %+v", event)
+		}
+	}
+}
@@ -3,33 +3,35 @@ package usecase
 import "JWT/internal/entity"
 
 type UserUseCase struct {
-	repo entity.UserRepository
+	repo        entity.UserRepository
+	revocations *RevocationUseCase
 }
 
-func NewUserUseCase(repo entity.UserRepository) *UserUseCase {
-	return &UserUseCase{repo}
+func NewUserUseCase(repo entity.UserRepository, revocations *RevocationUseCase) *UserUseCase {
+	return &UserUseCase{repo, revocations}
 }
 
-func (u *UserUseCase) GetAll() ([]entity.User, error) {
-	return u.repo.GetAll()
+func (u *UserUseCase) GetAll(tenant string) ([]entity.User, error) {
+	return u.repo.GetAll(tenant)
 }
 
-func (u *UserUseCase) GetUserByID(id int) (entity.User, error) {
-	return u.repo.GetByID(id)
+func (u *UserUseCase) GetUserByID(tenant string, id int) (entity.User, error) {
+	return u.repo.GetByID(tenant, id)
 }
 
-func (u *UserUseCase) GetUserByEmail(email string) (entity.User, error) {
-	return u.repo.GetByEmail(email)
+func (u *UserUseCase) GetUserByEmail(tenant string, email string) (entity.User, error) {
+	return u.repo.GetByEmail(tenant, email)
 }
 
-func (u *UserUseCase) DeleteUser(id int) error {
-	return u.repo.Delete(id)
+// DeleteUser removes the user from the tenant and revokes its tokens there.
+// Its other tenants are left alone.
+func (u *UserUseCase) DeleteUser(tenant string, id int) error {
+	if err := u.repo.Delete(tenant, id); err != nil {
+		return err
+	}
+	return u.revocations.RevokeMember(tenant, id)
 }
 
-func (u *UserUseCase) CreateUser(user entity.User) (entity.User, error) {
-	return u.repo.Create(user)
-}
-
-func (u *UserUseCase) Login(user entity.User, refresh string) error {
-	return u.repo.Login(user, refresh)
+func (u *UserUseCase) CreateUser(tenant string, user entity.User) (entity.User, error) {
+	return u.repo.Create(tenant, user)
 }
@@ -0,0 +1,278 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/pkg/auth"
+	"JWT/pkg/webauthn"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WebAuthnTimeout is how long a ceremony may take, from the options to the response.
+const WebAuthnTimeout = 5 * time.Minute
+
+var (
+	ErrInvalidCredential = errors.New("Невалидный ответ ключа доступа")
+	ErrCredentialCloned  = errors.New("Счетчик подписей ключа доступа не увеличился")
+)
+
+// WebAuthnUseCase registers passkeys and security keys and signs users in
+// with them instead of a password.
+type WebAuthnUseCase struct {
+	rp          *webauthn.RelyingParty
+	credentials entity.CredentialRepository
+	challenges  entity.WebAuthnChallengeRepository
+	users       entity.UserRepository
+	auth        *AuthUseCase
+}
+
+func NewWebAuthnUseCase(
+	rp *webauthn.RelyingParty,
+	credentials entity.CredentialRepository,
+	challenges entity.WebAuthnChallengeRepository,
+	users entity.UserRepository,
+	auth *AuthUseCase,
+) *WebAuthnUseCase {
+	return &WebAuthnUseCase{rp, credentials, challenges, users, auth}
+}
+
+func (w *WebAuthnUseCase) List(userID int) ([]entity.Credential, error) {
+	return w.credentials.GetByUser(userID)
+}
+
+func (w *WebAuthnUseCase) Delete(userID int, id string) error {
+	return w.credentials.Delete(userID, id)
+}
+
+// BeginRegistration returns the options for navigator.credentials.create().
+func (w *WebAuthnUseCase) BeginRegistration(tenant string, userID int) (webauthn.CreationOptions, error) {
+	user, err := w.users.GetByID(tenant, userID)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+	exclude, err := w.descriptors(userID)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+	challenge, err := w.newChallenge(entity.CeremonyRegistration, tenant, &userID)
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+	return w.rp.CreationOptions(challenge, webauthn.UserEntity{
+		ID:          userHandle(userID),
+		Name:        user.Email,
+		DisplayName: user.Name,
+	}, exclude, WebAuthnTimeout.Milliseconds()), nil
+}
+
+// FinishRegistration verifies the new credential and stores it.
+func (w *WebAuthnUseCase) FinishRegistration(userID int, name string, response webauthn.RegistrationResponse) (entity.Credential, error) {
+	if response.Type != "public-key" {
+		return entity.Credential{}, ErrInvalidCredential
+	}
+	challenge, err := w.takeChallenge(response.Response.ClientDataJSON, entity.CeremonyRegistration)
+	if err != nil {
+		return entity.Credential{}, err
+	}
+	if challenge.UserID == nil || *challenge.UserID != userID {
+		return entity.Credential{}, entity.ErrChallengeNotFound
+	}
+
+	registered, err := w.rp.VerifyRegistration(
+		challenge.Challenge,
+		response.Response.ClientDataJSON,
+		response.Response.AttestationObject,
+		false,
+	)
+	if err != nil {
+		return entity.Credential{}, err
+	}
+	if !bytes.Equal(registered.ID, response.RawID) {
+		return entity.Credential{}, ErrInvalidCredential
+	}
+
+	if name == "" {
+		name = "Ключ доступа"
+	}
+	credential := entity.Credential{
+		ID:          webauthn.Encoding.EncodeToString(registered.ID),
+		UserID:      userID,
+		Name:        name,
+		PublicKey:   registered.PublicKey,
+		SignCount:   registered.SignCount,
+		AAGUID:      formatAAGUID(registered.AAGUID),
+		Transports:  response.Response.Transports,
+		Attestation: registered.Format,
+		CreatedAt:   time.Now(),
+	}
+	if err := w.credentials.Create(credential); err != nil {
+		return entity.Credential{}, err
+	}
+	return credential, nil
+}
+
+// BeginLogin returns the options for navigator.credentials.get(). With an
+// email only the credentials of that user are allowed, otherwise the
+// authenticator offers its passkeys. An unknown email is not revealed.
+func (w *WebAuthnUseCase) BeginLogin(tenant string, email string) (webauthn.RequestOptions, error) {
+	var (
+		userID *int
+		allow  = []webauthn.CredentialDescriptor{}
+	)
+	if email != "" {
+		user, err := w.users.GetByEmail(tenant, email)
+		if err != nil && !errors.Is(err, entity.NotFoundUser) {
+			return webauthn.RequestOptions{}, err
+		}
+		if err == nil {
+			userID = &user.ID
+			if allow, err = w.descriptors(user.ID); err != nil {
+				return webauthn.RequestOptions{}, err
+			}
+		}
+	}
+
+	challenge, err := w.newChallenge(entity.CeremonyLogin, tenant, userID)
+	if err != nil {
+		return webauthn.RequestOptions{}, err
+	}
+	return w.rp.RequestOptions(challenge, allow, WebAuthnTimeout.Milliseconds()), nil
+}
+
+// FinishLogin verifies the assertion and issues the tokens of a /v1/login.
+// User verification is required, so a second factor is not asked for.
+func (w *WebAuthnUseCase) FinishLogin(
+	response webauthn.AssertionResponse,
+	scope string,
+	nonce string,
+	device entity.Device,
+) (auth.TokenResponse, error) {
+	if response.Type != "public-key" {
+		return auth.TokenResponse{}, ErrInvalidCredential
+	}
+	challenge, err := w.takeChallenge(response.Response.ClientDataJSON, entity.CeremonyLogin)
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+	grant, err := FirstPartyGrant(challenge.Tenant, scope, nonce)
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+
+	credential, err := w.credentials.GetByID(webauthn.Encoding.EncodeToString(response.RawID))
+	if err != nil {
+		if errors.Is(err, entity.ErrCredentialNotFound) {
+			return auth.TokenResponse{}, ErrInvalidCredential
+		}
+		return auth.TokenResponse{}, err
+	}
+	if challenge.UserID != nil && *challenge.UserID != credential.UserID {
+		return auth.TokenResponse{}, ErrInvalidCredential
+	}
+	if len(response.Response.UserHandle) > 0 && !bytes.Equal(response.Response.UserHandle, userHandle(credential.UserID)) {
+		return auth.TokenResponse{}, ErrInvalidCredential
+	}
+
+	// The credential belongs to the user, the tenant must still have them
+	user, err := w.users.GetByID(challenge.Tenant, credential.UserID)
+	if err != nil {
+		if errors.Is(err, entity.NotFoundUser) {
+			return auth.TokenResponse{}, ErrInvalidCredential
+		}
+		return auth.TokenResponse{}, err
+	}
+
+	assertion, err := w.rp.VerifyAssertion(
+		challenge.Challenge,
+		credential.PublicKey,
+		response.Response.ClientDataJSON,
+		response.Response.AuthenticatorData,
+		response.Response.Signature,
+		true,
+	)
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+	advanced, err := w.credentials.UpdateSignCount(credential.ID, assertion.SignCount, time.Now())
+	if err != nil {
+		return auth.TokenResponse{}, err
+	}
+	if !advanced {
+		w.auth.notifier.Notify(fmt.Sprintf("Possible cloned authenticator: credential %s of user %d", credential.ID, credential.UserID))
+		return auth.TokenResponse{}, ErrCredentialCloned
+	}
+
+	return w.auth.IssueTokens(user, device, grant)
+}
+
+func (w *WebAuthnUseCase) newChallenge(ceremony entity.WebAuthnCeremony, tenant string, userID *int) (string, error) {
+	now := time.Now()
+	if err := w.challenges.DeleteExpired(now); err != nil {
+		return "", err
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	err = w.challenges.Create(entity.WebAuthnChallenge{
+		Challenge: challenge,
+		Ceremony:  ceremony,
+		Tenant:    tenant,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(WebAuthnTimeout),
+	})
+	return challenge, err
+}
+
+// takeChallenge finds the ceremony the response answers. Whatever the
+// outcome, the challenge can not be answered again.
+func (w *WebAuthnUseCase) takeChallenge(clientDataJSON []byte, ceremony entity.WebAuthnCeremony) (entity.WebAuthnChallenge, error) {
+	value, err := webauthn.ChallengeOf(clientDataJSON)
+	if err != nil {
+		return entity.WebAuthnChallenge{}, err
+	}
+	challenge, err := w.challenges.Take(value)
+	if err != nil {
+		return entity.WebAuthnChallenge{}, err
+	}
+	if challenge.Ceremony != ceremony || !time.Now().Before(challenge.ExpiresAt) {
+		return entity.WebAuthnChallenge{}, entity.ErrChallengeNotFound
+	}
+	return challenge, nil
+}
+
+func (w *WebAuthnUseCase) descriptors(userID int) ([]webauthn.CredentialDescriptor, error) {
+	credentials, err := w.credentials.GetByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		id, err := webauthn.Encoding.DecodeString(credential.ID)
+		if err != nil {
+			return nil, err
+		}
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         id,
+			Transports: credential.Transports,
+		})
+	}
+	return descriptors, nil
+}
+
+// userHandle identifies the user to the authenticator without revealing the email.
+func userHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", aaguid[0:4], aaguid[4:6], aaguid[6:8], aaguid[8:10], aaguid[10:16])
+}
@@ -0,0 +1,300 @@
+package usecase
+
+import (
+	"JWT/internal/entity"
+	"JWT/internal/repository"
+	"JWT/pkg/webauthn"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const (
+	testRPID   = "login.example.com"
+	testOrigin = "https://login.example.com"
+)
+
+// softAuthenticator is a security key in software. It answers the options of
+// the relying party the way a browser and an authenticator would together,
+// from the origin and for the RP ID it is told.
+type softAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	aaguid    []byte
+	origin    string
+	rpID      string
+	signCount uint32
+	userID    []byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{
+		key:    key,
+		id:     id,
+		aaguid: []byte("soft-authentic8r"),
+		origin: testOrigin,
+		rpID:   testRPID,
+	}
+}
+
+func (s *softAuthenticator) create(t *testing.T, options webauthn.CreationOptions) webauthn.RegistrationResponse {
+	t.Helper()
+	s.userID = options.User.ID
+	clientDataJSON := s.clientData(t, "webauthn.create", options.Challenge)
+
+	// COSE_Key of an ES256 credential
+	x, y := make([]byte, 32), make([]byte, 32)
+	s.key.X.FillBytes(x)
+	s.key.Y.FillBytes(y)
+	publicKey := cborMap(
+		cborInt(1), cborInt(2),
+		cborInt(3), cborInt(webauthn.AlgES256),
+		cborInt(-1), cborInt(1),
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	)
+	authData := s.authData(webauthn.FlagUserPresent | webauthn.FlagUserVerified | webauthn.FlagAttestedData)
+	authData = append(authData, s.aaguid...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(s.id)))
+	authData = append(authData, s.id...)
+	authData = append(authData, publicKey...)
+
+	// Packed self attestation
+	attestationObject := cborMap(
+		cborText("fmt"), cborText("packed"),
+		cborText("attStmt"), cborMap(
+			cborText("alg"), cborInt(webauthn.AlgES256),
+			cborText("sig"), cborBytes(s.sign(t, authData, clientDataJSON)),
+		),
+		cborText("authData"), cborBytes(authData),
+	)
+
+	var response webauthn.RegistrationResponse
+	response.ID = webauthn.Encoding.EncodeToString(s.id)
+	response.RawID = s.id
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = clientDataJSON
+	response.Response.AttestationObject = attestationObject
+	response.Response.Transports = []string{"usb"}
+	return response
+}
+
+func (s *softAuthenticator) get(t *testing.T, options webauthn.RequestOptions) webauthn.AssertionResponse {
+	t.Helper()
+	s.signCount++
+	clientDataJSON := s.clientData(t, "webauthn.get", options.Challenge)
+	authData := s.authData(webauthn.FlagUserPresent | webauthn.FlagUserVerified)
+
+	var response webauthn.AssertionResponse
+	response.ID = webauthn.Encoding.EncodeToString(s.id)
+	response.RawID = s.id
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = clientDataJSON
+	response.Response.AuthenticatorData = authData
+	response.Response.Signature = s.sign(t, authData, clientDataJSON)
+	response.Response.UserHandle = s.userID
+	return response
+}
+
+func (s *softAuthenticator) clientData(t *testing.T, ceremony string, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      s.origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (s *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(s.rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, s.signCount)
+}
+
+func (s *softAuthenticator) sign(t *testing.T, authData []byte, clientDataJSON []byte) []byte {
+	t.Helper()
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+// The little CBOR an authenticator writes: definite lengths only.
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func cborInt(n int64) []byte {
+	if n < 0 {
+		return cborHead(1, uint64(-1-n))
+	}
+	return cborHead(0, uint64(n))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap takes the encoded keys and values in turn.
+func cborMap(items ...[]byte) []byte {
+	out := cborHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func newTestWebAuthnUseCase(t *testing.T, db *sql.DB, notifier Notifier) *WebAuthnUseCase {
+	t.Helper()
+	return NewWebAuthnUseCase(
+		&webauthn.RelyingParty{ID: testRPID, Name: "Test", Origins: []string{testOrigin}},
+		repository.NewCredentialRepository(db),
+		repository.NewWebAuthnChallengeRepository(db),
+		repository.NewUserRepository(db),
+		newStoredAuthUseCase(t, db, notifier),
+	)
+}
+
+func registerPasskey(t *testing.T, w *WebAuthnUseCase, user entity.User, authenticator *softAuthenticator) (entity.Credential, error) {
+	t.Helper()
+	options, err := w.BeginRegistration(entity.DefaultTenant, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.FinishRegistration(user.ID, "Ключ", authenticator.create(t, options))
+}
+
+func loginWithPasskey(t *testing.T, w *WebAuthnUseCase, user entity.User, authenticator *softAuthenticator) error {
+	t.Helper()
+	options, err := w.BeginLogin(entity.DefaultTenant, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := w.FinishLogin(authenticator.get(t, options), "", "", entity.Device{})
+	if err == nil && tokens.AccessToken == "" {
+		t.Fatal("login issued no access token")
+	}
+	return err
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	db := openTestDB(t)
+	w := newTestWebAuthnUseCase(t, db, &recordingNotifier{})
+	user := createTestUser(t, repository.NewUserRepository(db), "passkey@example.com", true)
+	authenticator := newSoftAuthenticator(t)
+
+	credential, err := registerPasskey(t, w, user, authenticator)
+	if err != nil {
+		t.Fatalf("registration: %v", err)
+	}
+	if credential.ID != webauthn.Encoding.EncodeToString(authenticator.id) || credential.Attestation != "packed" {
+		t.Errorf("registered %+v", credential)
+	}
+	if credential.AAGUID != formatAAGUID(authenticator.aaguid) {
+		t.Errorf("AAGUID %q", credential.AAGUID)
+	}
+
+	for i := range 2 {
+		if err := loginWithPasskey(t, w, user, authenticator); err != nil {
+			t.Fatalf("login %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestWebAuthnLoginRejectsSignCountRegression(t *testing.T) {
+	db := openTestDB(t)
+	notifier := &recordingNotifier{}
+	w := newTestWebAuthnUseCase(t, db, notifier)
+	user := createTestUser(t, repository.NewUserRepository(db), "passkey@example.com", true)
+	authenticator := newSoftAuthenticator(t)
+	if _, err := registerPasskey(t, w, user, authenticator); err != nil {
+		t.Fatal(err)
+	}
+	authenticator.signCount = 10
+	if err := loginWithPasskey(t, w, user, authenticator); err != nil {
+		t.Fatal(err)
+	}
+
+	// A clone of the key still counts from where it was copied
+	authenticator.signCount = 5
+	if err := loginWithPasskey(t, w, user, authenticator); !errors.Is(err, ErrCredentialCloned) {
+		t.Fatalf("got %v, want %v", err, ErrCredentialCloned)
+	}
+	if len(notifier.messages) != 1 {
+		t.Errorf("notifications: %q", notifier.messages)
+	}
+}
+
+func TestWebAuthnRejectsOtherOriginsAndRPs(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		origin string
+		rpID   string
+		want   error
+	}{
+		{"origin", "https://evil.example.com", testRPID, webauthn.ErrInvalidClientData},
+		{"rp id", testOrigin, "evil.example.com", webauthn.ErrInvalidAuthData},
+	} {
+		t.Run("registration from another "+tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			w := newTestWebAuthnUseCase(t, db, &recordingNotifier{})
+			user := createTestUser(t, repository.NewUserRepository(db), "passkey@example.com", true)
+			authenticator := newSoftAuthenticator(t)
+			authenticator.origin, authenticator.rpID = tt.origin, tt.rpID
+
+			if _, err := registerPasskey(t, w, user, authenticator); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+
+		t.Run("login from another "+tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			w := newTestWebAuthnUseCase(t, db, &recordingNotifier{})
+			user := createTestUser(t, repository.NewUserRepository(db), "passkey@example.com", true)
+			authenticator := newSoftAuthenticator(t)
+			if _, err := registerPasskey(t, w, user, authenticator); err != nil {
+				t.Fatal(err)
+			}
+			authenticator.origin, authenticator.rpID = tt.origin, tt.rpID
+
+			if err := loginWithPasskey(t, w, user, authenticator); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -4,15 +4,75 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var SECRET_KEY = []byte("bsdicuy2389[aSKLCNVWI")
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+	// TokenUseMFAPending is only good for completing a login with a second factor.
+	TokenUseMFAPending = "mfa_pending"
+	// TokenUseEmailVerification is sent in the link that verifies an email.
+	TokenUseEmailVerification = "email_verification"
+	// TokenUsePersonalAccess is set on the claims of a personal access token,
+	// which is not a JWT itself.
+	TokenUsePersonalAccess = "personal_access"
+	// TokenUseAPIKey is set on the claims of an API key, which acts as a
+	// client of its own.
+	TokenUseAPIKey = "api_key"
+)
 
 type Claims struct {
-	Email string `json:"email"`
+	Email    string `json:"email,omitempty"`
+	TokenUse string `json:"token_use,omitempty"`
+	// FamilyID groups every refresh token descended from a single login.
+	FamilyID string `json:"fam,omitempty"`
+	// SessionID ties an access token to the session (refresh token family) it was issued for.
+	SessionID string `json:"sid,omitempty"`
+	// Scope is a space separated list of granted scopes.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// GrantType is set to "client_credentials" on tokens issued to a client
+	// rather than a user; their subject is the client ID.
+	GrantType string `json:"gty,omitempty"`
+	// Tenant is the organization the user signed in to. Client tokens have none.
+	Tenant string `json:"tenant,omitempty"`
+	// EmailVerified is set on user tokens, whether the user has verified
+	// the email yet.
+	EmailVerified *bool `json:"email_verified,omitempty"`
+	// Roles of the user in the tenant at the time the token was issued.
+	Roles []string `json:"roles,omitempty"`
+	// Actor is the party acting on behalf of the subject after a token exchange.
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor is the RFC 8693 act claim. A chain of delegations nests the previous
+// actor inside the current one.
+type Actor struct {
+	Subject  string `json:"sub"`
+	ClientID string `json:"client_id,omitempty"`
+	Actor    *Actor `json:"act,omitempty"`
+}
+
+const GrantTypeClientCredentials = "client_credentials"
+
+func (c *Claims) GetTenant() string {
+	return c.Tenant
+}
+
+// IsClient reports whether the token was issued to a client acting on its own behalf.
+func (c *Claims) IsClient() bool {
+	return c.GrantType == GrantTypeClientCredentials
+}
+
+// IsPersonalAccess reports whether the claims are those of a personal access
+// token, which is limited by its scope like a token issued to a client.
+func (c *Claims) IsPersonalAccess() bool {
+	return c.TokenUse == TokenUsePersonalAccess
+}
+
 type TokenResponse struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
 	ExpiresAt    int64  `json:"expiresAt"`
+	// IDToken is only issued when the openid scope was granted.
+	IDToken string `json:"idToken,omitempty"`
 }
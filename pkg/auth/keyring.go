@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const manifestFile = "keyring.json"
+
+// RotationPolicy describes how often the keyring replaces its signing key.
+type RotationPolicy struct {
+	Algorithm string
+	// Interval is how long a key stays the active signing key.
+	Interval time.Duration
+	// PublishAhead is how long a new key sits in the JWKS before it signs anything,
+	// so that verifiers caching the key set pick it up in time.
+	PublishAhead time.Duration
+	// VerifyFor is how long a replaced key keeps verifying tokens.
+	// It must be at least the lifetime of the longest-lived token.
+	VerifyFor time.Duration
+}
+
+// KeyState is the position of a key in its lifecycle at a given moment.
+type KeyState string
+
+const (
+	KeyUpcoming KeyState = "upcoming"
+	KeyActive   KeyState = "active"
+	KeyRetired  KeyState = "retired"
+	KeyExpired  KeyState = "expired"
+)
+
+type ringKey struct {
+	*Key
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+type manifestEntry struct {
+	ID        string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	File      string    `json:"file"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after,omitempty"`
+}
+
+// Keyring is a Signer backed by a directory of PEM files and a manifest with
+// the validity window of each key. Upcoming keys are published ahead of use and
+// retired keys keep verifying until their not-after time.
+type Keyring struct {
+	dir  string
+	lock sync.RWMutex
+	keys []*ringKey
+}
+
+// OpenKeyring loads the keyring stored in dir, creating the directory if needed.
+func OpenKeyring(dir string) (*Keyring, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("Ошибка создания каталога ключей: %w", err)
+	}
+
+	r := &Keyring{dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		return nil, err
+	}
+
+	var entries []manifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("Невалидный манифест ключей: %w", err)
+	}
+	for _, entry := range entries {
+		key, err := LoadKeyFile(filepath.Join(dir, entry.File), entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		r.keys = append(r.keys, &ringKey{Key: key, NotBefore: entry.NotBefore, NotAfter: entry.NotAfter})
+	}
+	r.sortKeys()
+	return r, nil
+}
+
+// Add stores a key with its validity window. A zero notAfter never expires.
+func (r *Keyring) Add(key *Key, notBefore, notAfter time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, existing := range r.keys {
+		if existing.ID == key.ID {
+			return fmt.Errorf("Ключ %q уже есть в keyring", key.ID)
+		}
+	}
+
+	data, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, key.ID+".pem"), data, 0o600); err != nil {
+		return fmt.Errorf("Ошибка сохранения ключа: %w", err)
+	}
+
+	r.keys = append(r.keys, &ringKey{Key: key, NotBefore: notBefore, NotAfter: notAfter})
+	r.sortKeys()
+	return r.saveManifest()
+}
+
+// State reports where the key with the given kid is in its lifecycle.
+func (r *Keyring) State(kid string) (KeyState, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	now := time.Now()
+	active := r.active(now)
+	for _, key := range r.keys {
+		if key.ID != kid {
+			continue
+		}
+		switch {
+		case !key.NotAfter.IsZero() && !now.Before(key.NotAfter):
+			return KeyExpired, true
+		case key == active:
+			return KeyActive, true
+		case now.Before(key.NotBefore):
+			return KeyUpcoming, true
+		default:
+			return KeyRetired, true
+		}
+	}
+	return "", false
+}
+
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	r.lock.RLock()
+	active := r.active(time.Now())
+	r.lock.RUnlock()
+
+	if active == nil {
+		return "", ErrNoKeys
+	}
+	return active.sign(claims)
+}
+
+func (r *Keyring) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return parse(tokenString, claims, func(kid string) *Key {
+		r.lock.RLock()
+		defer r.lock.RUnlock()
+
+		now := time.Now()
+		for _, key := range r.keys {
+			if key.ID == kid && key.verifies(now) {
+				return key.Key
+			}
+		}
+		return nil
+	})
+}
+
+// JWKS publishes upcoming, active and retired keys.
+func (r *Keyring) JWKS() JWKSet {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range r.keys {
+		if key.verifies(now) {
+			set.Keys = append(set.Keys, key.PublicJWK())
+		}
+	}
+	return set
+}
+
+// Rotate brings the keyring in line with the policy: it makes sure there is an
+// active key, schedules its successor once the interval is close to running out
+// and forgets keys that stopped verifying. All decisions are based on the
+// timestamps in the manifest, so the schedule carries over restarts.
+func (r *Keyring) Rotate(policy RotationPolicy) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	changed := r.prune(now)
+
+	if r.active(now) == nil {
+		if err := r.schedule(policy, now, now); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	newest := r.keys[len(r.keys)-1]
+	if !newest.NotBefore.Add(policy.Interval - policy.PublishAhead).After(now) {
+		notBefore := newest.NotBefore.Add(policy.Interval)
+		if earliest := now.Add(policy.PublishAhead); notBefore.Before(earliest) {
+			notBefore = earliest
+		}
+		if err := r.schedule(policy, notBefore, now); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return r.saveManifest()
+}
+
+// RunRotation applies the policy every check interval until ctx is done.
+func (r *Keyring) RunRotation(ctx context.Context, policy RotationPolicy, check time.Duration) {
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Rotate(policy); err != nil {
+				log.Printf("Key rotation failed: %v", err)
+			}
+		}
+	}
+}
+
+// schedule generates a key that becomes active at notBefore and limits the
+// lifetime of every key without an end date to notBefore plus VerifyFor.
+func (r *Keyring) schedule(policy RotationPolicy, notBefore time.Time, now time.Time) error {
+	key, err := GenerateKey("", policy.Algorithm)
+	if err != nil {
+		return err
+	}
+	data, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, key.ID+".pem"), data, 0o600); err != nil {
+		return fmt.Errorf("Ошибка сохранения ключа: %w", err)
+	}
+
+	for _, existing := range r.keys {
+		if existing.NotAfter.IsZero() {
+			existing.NotAfter = notBefore.Add(policy.VerifyFor)
+		}
+	}
+	r.keys = append(r.keys, &ringKey{Key: key, NotBefore: notBefore})
+	r.sortKeys()
+	log.Printf("Signing key %s scheduled, active from %s", key.ID, notBefore.Format(time.RFC3339))
+	return nil
+}
+
+func (r *Keyring) prune(now time.Time) bool {
+	kept := r.keys[:0]
+	for _, key := range r.keys {
+		if key.verifies(now) {
+			kept = append(kept, key)
+			continue
+		}
+		os.Remove(filepath.Join(r.dir, key.ID+".pem"))
+	}
+	pruned := len(kept) != len(r.keys)
+	r.keys = kept
+	return pruned
+}
+
+// active returns the most recent key that is already valid for signing.
+func (r *Keyring) active(now time.Time) *ringKey {
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		key := r.keys[i]
+		if !now.Before(key.NotBefore) && key.verifies(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+func (r *Keyring) sortKeys() {
+	sort.SliceStable(r.keys, func(i, j int) bool {
+		return r.keys[i].NotBefore.Before(r.keys[j].NotBefore)
+	})
+}
+
+func (r *Keyring) saveManifest() error {
+	entries := make([]manifestEntry, 0, len(r.keys))
+	for _, key := range r.keys {
+		entries = append(entries, manifestEntry{
+			ID:        key.ID,
+			Algorithm: key.Algorithm,
+			File:      key.ID + ".pem",
+			NotBefore: key.NotBefore,
+			NotAfter:  key.NotAfter,
+		})
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(r.dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("Ошибка сохранения манифеста ключей: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(r.dir, manifestFile))
+}
+
+func (k *ringKey) verifies(now time.Time) bool {
+	return k.NotAfter.IsZero() || now.Before(k.NotAfter)
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+	AlgES512 = "ES512"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnsupportedKey = errors.New("Неподдерживаемый тип ключа")
+	ErrInvalidPEM     = errors.New("Невалидный PEM")
+)
+
+// Key is an asymmetric private key used to sign tokens, identified by kid.
+type Key struct {
+	ID        string
+	Algorithm string
+	private   crypto.Signer
+}
+
+// NewKey wraps a private key and infers the JWS algorithm from its type.
+// An empty id is replaced with the RFC 7638 thumbprint of the public key.
+func NewKey(id string, private crypto.Signer) (*Key, error) {
+	alg, err := algorithmFor(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		if id, err = Thumbprint(private.Public()); err != nil {
+			return nil, err
+		}
+	}
+	return &Key{ID: id, Algorithm: alg, private: private}, nil
+}
+
+// GenerateKey creates a fresh key for the given algorithm.
+func GenerateKey(id string, alg string) (*Key, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgES384:
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case AlgES512:
+		private, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(id, private)
+}
+
+// LoadKeyFile reads a PEM encoded RSA, ECDSA or Ed25519 private key.
+func LoadKeyFile(path string, id string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка чтения ключа %s: %w", path, err)
+	}
+	return ParseKeyPEM(data, id)
+}
+
+// ParseKeyPEM accepts PKCS#8, PKCS#1 and SEC 1 encoded private keys.
+func ParseKeyPEM(data []byte, id string) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	var (
+		parsed any
+		err    error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPEM, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPEM, err)
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	return NewKey(id, private)
+}
+
+// MarshalPEM encodes the private key as PKCS#8.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func (k *Key) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+func (k *Key) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *Key) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.Method(), claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.private)
+}
+
+func algorithmFor(public crypto.PublicKey) (string, error) {
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		return AlgRS256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return AlgES256, nil
+		case elliptic.P384():
+			return AlgES384, nil
+		case elliptic.P521():
+			return AlgES512, nil
+		}
+	case ed25519.PublicKey:
+		return AlgEdDSA, nil
+	}
+	return "", ErrUnsupportedKey
+}
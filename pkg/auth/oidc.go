@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// IDTokenClaims is an OpenID Connect ID token. The profile and email claims
+// are only present when the matching scope was granted.
+type IDTokenClaims struct {
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	AtHash   string `json:"at_hash,omitempty"`
+	// AuthorizedParty is the client the token was issued to.
+	AuthorizedParty string `json:"azp,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Email           string `json:"email,omitempty"`
+	Tenant          string `json:"tenant,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c *IDTokenClaims) GetTenant() string {
+	return c.Tenant
+}
+
+var ErrUnsupportedAlgorithm = errors.New("Неподдерживаемый алгоритм подписи")
+
+// AccessTokenHash computes the at_hash of an access token: the left half of
+// its hash, with the hash function taken from the token's own alg header.
+// The ID token is signed right after by the same signer, so both agree.
+func AccessTokenHash(accessToken string) (string, error) {
+	header, _, ok := strings.Cut(accessToken, ".")
+	if !ok {
+		return "", ErrUnsupportedAlgorithm
+	}
+	data, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return "", err
+	}
+	var parsed struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", err
+	}
+
+	var hash crypto.Hash
+	switch parsed.Algorithm {
+	case AlgRS256, AlgES256:
+		hash = crypto.SHA256
+	case AlgES384:
+		hash = crypto.SHA384
+	case AlgES512, AlgEdDSA:
+		hash = crypto.SHA512
+	default:
+		return "", ErrUnsupportedAlgorithm
+	}
+
+	h := hash.New()
+	h.Write([]byte(accessToken))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// HasScope reports whether the space separated scope list contains want.
+func HasScope(scope string, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKey = errors.New("Неизвестный ключ подписи")
+	ErrNoKeys     = errors.New("Не задан ключ подписи")
+)
+
+var validMethods = []string{AlgRS256, AlgES256, AlgES384, AlgES512, AlgEdDSA}
+
+// Signer signs tokens with a private key and verifies them by their kid header.
+type Signer interface {
+	Sign(claims jwt.Claims) (string, error)
+	Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error)
+	JWKS() JWKSet
+}
+
+// StaticSigner signs with a single key and verifies with a fixed set of keys.
+type StaticSigner struct {
+	active *Key
+	keys   []*Key
+}
+
+func NewStaticSigner(active *Key, verifyOnly ...*Key) (*StaticSigner, error) {
+	if active == nil {
+		return nil, ErrNoKeys
+	}
+	return &StaticSigner{
+		active: active,
+		keys:   append([]*Key{active}, verifyOnly...),
+	}, nil
+}
+
+func (s *StaticSigner) Sign(claims jwt.Claims) (string, error) {
+	return s.active.sign(claims)
+}
+
+func (s *StaticSigner) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return parse(tokenString, claims, func(kid string) *Key {
+		for _, key := range s.keys {
+			if key.ID == kid {
+				return key
+			}
+		}
+		return nil
+	})
+}
+
+func (s *StaticSigner) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		set.Keys = append(set.Keys, key.PublicJWK())
+	}
+	return set
+}
+
+func parse(tokenString string, claims jwt.Claims, lookup func(kid string) *Key) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := lookup(kid)
+		if key == nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, token.Method.Alg())
+		}
+		return key.Public(), nil
+	}, jwt.WithValidMethods(validMethods))
+}
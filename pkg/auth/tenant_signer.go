@@ -0,0 +1,77 @@
+package auth
+
+import "github.com/golang-jwt/jwt/v5"
+
+// TenantClaims name the tenant a token belongs to.
+type TenantClaims interface {
+	GetTenant() string
+}
+
+// TenantSigner signs the tokens of some tenants with keys of their own. A
+// token is only accepted if it is signed with the keys of the tenant it
+// names, so one tenant's key can not mint tokens for another.
+//
+// Other services do not know about the tenant claim, so those tenants have an
+// issuer of their own as well, see Issuer. Their keys are only published
+// under it, never in the service-wide key set.
+type TenantSigner struct {
+	fallback Signer
+	tenants  map[string]Signer
+}
+
+// NewTenantSigner uses fallback for the tenants missing from tenants and for
+// tokens without a tenant, such as client tokens.
+func NewTenantSigner(fallback Signer, tenants map[string]Signer) *TenantSigner {
+	return &TenantSigner{fallback, tenants}
+}
+
+// OwnKeys reports whether the tenant signs with keys of its own.
+func (s *TenantSigner) OwnKeys(tenant string) bool {
+	_, ok := s.tenants[tenant]
+	return ok
+}
+
+// Issuer is the issuer of the tenant's tokens: base/t/<tenant> for a tenant
+// with keys of its own, base for the others.
+func (s *TenantSigner) Issuer(base string, tenant string) string {
+	if s.OwnKeys(tenant) {
+		return base + "/t/" + tenant
+	}
+	return base
+}
+
+// For returns the signer of the tenant.
+func (s *TenantSigner) For(tenant string) Signer {
+	if signer, ok := s.tenants[tenant]; ok {
+		return signer
+	}
+	return s.fallback
+}
+
+func (s *TenantSigner) Sign(claims jwt.Claims) (string, error) {
+	tenant := ""
+	if named, ok := claims.(TenantClaims); ok {
+		tenant = named.GetTenant()
+	}
+	return s.For(tenant).Sign(claims)
+}
+
+func (s *TenantSigner) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	// The tenant is read before the signature is checked, but the tenant's
+	// signer then verifies the whole token, tenant claim included.
+	var unverified struct {
+		Tenant string `json:"tenant"`
+		jwt.RegisteredClaims
+	}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &unverified); err != nil {
+		return nil, err
+	}
+	return s.For(unverified.Tenant).Parse(tokenString, claims)
+}
+
+// JWKS publishes the keys of the service-wide issuer only. A verifier
+// trusting these keys for every token would accept one tenant's key minting
+// tokens for another. For a single tenant's keys use For(tenant).JWKS().
+func (s *TenantSigner) JWKS() JWKSet {
+	return s.fallback.JWKS()
+}
@@ -2,19 +2,18 @@ package database
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
 	_ "modernc.org/sqlite"
 )
 
 func SQLite() *sql.DB {
-	db, err := sql.Open("sqlite", "file:sqlite.db")
+	db, err := sql.Open("sqlite", "file:sqlite.db?_time_format=sqlite&_pragma=foreign_keys(1)")
 	if err != nil {
-		log.Fatalf(err.Error())
+		log.Fatal(err)
 	}
 
 	if err = db.Ping(); err != nil {
-		log.Fatalf(fmt.Sprintf("Неактивное подключение: %w", err))
+		log.Fatalf("Неактивное подключение: %v", err)
 	}
 
 	return db
@@ -0,0 +1,191 @@
+// Package directory checks passwords against an LDAP directory: the user is
+// searched for with a service account, then the password is checked by
+// binding as the entry found.
+package directory
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("Неверное имя пользователя или пароль каталога")
+	ErrNotFound           = errors.New("Пользователь не найден в каталоге")
+	ErrUnavailable        = errors.New("Каталог недоступен")
+)
+
+// Attributes name the attributes of the entries that are read.
+type Attributes struct {
+	Email string
+	Name  string
+	// Groups lists the DNs of the groups of the user, memberOf usually.
+	Groups string
+}
+
+// Entry is what the directory knows of a user.
+type Entry struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+}
+
+// Directory is an LDAP server. A connection is made for every login.
+type Directory struct {
+	// URL is ldap:// or ldaps://host:port.
+	URL string
+	// StartTLS upgrades an ldap:// connection before anything is sent.
+	StartTLS     bool
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// Filter finds the user. {email} is replaced with the login and
+	// {username} with the part of it before the @, both escaped.
+	Filter string
+	// GroupFilter finds the groups of the user when the entries do not list
+	// them, e.g. (member={dn}). The DNs of the groups found are used.
+	GroupFilter string
+	Attributes  Attributes
+	Timeout     time.Duration
+}
+
+// Authenticate checks the password of the user the login names.
+func (d *Directory) Authenticate(login, password string) (Entry, error) {
+	// A simple bind without a password succeeds as an anonymous one (RFC 4513, section 5.1.2)
+	if password == "" {
+		return Entry{}, ErrInvalidCredentials
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return Entry{}, err
+	}
+	defer conn.Close()
+
+	if err := d.bindService(conn); err != nil {
+		return Entry{}, err
+	}
+	username, _, _ := strings.Cut(login, "@")
+	filter := strings.NewReplacer(
+		"{email}", ldap.EscapeFilter(login),
+		"{username}", ldap.EscapeFilter(username),
+	).Replace(d.Filter)
+	attributes := []string{d.Attributes.Email, d.Attributes.Name, d.Attributes.Groups}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(d.Timeout.Seconds()), false,
+		filter, nonEmpty(attributes), nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return Entry{}, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	// Two entries for one login is a broken filter, neither is picked
+	if result == nil || len(result.Entries) != 1 {
+		return Entry{}, ErrNotFound
+	}
+	found := result.Entries[0]
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Entry{}, ErrInvalidCredentials
+		}
+		return Entry{}, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	entry := Entry{DN: found.DN}
+	if d.Attributes.Email != "" {
+		entry.Email = found.GetAttributeValue(d.Attributes.Email)
+	}
+	if d.Attributes.Name != "" {
+		entry.Name = found.GetAttributeValue(d.Attributes.Name)
+	}
+	if d.Attributes.Groups != "" {
+		entry.Groups = found.GetAttributeValues(d.Attributes.Groups)
+	}
+	if d.GroupFilter != "" {
+		groups, err := d.groups(conn, found.DN)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Groups = append(entry.Groups, groups...)
+	}
+	return entry, nil
+}
+
+// groups searches for the groups as the service account: the user may not be
+// allowed to read them.
+func (d *Directory) groups(conn *ldap.Conn, dn string) ([]string, error) {
+	if err := d.bindService(conn); err != nil {
+		return nil, err
+	}
+	filter := strings.ReplaceAll(d.GroupFilter, "{dn}", ldap.EscapeFilter(dn))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(d.Timeout.Seconds()), false,
+		filter, []string{"1.1"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, group := range result.Entries {
+		groups = append(groups, group.DN)
+	}
+	return groups, nil
+}
+
+func (d *Directory) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname()}
+	conn, err := ldap.DialURL(d.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: d.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	conn.SetTimeout(d.Timeout)
+	if d.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	}
+	return conn, nil
+}
+
+// bindService binds as the service account, or stays anonymous without one.
+func (d *Directory) bindService(conn *ldap.Conn) error {
+	var err error
+	if d.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(d.BindDN, d.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: service bind: %w", ErrUnavailable, err)
+	}
+	return nil
+}
+
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	if len(result) == 0 {
+		// RFC 4511, section 4.5.1.8: no attributes at all
+		return []string{"1.1"}
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+// Package mail sends the emails of the service: over SMTP in production, to
+// a file or the log while developing.
+package mail
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages. Implementations must be safe for concurrent use.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// SMTPSender sends through an SMTP server, upgrading to TLS when the server
+// offers STARTTLS. Without a username no authentication is attempted.
+type SMTPSender struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPSender(addr string, username string, password string, from string) *SMTPSender {
+	return &SMTPSender{addr, username, password, from}
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host := s.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, format(s.From, msg)); err != nil {
+		return fmt.Errorf("Ошибка отправки письма: %w", err)
+	}
+	return nil
+}
+
+// WriterSender writes messages in their wire format, for development.
+type WriterSender struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriterSender(w io.Writer, from string) *WriterSender {
+	return &WriterSender{w: w, from: from}
+}
+
+// NewFileSender appends messages to the file.
+func NewFileSender(path string, from string) (*WriterSender, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка открытия файла писем: %w", err)
+	}
+	return NewWriterSender(file, from), nil
+}
+
+// NewLogSender writes messages to the standard logger.
+func NewLogSender(from string) *WriterSender {
+	return NewWriterSender(log.Writer(), from)
+}
+
+func (s *WriterSender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "%s\n", format(s.from, msg)); err != nil {
+		return fmt.Errorf("Ошибка отправки письма: %w", err)
+	}
+	return nil
+}
+
+// format builds an RFC 5322 message. Header values are stripped of line
+// breaks so that they can not inject headers.
+func format(from string, msg Message) []byte {
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", clean.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", clean.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", clean.Replace(msg.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,321 @@
+// Package oidc signs users in with upstream OpenID Connect providers: the
+// authorization code flow with PKCE, as a confidential or public client, and
+// validation of the ID tokens against the keys the provider publishes.
+package oidc
+
+import (
+	"JWT/pkg/auth"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDiscovery      = errors.New("Ошибка получения конфигурации провайдера")
+	ErrExchange       = errors.New("Ошибка обмена кода у провайдера")
+	ErrInvalidIDToken = errors.New("Невалидный ID токен провайдера")
+)
+
+// keysRefreshInterval limits how often an unknown kid makes the keys be fetched again.
+const keysRefreshInterval = time.Minute
+
+// maxResponseSize limits what is read from the provider.
+const maxResponseSize = 1 << 20
+
+var validMethods = []string{auth.AlgRS256, auth.AlgES256, auth.AlgES384, auth.AlgES512, auth.AlgEdDSA}
+
+// Metadata is the part of the discovery document that is used.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an upstream provider. The discovery document and the keys are
+// fetched on first use, so a provider that is down does not stop the service.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider.
+	RedirectURL string
+	Scopes      []string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *Metadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+func NewProvider(issuer, clientID, clientSecret, redirectURL string, scopes []string, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		client:       client,
+	}
+}
+
+// Metadata discovers the endpoints of the provider.
+func (p *Provider) Metadata(ctx context.Context) (Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	var metadata Metadata
+	if err := p.get(ctx, p.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return Metadata{}, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	// OpenID Connect Discovery 1.0, section 4.3
+	if strings.TrimRight(metadata.Issuer, "/") != p.Issuer {
+		return Metadata{}, fmt.Errorf("%w: issuer %q", ErrDiscovery, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return Metadata{}, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+	p.metadata = &metadata
+	return metadata, nil
+}
+
+// AuthCodeURL is where the browser is sent to sign in. The code challenge
+// is the S256 challenge of the verifier passed to Exchange later.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {auth.PKCEMethodS256},
+	}
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Tokens is the answer of the token endpoint.
+type Tokens struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Exchange redeems the code at the token endpoint.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (Tokens, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return Tokens{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		// RFC 6749, section 2.3.1
+		request.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var tokens Tokens
+	if err := p.do(request, &tokens); err != nil {
+		return Tokens{}, fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return Tokens{}, fmt.Errorf("%w: no id_token", ErrExchange)
+	}
+	return tokens, nil
+}
+
+// IDToken holds the claims of a verified ID token.
+type IDToken struct {
+	Nonce           string       `json:"nonce"`
+	AuthorizedParty string       `json:"azp"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// flexibleBool accepts "true" as well, which some providers send.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = flexibleBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, lifetime and nonce
+// of the ID token (OpenID Connect Core 1.0, section 3.1.3.7).
+func (p *Provider) VerifyIDToken(ctx context.Context, raw string, nonce string) (*IDToken, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := &IDToken{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, fmt.Errorf("%w: azp %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no sub", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// key finds the signing key, fetching the keys again when the provider has
+// rotated to one that is not known yet.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.lookup(kid)
+	stale := time.Since(p.keysFetched) > keysRefreshInterval
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("%w: %q", auth.ErrUnknownKey, kid)
+	}
+
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := p.get(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, raw := range set.Keys {
+		var jwk auth.JWK
+		if err := json.Unmarshal(raw, &jwk); err != nil {
+			continue
+		}
+		// Keys for encryption and of unknown types are skipped
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if public, err := jwk.PublicKey(); err == nil {
+			keys[jwk.Kid] = public
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.keysFetched = keys, time.Now()
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %q", auth.ErrUnknownKey, kid)
+}
+
+// lookup must be called with mu held. Without a kid the provider must
+// publish a single key.
+func (p *Provider) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) get(ctx context.Context, endpoint string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	return p.do(request, v)
+}
+
+func (p *Provider) do(request *http.Request, v any) error {
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			return fmt.Errorf("%s: %s %s", request.URL.Path, oauthErr.Error, oauthErr.Description)
+		}
+		return fmt.Errorf("%s: status %d", request.URL.Path, response.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Engine evaluates the policy stored in a file and reloads it when the file
+// changes. Until the file exists the fallback policy is used.
+type Engine struct {
+	path     string
+	fallback *Policy
+
+	lock    sync.RWMutex
+	policy  *Policy
+	modTime time.Time
+}
+
+func NewEngine(path string, fallback string) (*Engine, error) {
+	policy, err := Parse(fallback)
+	if err != nil {
+		return nil, fmt.Errorf("Невалидная политика по умолчанию: %w", err)
+	}
+
+	e := &Engine{path: path, fallback: policy, policy: policy}
+	if _, err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) Evaluate(request Request) Decision {
+	e.lock.RLock()
+	policy := e.policy
+	e.lock.RUnlock()
+
+	return policy.Evaluate(request)
+}
+
+// Reload reads the policy file if it changed since the last load. An invalid
+// file is rejected and the current policy stays in effect.
+func (e *Engine) Reload() (bool, error) {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			e.lock.Lock()
+			defer e.lock.Unlock()
+			changed := e.policy != e.fallback
+			e.policy, e.modTime = e.fallback, time.Time{}
+			return changed, nil
+		}
+		return false, err
+	}
+
+	e.lock.RLock()
+	unchanged := info.ModTime().Equal(e.modTime)
+	e.lock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return false, err
+	}
+	policy, err := Parse(string(data))
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	// An invalid version is reported once, not on every check
+	e.modTime = info.ModTime()
+	if err != nil {
+		return false, fmt.Errorf("Невалидная политика %s: %w", e.path, err)
+	}
+	e.policy = policy
+	return true, nil
+}
+
+// Watch checks the file every interval until ctx is done.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := e.Reload()
+			if err != nil {
+				log.Printf("Policy reload failed: %v", err)
+				continue
+			}
+			if changed {
+				log.Printf("Policy reloaded from %s", e.path)
+			}
+		}
+	}
+}
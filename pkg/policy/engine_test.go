@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePolicy writes the file with a modification time of its own, so that
+// Reload sees every write.
+func writePolicy(t *testing.T, path string, source string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(source), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEngineReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	engine, err := NewEngine(path, "allow users:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := Request{Action: "users:read"}
+	write := Request{Action: "users:write"}
+	start := time.Now().Add(-time.Hour)
+
+	if !engine.Evaluate(read).Allowed {
+		t.Fatal("fallback policy is not in effect without a file")
+	}
+
+	writePolicy(t, path, "allow users:write", start)
+	if changed, err := engine.Reload(); !changed || err != nil {
+		t.Fatalf("reload of a new file: changed %v, err %v", changed, err)
+	}
+	if engine.Evaluate(read).Allowed || !engine.Evaluate(write).Allowed {
+		t.Fatal("file policy is not in effect")
+	}
+	if changed, err := engine.Reload(); changed || err != nil {
+		t.Fatalf("reload of an unchanged file: changed %v, err %v", changed, err)
+	}
+
+	// An invalid version is reported once and the last valid one stays
+	writePolicy(t, path, "allow users:write if", start.Add(time.Minute))
+	if _, err := engine.Reload(); err == nil {
+		t.Fatal("invalid policy accepted")
+	}
+	if changed, err := engine.Reload(); changed || err != nil {
+		t.Fatalf("second reload of an invalid file: changed %v, err %v", changed, err)
+	}
+	if !engine.Evaluate(write).Allowed {
+		t.Fatal("last valid policy is not in effect after an invalid one")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := engine.Reload(); !changed || err != nil {
+		t.Fatalf("reload of a removed file: changed %v, err %v", changed, err)
+	}
+	if !engine.Evaluate(read).Allowed || engine.Evaluate(write).Allowed {
+		t.Fatal("fallback policy is not in effect after the file was removed")
+	}
+}
+
+func TestEngineRejectsInvalidPolicies(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewEngine(filepath.Join(dir, "missing.txt"), "permit users:read"); err == nil {
+		t.Error("invalid fallback policy accepted")
+	}
+
+	path := filepath.Join(dir, "policy.txt")
+	writePolicy(t, path, "allow users:read if subject == 1", time.Now())
+	if _, err := NewEngine(path, "allow users:read"); err == nil {
+		t.Error("invalid policy file accepted")
+	}
+}
+
+func TestEngineDeniesByDefault(t *testing.T) {
+	engine, err := NewEngine(filepath.Join(t.TempDir(), "policy.txt"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := engine.Evaluate(Request{Action: "users:read"}); got != (Decision{}) {
+		t.Errorf("got %+v, want a denial", got)
+	}
+}
@@ -0,0 +1,203 @@
+package policy
+
+import "reflect"
+
+type evalEnv struct {
+	request Request
+}
+
+type expr interface {
+	eval(env evalEnv) bool
+}
+
+// operand yields a value, or nil when an attribute is missing.
+type operand interface {
+	value(env evalEnv) any
+}
+
+type literal struct {
+	v any
+}
+
+func (l literal) value(evalEnv) any {
+	return l.v
+}
+
+type attribute []string
+
+func (a attribute) value(env evalEnv) any {
+	var root map[string]any
+	switch a[0] {
+	case "action":
+		return env.request.Action
+	case "subject":
+		root = env.request.Subject
+	case "resource":
+		root = env.request.Resource
+	case "environment":
+		root = env.request.Environment
+	}
+
+	var current any = root
+	for _, name := range a[1:] {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if current, ok = object[name]; !ok {
+			return nil
+		}
+	}
+	return normalize(current)
+}
+
+// normalize turns every number into float64 and every slice into []any so
+// that attributes built by Go code compare with literals.
+func normalize(v any) any {
+	switch value := v.(type) {
+	case nil, string, bool, float64, []any, map[string]any:
+		return v
+	case int:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case []string:
+		items := make([]any, len(value))
+		for i, item := range value {
+			items[i] = item
+		}
+		return items
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		items := make([]any, rv.Len())
+		for i := range items {
+			items[i] = normalize(rv.Index(i).Interface())
+		}
+		return items
+	}
+	return v
+}
+
+type orExpr struct {
+	left, right expr
+}
+
+func (e orExpr) eval(env evalEnv) bool {
+	return e.left.eval(env) || e.right.eval(env)
+}
+
+type andExpr struct {
+	left, right expr
+}
+
+func (e andExpr) eval(env evalEnv) bool {
+	return e.left.eval(env) && e.right.eval(env)
+}
+
+type notExpr struct {
+	inner expr
+}
+
+func (e notExpr) eval(env evalEnv) bool {
+	return !e.inner.eval(env)
+}
+
+type truthyExpr struct {
+	operand operand
+}
+
+func (e truthyExpr) eval(env evalEnv) bool {
+	b, ok := e.operand.value(env).(bool)
+	return ok && b
+}
+
+type compareExpr struct {
+	op          string
+	left, right operand
+}
+
+func (e compareExpr) eval(env evalEnv) bool {
+	left, right := e.left.value(env), e.right.value(env)
+	if left == nil || right == nil {
+		return false
+	}
+
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false
+		}
+		return compare(e.op, l < r, l == r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false
+		}
+		return compare(e.op, l < r, l == r)
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return false
+		}
+		switch e.op {
+		case "==":
+			return l == r
+		case "!=":
+			return l != r
+		}
+	}
+	return false
+}
+
+func compare(op string, less bool, equal bool) bool {
+	switch op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	case ">=":
+		return !less
+	}
+	return false
+}
+
+type inExpr struct {
+	left, right operand
+}
+
+func (e inExpr) eval(env evalEnv) bool {
+	left := e.left.value(env)
+	items, ok := e.right.value(env).([]any)
+	if left == nil || !ok {
+		return false
+	}
+
+	for _, item := range items {
+		if pattern, ok := item.(string); ok {
+			if value, ok := left.(string); ok && Match(pattern, value) {
+				return true
+			}
+			continue
+		}
+		if item == left {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package policy
+
+import "testing"
+
+// allows evaluates the condition as that of the only rule of a policy.
+func allows(t *testing.T, condition string, request Request) bool {
+	t.Helper()
+	policy, err := Parse("allow test if " + condition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Action = "test"
+	return policy.Evaluate(request).Allowed
+}
+
+func TestConditionPrecedence(t *testing.T) {
+	for _, tt := range []struct {
+		condition string
+		want      bool
+	}{
+		{`true or true and false`, true},
+		{`(true or true) and false`, false},
+		{`false and false or true`, true},
+		{`false and (false or true)`, false},
+		{`not false and false`, false},
+		{`not (false and false)`, true},
+		{`not true or true`, true},
+		{`not not true`, true},
+		{`1 < 2 and 2 <= 2 and 3 > 2 and 3 >= 3 and 1 != 2`, true},
+	} {
+		t.Run(tt.condition, func(t *testing.T) {
+			if got := allows(t, tt.condition, Request{}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingAttributesDeny(t *testing.T) {
+	request := Request{
+		Subject:  map[string]any{"tenant": "acme", "org": "acme"},
+		Resource: map[string]any{},
+	}
+	for _, tt := range []struct {
+		condition string
+		want      bool
+	}{
+		{`resource.tenant == subject.tenant`, false},
+		{`resource.tenant != subject.tenant`, false},
+		{`resource.level < 3`, false},
+		{`resource.level >= 3`, false},
+		{`resource.owner in ["acme", "*"]`, false},
+		{`subject.tenant in resource.tenants`, false},
+		{`resource.public`, false},
+		{`environment.ip == "127.0.0.1"`, false},
+		{`subject.org.id == "acme"`, false},
+		// Negating the comparison is how a rule catches missing attributes
+		{`not (resource.tenant == subject.tenant)`, true},
+	} {
+		t.Run(tt.condition, func(t *testing.T) {
+			if got := allows(t, tt.condition, request); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionComparesAttributes(t *testing.T) {
+	request := Request{
+		Subject: map[string]any{
+			"id":          7,
+			"type":        "user",
+			"permissions": []string{"users:read", "users:admin"},
+			"verified":    true,
+		},
+		Resource:    map[string]any{"id": int64(7), "tenant": "acme"},
+		Environment: map[string]any{"hour": 9.0},
+	}
+	for _, tt := range []struct {
+		condition string
+		want      bool
+	}{
+		{`subject.id == resource.id`, true},
+		{`subject.id == 7`, true},
+		{`subject.id == "7"`, false},
+		{`subject.id < "8"`, false},
+		{`"users:admin" in subject.permissions`, true},
+		{`"users:delete" in subject.permissions`, false},
+		{`resource.tenant in ["ac*"]`, true},
+		{`resource.tenant in ["other", "acm"]`, false},
+		{`subject.verified`, true},
+		{`subject.verified == true`, true},
+		{`subject.type`, false},
+		{`environment.hour >= 9 and environment.hour < 17`, true},
+		{`"b" > "a"`, true},
+	} {
+		t.Run(tt.condition, func(t *testing.T) {
+			if got := allows(t, tt.condition, request); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
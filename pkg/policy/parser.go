@@ -0,0 +1,299 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value any
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:*-", r)
+}
+
+func lex(line string) ([]token, error) {
+	var tokens []token
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#':
+			i = len(runes)
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			text := string(runes[i : end+1])
+			value, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", text)
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, value: value})
+			i = end + 1
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			text := string(runes[i:end])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", text)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, value: value})
+			i = end
+		case isIdentRune(r):
+			end := i
+			for end < len(runes) && isIdentRune(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[i:end])})
+			i = end
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")"})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{kind: tokLBracket, text: "["})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{kind: tokRBracket, text: "]"})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ","})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if op == "=" || op == "!" {
+				return nil, fmt.Errorf("unknown operator %s", op)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op})
+			i += len(op)
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokIdent && t.text == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseRule parses: effect action[, action...] [if condition]
+func parseRule(line string) (Rule, error) {
+	tokens, err := lex(line)
+	if err != nil {
+		return Rule{}, err
+	}
+	p := &parser{tokens: tokens}
+
+	rule := Rule{Source: strings.TrimSpace(line)}
+	switch effect := p.next(); effect.text {
+	case string(Allow), string(Deny):
+		rule.Effect = Effect(effect.text)
+	default:
+		return Rule{}, fmt.Errorf("rule must start with allow or deny, got %q", effect.text)
+	}
+
+	for {
+		action := p.next()
+		if action.kind != tokIdent || action.text == "if" {
+			return Rule{}, fmt.Errorf("expected an action, got %q", action.text)
+		}
+		rule.Actions = append(rule.Actions, action.text)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+
+	if p.keyword("if") {
+		if rule.Condition, err = p.parseOr(); err != nil {
+			return Rule{}, err
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return Rule{}, fmt.Errorf("unexpected %q", t.text)
+	}
+	return rule, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.keyword("not") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, fmt.Errorf("expected ), got %q", t.text)
+		}
+		return inner, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch t := p.peek(); {
+	case t.kind == tokOp:
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareExpr{op: t.text, left: left, right: right}, nil
+	case t.kind == tokIdent && t.text == "in":
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return inExpr{left, right}, nil
+	}
+	return truthyExpr{left}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString, tokNumber:
+		return literal{t.value}, nil
+	case tokLBracket:
+		var items []any
+		for p.peek().kind != tokRBracket {
+			item := p.next()
+			if item.kind != tokString && item.kind != tokNumber {
+				return nil, fmt.Errorf("list items must be literals, got %q", item.text)
+			}
+			items = append(items, item.value)
+			if p.peek().kind == tokComma {
+				p.next()
+			} else if p.peek().kind != tokRBracket {
+				return nil, fmt.Errorf("expected , or ] in list")
+			}
+		}
+		p.next()
+		return literal{items}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		}
+		path := strings.Split(t.text, ".")
+		switch path[0] {
+		case "subject", "resource", "environment":
+			if len(path) < 2 {
+				return nil, fmt.Errorf("%s needs an attribute, e.g. %s.id", path[0], path[0])
+			}
+		case "action":
+			if len(path) != 1 {
+				return nil, fmt.Errorf("action has no attributes")
+			}
+		default:
+			return nil, fmt.Errorf("unknown attribute %q", t.text)
+		}
+		return attribute(path), nil
+	}
+	return nil, fmt.Errorf("expected a value, got %q", t.text)
+}
@@ -0,0 +1,57 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"unknown effect", `permit users:read`, "rule must start with allow or deny"},
+		{"no action", `allow`, "expected an action"},
+		{"condition without action", `allow if subject.id == 1`, "expected an action"},
+		{"empty condition", `allow users:read if`, "expected a value"},
+		{"missing operand", `allow users:read if subject.id ==`, "expected a value"},
+		{"unclosed parenthesis", `allow users:read if (subject.id == 1`, "expected )"},
+		{"trailing tokens", `allow users:read if subject.id == 1 2`, `unexpected "2"`},
+		{"single equals", `allow users:read if subject.id = 1`, "unknown operator ="},
+		{"unterminated string", `allow users:read if subject.name == "admin`, "unterminated string"},
+		{"unexpected character", `allow users:read if subject.id == $1`, "unexpected character"},
+		{"bare subject", `allow users:read if subject == 1`, "subject needs an attribute"},
+		{"action attribute", `allow users:read if action.name == "x"`, "action has no attributes"},
+		{"unknown root", `allow users:read if user.id == 1`, `unknown attribute "user.id"`},
+		{"attribute in a list", `allow users:read if resource.id in [subject.id]`, "list items must be literals"},
+		{"unclosed list", `allow users:read if resource.id in [1 2]`, "expected , or ] in list"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReportsTheLine(t *testing.T) {
+	source := "# comment\n\nallow users:read\nallow users:read if subject.id = 1\n"
+	if _, err := Parse(source); err == nil || !strings.HasPrefix(err.Error(), "line 4:") {
+		t.Fatalf("got %v, want an error on line 4", err)
+	}
+}
+
+func TestParseSkipsCommentsAndBlankLines(t *testing.T) {
+	policy, err := Parse("# comment\n\n  allow users:read # trailing comment\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(policy.rules))
+	}
+	if rule := policy.rules[0]; rule.Line != 3 || rule.Effect != Allow || len(rule.Actions) != 1 || rule.Actions[0] != "users:read" {
+		t.Errorf("got %+v", rule)
+	}
+}
@@ -0,0 +1,120 @@
+// Package policy evaluates attribute-based access rules.
+//
+// A policy is a list of rules, one per line:
+//
+//	# users may manage their own record
+//	allow users:read, users:delete if subject.id == resource.id
+//	allow users:* if "users:admin" in subject.permissions
+//	deny  users:delete if resource.id == 1
+//
+// Actions are matched as patterns ("*" and "users:*" are wildcards). A
+// condition compares subject.*, resource.*, environment.* and action with
+// ==, !=, <, <=, >, >= and in, combined with and, or, not and parentheses.
+// Elements of a list on the right of in are patterns as well.
+//
+// A comparison involving a missing attribute is false, whatever the operator,
+// so a deny rule that must also catch missing attributes negates the
+// comparison instead: not (resource.tenant == subject.tenant).
+// Any matching deny rule wins; otherwise a matching allow rule allows; nothing
+// matching denies.
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+type Rule struct {
+	Effect    Effect
+	Actions   []string
+	Condition expr
+	Line      int
+	Source    string
+}
+
+type Policy struct {
+	rules []Rule
+}
+
+// Request is the question asked of a policy.
+type Request struct {
+	Subject     map[string]any `json:"subject"`
+	Action      string         `json:"action"`
+	Resource    map[string]any `json:"resource"`
+	Environment map[string]any `json:"environment"`
+}
+
+// Decision names the rule that decided it, if any.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// Parse reads a policy, reporting the first invalid rule with its line number.
+func Parse(source string) (*Policy, error) {
+	policy := &Policy{}
+	for i, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		rule, err := parseRule(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rule.Line = i + 1
+		policy.rules = append(policy.rules, rule)
+	}
+	return policy, nil
+}
+
+func (p *Policy) Evaluate(request Request) Decision {
+	env := evalEnv{request: request}
+
+	var allowed *Rule
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if !rule.matchesAction(request.Action) {
+			continue
+		}
+		if rule.Condition != nil && !rule.Condition.eval(env) {
+			continue
+		}
+		if rule.Effect == Deny {
+			return Decision{Allowed: false, Rule: rule.Source, Line: rule.Line}
+		}
+		if allowed == nil {
+			allowed = rule
+		}
+	}
+	if allowed != nil {
+		return Decision{Allowed: true, Rule: allowed.Source, Line: allowed.Line}
+	}
+	return Decision{Allowed: false}
+}
+
+func (r *Rule) matchesAction(action string) bool {
+	for _, pattern := range r.Actions {
+		if Match(pattern, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether value matches the pattern: either equal, or the
+// pattern ends in * and value starts with the rest of it.
+func Match(pattern string, value string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return pattern == value
+}
@@ -0,0 +1,68 @@
+package policy
+
+import "testing"
+
+const testPolicy = `
+allow users:read if subject.id == resource.id
+allow users:* if "users:admin" in subject.permissions
+deny  users:delete if resource.protected
+`
+
+func TestEvaluate(t *testing.T) {
+	policy, err := Parse(testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := map[string]any{"id": 1, "permissions": []string{"users:admin"}}
+	user := map[string]any{"id": 2}
+
+	for _, tt := range []struct {
+		name    string
+		request Request
+		want    Decision
+	}{
+		{"no rule for the action", Request{Subject: admin, Action: "clients:read"}, Decision{}},
+		{"no condition holds", Request{Subject: user, Action: "users:read", Resource: map[string]any{"id": 3}}, Decision{}},
+		{"empty request", Request{}, Decision{}},
+		{"first allowing rule", Request{Subject: admin, Action: "users:read", Resource: map[string]any{"id": 1}},
+			Decision{Allowed: true, Rule: "allow users:read if subject.id == resource.id", Line: 2}},
+		{"wildcard action", Request{Subject: admin, Action: "users:delete", Resource: map[string]any{"id": 3}},
+			Decision{Allowed: true, Rule: `allow users:* if "users:admin" in subject.permissions`, Line: 3}},
+		{"deny wins over an earlier allow", Request{Subject: admin, Action: "users:delete", Resource: map[string]any{"id": 3, "protected": true}},
+			Decision{Allowed: false, Rule: "deny  users:delete if resource.protected", Line: 4}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Evaluate(tt.request); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyPolicyDenies(t *testing.T) {
+	policy, err := Parse("# nothing is allowed\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := policy.Evaluate(Request{Action: "users:read"}); got != (Decision{}) {
+		t.Errorf("got %+v, want a denial", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"users:read", "users:read", true},
+		{"users:read", "users:readall", false},
+		{"users:*", "users:delete", true},
+		{"users:*", "clients:read", false},
+		{"*", "anything", true},
+		{"users*", "users:read", true},
+	} {
+		if got := Match(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
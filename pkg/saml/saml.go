@@ -0,0 +1,506 @@
+// Package saml is a SAML 2.0 service provider for the Web Browser SSO
+// profile: AuthnRequests over the HTTP-Redirect binding, and responses over
+// the HTTP-POST binding whose assertions are signed by the identity provider.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsSignature = "http://www.w3.org/2000/09/xmldsig#"
+
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+
+	NameIDFormatEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+
+	statusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// clockSkew is how far the clocks of the provider and the service may differ.
+const clockSkew = time.Minute
+
+// maxResponseSize limits the encoded responses that are parsed.
+const maxResponseSize = 512 << 10
+
+var (
+	ErrInvalidResponse  = errors.New("Невалидный SAML ответ")
+	ErrInvalidSignature = errors.New("Невалидная подпись SAML утверждения")
+	ErrInvalidAssertion = errors.New("Невалидное SAML утверждение")
+	ErrStatus           = errors.New("Провайдер SAML отклонил вход")
+)
+
+// ServiceProvider is this service.
+type ServiceProvider struct {
+	EntityID string
+	// ACSURL is the assertion consumer service the responses are posted to.
+	ACSURL string
+}
+
+// IdentityProvider is an upstream provider as described by its metadata.
+type IdentityProvider struct {
+	EntityID string
+	// SSOURL is the single sign-on service of the HTTP-Redirect binding.
+	SSOURL string
+	// Certificates sign the assertions. There are two while the provider
+	// rolls its key over.
+	Certificates []*x509.Certificate
+}
+
+// LoadCertificates reads the PEM encoded certificates from the file.
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка чтения сертификата SAML: %w", err)
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Невалидный сертификат SAML %s: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("Нет сертификатов в %s", path)
+	}
+	return certs, nil
+}
+
+type entityDescriptor struct {
+	XMLName  xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string       `xml:"entityID,attr"`
+	SP       spDescriptor `xml:"SPSSODescriptor"`
+}
+
+type spDescriptor struct {
+	AuthnRequestsSigned        bool       `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool       `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string     `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormats              []string   `xml:"NameIDFormat"`
+	ACS                        []endpoint `xml:"AssertionConsumerService"`
+}
+
+type endpoint struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// Metadata describes the service to the identity providers.
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	data, err := xml.MarshalIndent(entityDescriptor{
+		EntityID: sp.EntityID,
+		SP: spDescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: nsProtocol,
+			NameIDFormats:              []string{NameIDFormatEmail, NameIDFormatUnspecified},
+			ACS:                        []endpoint{{Binding: BindingHTTPPost, Location: sp.ACSURL, Index: 0, IsDefault: true}},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string       `xml:"ID,attr"`
+	Version                     string       `xml:"Version,attr"`
+	IssueInstant                string       `xml:"IssueInstant,attr"`
+	Destination                 string       `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+	Issuer                      issuer       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"NameIDPolicy"`
+}
+
+type issuer struct {
+	Value string `xml:",chardata"`
+}
+
+type nameIDPolicy struct {
+	Format      string `xml:"Format,attr"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
+
+// AuthnRequestURL is where the browser is sent to sign in. The id must be
+// an XML ID, and is expected back as InResponseTo.
+func (sp *ServiceProvider) AuthnRequestURL(idp *IdentityProvider, id string, relayState string) (string, error) {
+	data, err := xml.Marshal(authnRequest{
+		ID:                          id,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 idp.SSOURL,
+		AssertionConsumerServiceURL: sp.ACSURL,
+		ProtocolBinding:             BindingHTTPPost,
+		Issuer:                      issuer{sp.EntityID},
+		NameIDPolicy:                nameIDPolicy{Format: NameIDFormatUnspecified, AllowCreate: true},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// SAML Bindings, section 3.4.4.1: DEFLATE, then base64
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	query := url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(deflated.Bytes())}}
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+
+	separator := "?"
+	if strings.Contains(idp.SSOURL, "?") {
+		separator = "&"
+	}
+	return idp.SSOURL + separator + query.Encode(), nil
+}
+
+// Response is a parsed, not yet validated response.
+type Response struct {
+	root *etree.Element
+	// Issuer names the provider whose certificates the response is checked
+	// with. It is not to be trusted before that.
+	Issuer       string
+	InResponseTo string
+}
+
+// ParseResponse decodes the SAMLResponse posted to the ACS.
+func ParseResponse(encoded string) (*Response, error) {
+	if len(encoded) > maxResponseSize {
+		return nil, fmt.Errorf("%w: too large", ErrInvalidResponse)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Response" || root.NamespaceURI() != nsProtocol {
+		return nil, fmt.Errorf("%w: not a Response", ErrInvalidResponse)
+	}
+
+	response := &Response{root: root, InResponseTo: root.SelectAttrValue("InResponseTo", "")}
+	if el := child(root, nsAssertion, "Issuer"); el != nil {
+		response.Issuer = strings.TrimSpace(el.Text())
+	} else if assertion := child(root, nsAssertion, "Assertion"); assertion != nil {
+		// The issuer of the response is optional, the one of the assertion is not
+		if el := child(assertion, nsAssertion, "Issuer"); el != nil {
+			response.Issuer = strings.TrimSpace(el.Text())
+		}
+	}
+	return response, nil
+}
+
+// Assertion is what a validated assertion says about the user.
+type Assertion struct {
+	ID           string
+	Issuer       string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	// ExpiresAt is when the assertion stops being accepted; it must be
+	// remembered until then so it can not be replayed.
+	ExpiresAt time.Time
+	// Attributes are keyed by their name, and by their friendly name too.
+	Attributes map[string][]string
+}
+
+// Validate checks the response and returns its assertion (SAML Profiles,
+// section 4.1.4.3). requestID is the ID of the AuthnRequest it answers, or
+// empty for a login the provider started.
+func (sp *ServiceProvider) Validate(response *Response, idp *IdentityProvider, requestID string) (*Assertion, error) {
+	root := response.root
+	if destination := root.SelectAttrValue("Destination", ""); destination != "" && destination != sp.ACSURL {
+		return nil, fmt.Errorf("%w: destination %q", ErrInvalidResponse, destination)
+	}
+	if response.InResponseTo != requestID && response.InResponseTo != "" {
+		return nil, fmt.Errorf("%w: InResponseTo %q", ErrInvalidResponse, response.InResponseTo)
+	}
+	if code := statusCode(root); code != statusSuccess {
+		return nil, fmt.Errorf("%w: %s", ErrStatus, code)
+	}
+	if child(root, nsAssertion, "EncryptedAssertion") != nil {
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidResponse)
+	}
+	// More than one assertion is how signatures get wrapped around forged ones
+	assertions := children(root, nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("%w: %d assertions", ErrInvalidResponse, len(assertions))
+	}
+
+	verified, err := verify(root, assertions[0], idp)
+	if err != nil {
+		return nil, err
+	}
+	return sp.check(verified, idp, requestID)
+}
+
+// verify checks the signature of the response or, without one, of the
+// assertion, and returns the assertion as it was signed. Nothing but the
+// element the signature covers may be read afterwards.
+func verify(root *etree.Element, assertion *etree.Element, idp *IdentityProvider) (*etree.Element, error) {
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: idp.Certificates})
+
+	if child(root, nsSignature, "Signature") != nil {
+		signed, err := ctx.Validate(detach(root))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		assertions := children(signed, nsAssertion, "Assertion")
+		if len(assertions) != 1 {
+			return nil, fmt.Errorf("%w: %d signed assertions", ErrInvalidSignature, len(assertions))
+		}
+		return assertions[0], nil
+	}
+
+	if child(assertion, nsSignature, "Signature") == nil {
+		return nil, fmt.Errorf("%w: not signed", ErrInvalidSignature)
+	}
+	signed, err := ctx.Validate(detach(assertion))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	return signed, nil
+}
+
+type assertionXML struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID      string   `xml:"ID,attr"`
+	Version string   `xml:"Version,attr"`
+	Issuer  string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		Confirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				Recipient    string    `xml:"Recipient,attr"`
+				InResponseTo string    `xml:"InResponseTo,attr"`
+				NotBefore    time.Time `xml:"NotBefore,attr"`
+				NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions *struct {
+		NotBefore    time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+		Restrictions []struct {
+			Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	AuthnStatements []struct {
+		SessionIndex string `xml:"SessionIndex,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnStatement"`
+	AttributeStatements []struct {
+		Attributes []struct {
+			Name         string   `xml:"Name,attr"`
+			FriendlyName string   `xml:"FriendlyName,attr"`
+			Values       []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
+}
+
+// check validates the conditions of a signed assertion.
+func (sp *ServiceProvider) check(el *etree.Element, idp *IdentityProvider, requestID string) (*Assertion, error) {
+	doc := etree.NewDocument()
+	doc.SetRoot(detach(el))
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+	var a assertionXML
+	if err := xml.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAssertion, err)
+	}
+
+	now := time.Now()
+	if a.Version != "2.0" || a.ID == "" {
+		return nil, fmt.Errorf("%w: version %q", ErrInvalidAssertion, a.Version)
+	}
+	if strings.TrimSpace(a.Issuer) != idp.EntityID {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidAssertion, a.Issuer)
+	}
+	nameID := strings.TrimSpace(a.Subject.NameID.Value)
+	if nameID == "" {
+		return nil, fmt.Errorf("%w: no NameID", ErrInvalidAssertion)
+	}
+	if len(a.AuthnStatements) == 0 {
+		return nil, fmt.Errorf("%w: no AuthnStatement", ErrInvalidAssertion)
+	}
+
+	// One bearer confirmation must be for this service, this request and now
+	var expiresAt time.Time
+	for _, confirmation := range a.Subject.Confirmations {
+		data := confirmation.Data
+		if confirmation.Method != confirmationBearer ||
+			data.Recipient != sp.ACSURL ||
+			data.InResponseTo != requestID ||
+			data.NotOnOrAfter.IsZero() || !now.Before(data.NotOnOrAfter.Add(clockSkew)) ||
+			(!data.NotBefore.IsZero() && now.Add(clockSkew).Before(data.NotBefore)) {
+			continue
+		}
+		expiresAt = data.NotOnOrAfter
+		break
+	}
+	if expiresAt.IsZero() {
+		return nil, fmt.Errorf("%w: no valid bearer confirmation", ErrInvalidAssertion)
+	}
+
+	conditions := a.Conditions
+	if conditions == nil || len(conditions.Restrictions) == 0 {
+		return nil, fmt.Errorf("%w: no audience restriction", ErrInvalidAssertion)
+	}
+	if !conditions.NotBefore.IsZero() && now.Add(clockSkew).Before(conditions.NotBefore) {
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidAssertion)
+	}
+	if !conditions.NotOnOrAfter.IsZero() {
+		if !now.Before(conditions.NotOnOrAfter.Add(clockSkew)) {
+			return nil, fmt.Errorf("%w: expired", ErrInvalidAssertion)
+		}
+		if conditions.NotOnOrAfter.Before(expiresAt) {
+			expiresAt = conditions.NotOnOrAfter
+		}
+	}
+	// Every restriction applies, each is met by any of its audiences
+	for _, restriction := range conditions.Restrictions {
+		if !slices.Contains(restriction.Audiences, sp.EntityID) {
+			return nil, fmt.Errorf("%w: audience %q", ErrInvalidAssertion, restriction.Audiences)
+		}
+	}
+
+	assertion := &Assertion{
+		ID:           a.ID,
+		Issuer:       idp.EntityID,
+		NameID:       nameID,
+		NameIDFormat: a.Subject.NameID.Format,
+		SessionIndex: a.AuthnStatements[0].SessionIndex,
+		ExpiresAt:    expiresAt.Add(clockSkew),
+		Attributes:   map[string][]string{},
+	}
+	for _, statement := range a.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			var values []string
+			for _, value := range attribute.Values {
+				values = append(values, strings.TrimSpace(value))
+			}
+			assertion.Attributes[attribute.Name] = append(assertion.Attributes[attribute.Name], values...)
+			if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+				assertion.Attributes[attribute.FriendlyName] = append(assertion.Attributes[attribute.FriendlyName], values...)
+			}
+		}
+	}
+	return assertion, nil
+}
+
+// Attribute returns the first value of the attribute.
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func statusCode(root *etree.Element) string {
+	status := child(root, nsProtocol, "Status")
+	if status == nil {
+		return ""
+	}
+	code := child(status, nsProtocol, "StatusCode")
+	if code == nil {
+		return ""
+	}
+	return code.SelectAttrValue("Value", "")
+}
+
+func child(el *etree.Element, space, tag string) *etree.Element {
+	if found := children(el, space, tag); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+func children(el *etree.Element, space, tag string) []*etree.Element {
+	var found []*etree.Element
+	for _, c := range el.ChildElements() {
+		if c.Tag == tag && c.NamespaceURI() == space {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// detach copies the element with the namespaces it inherits declared on it,
+// so that it reads the same out of its document.
+func detach(el *etree.Element) *etree.Element {
+	copied := el.Copy()
+	declared := map[string]bool{}
+	for _, attr := range copied.Attr {
+		if attr.Space == "xmlns" || (attr.Space == "" && attr.Key == "xmlns") {
+			declared[attr.Key] = true
+		}
+	}
+	for parent := el.Parent(); parent != nil; parent = parent.Parent() {
+		for _, attr := range parent.Attr {
+			key := ""
+			switch {
+			case attr.Space == "xmlns":
+				key = attr.Key
+			case attr.Space == "" && attr.Key == "xmlns":
+				key = "xmlns"
+			default:
+				continue
+			}
+			if declared[key] {
+				continue
+			}
+			declared[key] = true
+			copied.CreateAttr(attr.FullKey(), attr.Value)
+		}
+	}
+	return copied
+}
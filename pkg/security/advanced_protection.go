@@ -2,6 +2,7 @@ package security
 
 import (
 	"crypto/rand"
+	"strings"
 	"sync"
 	"time"
 )
@@ -91,8 +92,9 @@ func (a *AdvancedProtection) RecordFailedAttempt(ip string, username string) boo
 
 func (a *AdvancedProtection) checkSuspiciousPatterns(username string) int {
 	score := 0
+	username = strings.ToLower(username)
 	for _, pattern := range a.suspiciousPatterns {
-		if len(username) >= len(pattern.Pattern) {
+		if strings.Contains(username, pattern.Pattern) {
 			score += pattern.Weight
 		}
 	}
@@ -135,3 +137,12 @@ func (a *AdvancedProtection) IsIPBlocked(ip string) bool {
 	}
 	return false
 }
+
+// Notify publishes an event raised outside of the brute force checks.
+// It never blocks the caller: when the channel is full the event is dropped.
+func (a *AdvancedProtection) Notify(message string) {
+	select {
+	case a.notificationChan <- message:
+	default:
+	}
+}
@@ -0,0 +1,52 @@
+package security
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows a number of events per key in a fixed time window, e.g.
+// emails sent per address or per IP.
+type RateLimiter struct {
+	windows map[string]window
+	lock    sync.Mutex
+	limit   int
+	period  time.Duration
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func NewRateLimiter(limit int, period time.Duration) *RateLimiter {
+	return &RateLimiter{
+		windows: make(map[string]window),
+		limit:   limit,
+		period:  period,
+	}
+}
+
+// Allow records an event for the key and reports whether it is within the limit.
+func (r *RateLimiter) Allow(key string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	w := r.windows[key]
+	if now.Sub(w.start) >= r.period {
+		// Forget the windows that are over while we are at it
+		for k, old := range r.windows {
+			if now.Sub(old.start) >= r.period {
+				delete(r.windows, k)
+			}
+		}
+		w = window{start: now}
+	}
+	if w.count >= r.limit {
+		return false
+	}
+	w.count++
+	r.windows[key] = w
+	return true
+}
@@ -0,0 +1,88 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+)
+
+// idFidoGenCeAAGUID is the certificate extension naming the authenticator model.
+var idFidoGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// verifyPacked checks a "packed" attestation statement (WebAuthn §8.2): a
+// signature over the authenticator data and client data hash, made either
+// by an attestation certificate or by the credential itself.
+func verifyPacked(statement map[any]any, signed []byte, credential *Credential) error {
+	alg, ok := statement["alg"].(int64)
+	if !ok {
+		return fmt.Errorf("%w: packed without alg", ErrInvalidAttestation)
+	}
+	sig, ok := statement["sig"].([]byte)
+	if !ok {
+		return fmt.Errorf("%w: packed without sig", ErrInvalidAttestation)
+	}
+
+	x5c, hasCerts := statement["x5c"].([]any)
+	if !hasCerts {
+		// Self attestation
+		if alg != credential.Algorithm {
+			return fmt.Errorf("%w: alg %d differs from the credential", ErrInvalidAttestation, alg)
+		}
+		key, err := ParsePublicKey(credential.PublicKey)
+		if err != nil {
+			return err
+		}
+		if err := key.Verify(signed, sig); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+		}
+		return nil
+	}
+
+	if len(x5c) == 0 {
+		return fmt.Errorf("%w: empty x5c", ErrInvalidAttestation)
+	}
+	der, ok := x5c[0].([]byte)
+	if !ok {
+		return fmt.Errorf("%w: bad x5c", ErrInvalidAttestation)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+	if !slices.Contains(Algorithms, alg) || !verifySignature(alg, cert.PublicKey, signed, sig) {
+		return fmt.Errorf("%w: %w", ErrInvalidAttestation, ErrInvalidSignature)
+	}
+	return checkAttestationCertificate(cert, credential.AAGUID)
+}
+
+// checkAttestationCertificate applies the requirements of WebAuthn §8.2.1.
+func checkAttestationCertificate(cert *x509.Certificate, aaguid []byte) error {
+	if cert.Version != 3 {
+		return fmt.Errorf("%w: certificate version %d", ErrInvalidAttestation, cert.Version)
+	}
+	if !slices.Contains(cert.Subject.OrganizationalUnit, "Authenticator Attestation") {
+		return fmt.Errorf("%w: certificate subject OU", ErrInvalidAttestation)
+	}
+	if len(cert.Subject.Country) == 0 || len(cert.Subject.Organization) == 0 || cert.Subject.CommonName == "" {
+		return fmt.Errorf("%w: certificate subject", ErrInvalidAttestation)
+	}
+	if cert.IsCA {
+		return fmt.Errorf("%w: CA certificate", ErrInvalidAttestation)
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idFidoGenCeAAGUID) {
+			continue
+		}
+		if ext.Critical {
+			return fmt.Errorf("%w: critical AAGUID extension", ErrInvalidAttestation)
+		}
+		var value []byte
+		if _, err := asn1.Unmarshal(ext.Value, &value); err != nil || !bytes.Equal(value, aaguid) {
+			return fmt.Errorf("%w: AAGUID mismatch", ErrInvalidAttestation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers, see the IANA COSE registry.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgES384 = -35
+	AlgRS256 = -257
+)
+
+// Algorithms are offered to authenticators in order of preference.
+var Algorithms = []int64{AlgES256, AlgEdDSA, AlgES384, AlgRS256}
+
+// COSE key parameters
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // also the RSA modulus n
+	coseX   = -2 // also the RSA exponent e
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvP384    = 2
+	crvEd25519 = 6
+)
+
+// PublicKey is a credential public key decoded from its COSE form.
+type PublicKey struct {
+	Algorithm int64
+	key       crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key (RFC 9052) as stored with the credential.
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	item, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidPublicKey)
+	}
+	return publicKeyFrom(item)
+}
+
+func publicKeyFrom(item any) (*PublicKey, error) {
+	params, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a map", ErrInvalidPublicKey)
+	}
+	kty, _ := params[int64(coseKty)].(int64)
+	alg, _ := params[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && (alg == AlgES256 || alg == AlgES384):
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+
+		size := 32
+		if alg == AlgES384 {
+			size = 48
+		}
+		if (alg == AlgES256 && crv != crvP256) || (alg == AlgES384 && crv != crvP384) {
+			return nil, fmt.Errorf("%w: curve %d with alg %d", ErrInvalidPublicKey, crv, alg)
+		}
+		if len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("%w: bad coordinates", ErrInvalidPublicKey)
+		}
+		key, err := ecdsaKey(alg, x, y)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+		}
+		return &PublicKey{alg, key}, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: bad Ed25519 key", ErrInvalidPublicKey)
+		}
+		return &PublicKey{alg, ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := params[int64(coseCrv)].([]byte)
+		e, _ := params[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: bad RSA key", ErrInvalidPublicKey)
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &PublicKey{alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	}
+	return nil, fmt.Errorf("%w: kty %d alg %d", ErrUnsupportedAlgorithm, kty, alg)
+}
+
+func ecdsaKey(alg int64, x []byte, y []byte) (*ecdsa.PublicKey, error) {
+	curve, check := elliptic.P256(), ecdh.P256()
+	if alg == AlgES384 {
+		curve, check = elliptic.P384(), ecdh.P384()
+	}
+	// crypto/ecdh rejects points that are not on the curve
+	if _, err := check.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+// Verify checks a signature the authenticator made over data.
+func (k *PublicKey) Verify(data []byte, signature []byte) error {
+	if !verifySignature(k.Algorithm, k.key, data, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func verifySignature(alg int64, key crypto.PublicKey, data []byte, signature []byte) bool {
+	switch alg {
+	case AlgES256:
+		ec, ok := key.(*ecdsa.PublicKey)
+		sum := sha256.Sum256(data)
+		return ok && ecdsa.VerifyASN1(ec, sum[:], signature)
+	case AlgES384:
+		ec, ok := key.(*ecdsa.PublicKey)
+		sum := sha512.Sum384(data)
+		return ok && ecdsa.VerifyASN1(ec, sum[:], signature)
+	case AlgEdDSA:
+		ed, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(ed, data, signature)
+	case AlgRS256:
+		r, ok := key.(*rsa.PublicKey)
+		sum := sha256.Sum256(data)
+		return ok && rsa.VerifyPKCS1v15(r, crypto.SHA256, sum[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// URLEncoded is binary data written as unpadded base64url in JSON, the way
+// PublicKeyCredential.toJSON() and the WebAuthn JSON options encode it.
+type URLEncoded []byte
+
+func (u URLEncoded) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Encoding.EncodeToString(u))
+}
+
+func (u *URLEncoded) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	// Some clients pad the value
+	decoded, err := Encoding.DecodeString(strings.TrimRight(raw, "="))
+	if err != nil {
+		return err
+	}
+	*u = decoded
+	return nil
+}
+
+type CredentialDescriptor struct {
+	Type       string     `json:"type"`
+	ID         URLEncoded `json:"id"`
+	Transports []string   `json:"transports,omitempty"`
+}
+
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          URLEncoded `json:"id"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"displayName"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are passed to navigator.credentials.create().
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get(). Without allowed
+// credentials the authenticator offers its discoverable ones (passkeys).
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON form of the credential create() returns.
+type RegistrationResponse struct {
+	ID       string     `json:"id"`
+	RawID    URLEncoded `json:"rawId"`
+	Type     string     `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncoded `json:"clientDataJSON"`
+		AttestationObject URLEncoded `json:"attestationObject"`
+		Transports        []string   `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the credential get() returns.
+type AssertionResponse struct {
+	ID       string     `json:"id"`
+	RawID    URLEncoded `json:"rawId"`
+	Type     string     `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncoded `json:"clientDataJSON"`
+		AuthenticatorData URLEncoded `json:"authenticatorData"`
+		Signature         URLEncoded `json:"signature"`
+		UserHandle        URLEncoded `json:"userHandle"`
+	} `json:"response"`
+}
+
+// CreationOptions asks for a new credential of the user. Existing
+// credentials are excluded so that an authenticator is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge string, user UserEntity, exclude []CredentialDescriptor, timeout int64) CreationOptions {
+	params := make([]CredentialParameter, len(Algorithms))
+	for i, alg := range Algorithms {
+		params[i] = CredentialParameter{Type: "public-key", Algorithm: alg}
+	}
+	return CreationOptions{
+		Challenge:          challenge,
+		RP:                 RPEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		PubKeyCredParams:   params,
+		Timeout:            timeout,
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "direct",
+	}
+}
+
+// RequestOptions asks for an assertion. Passwordless logins require user
+// verification, which makes the passkey a second factor in itself.
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor, timeout int64) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          timeout,
+		AllowCredentials: allow,
+		UserVerification: "required",
+	}
+}
@@ -0,0 +1,272 @@
+// Package webauthn verifies the registration and authentication ceremonies
+// of the Web Authentication API (https://www.w3.org/TR/webauthn-2/) on the
+// relying party side. Attestation formats "none" and "packed" are supported;
+// attestation certificates are checked but not chained to trusted roots.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrInvalidClientData    = errors.New("Невалидные данные клиента WebAuthn")
+	ErrInvalidAuthData      = errors.New("Невалидные данные аутентификатора")
+	ErrInvalidAttestation   = errors.New("Невалидная аттестация")
+	ErrInvalidPublicKey     = errors.New("Невалидный открытый ключ")
+	ErrInvalidSignature     = errors.New("Невалидная подпись аутентификатора")
+	ErrUnsupportedAlgorithm = errors.New("Неподдерживаемый алгоритм аутентификатора")
+	ErrUserNotPresent       = errors.New("Пользователь не подтвердил присутствие")
+	ErrUserNotVerified      = errors.New("Пользователь не прошел проверку на аутентификаторе")
+)
+
+// Authenticator data flags
+const (
+	FlagUserPresent    = 0x01
+	FlagUserVerified   = 0x04
+	FlagBackupEligible = 0x08
+	FlagBackedUp       = 0x10
+	FlagAttestedData   = 0x40
+	FlagExtensions     = 0x80
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// Encoding is how WebAuthn binary values travel in JSON.
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty is this service as seen by authenticators.
+type RelyingParty struct {
+	// ID is the domain credentials are scoped to.
+	ID   string
+	Name string
+	// Origins are the web origins the ceremonies may run on.
+	Origins []string
+}
+
+// NewChallenge returns a random challenge, encoded as it appears in the client data.
+func NewChallenge() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return Encoding.EncodeToString(buf), nil
+}
+
+// Credential is a newly registered credential.
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE_Key to pass to ParsePublicKey later.
+	PublicKey []byte
+	Algorithm int64
+	SignCount uint32
+	AAGUID    []byte
+	Flags     byte
+	// Format is the attestation statement format.
+	Format string
+}
+
+// Assertion is a verified authentication.
+type Assertion struct {
+	SignCount uint32
+	Flags     byte
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create().
+func (rp *RelyingParty) VerifyRegistration(
+	challenge string,
+	clientDataJSON []byte,
+	attestationObject []byte,
+	requireUserVerification bool,
+) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+	object, ok := item.(map[any]any)
+	if !ok {
+		return nil, ErrInvalidAttestation
+	}
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[any]any)
+	rawAuthData, _ := object["authData"].([]byte)
+	if statement == nil {
+		return nil, fmt.Errorf("%w: no attStmt", ErrInvalidAttestation)
+	}
+
+	authData, err := rp.parseAuthData(rawAuthData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credential == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrInvalidAuthData)
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return nil, fmt.Errorf("%w: none with a statement", ErrInvalidAttestation)
+		}
+	case "packed":
+		if err := verifyPacked(statement, signed, authData.credential); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: format %q", ErrInvalidAttestation, format)
+	}
+
+	credential := authData.credential
+	credential.SignCount = authData.signCount
+	credential.Flags = authData.flags
+	credential.Format = format
+	return credential, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get() against
+// the public key stored at registration.
+func (rp *RelyingParty) VerifyAssertion(
+	challenge string,
+	publicKey []byte,
+	clientDataJSON []byte,
+	authenticatorData []byte,
+	signature []byte,
+	requireUserVerification bool,
+) (*Assertion, error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyGet, challenge); err != nil {
+		return nil, err
+	}
+	authData, err := rp.parseAuthData(authenticatorData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := key.Verify(append(append([]byte(nil), authenticatorData...), clientDataHash[:]...), signature); err != nil {
+		return nil, err
+	}
+	return &Assertion{SignCount: authData.signCount, Flags: authData.flags}, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ChallengeOf reads the challenge the client data answers, to look up the
+// ceremony it belongs to. The response still has to be verified.
+func ChallengeOf(clientDataJSON []byte) (string, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidClientData, err)
+	}
+	return data.Challenge, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidClientData, err)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: type %q", ErrInvalidClientData, data.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidClientData)
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return fmt.Errorf("%w: origin %q", ErrInvalidClientData, data.Origin)
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin", ErrInvalidClientData)
+	}
+	return nil
+}
+
+type authData struct {
+	flags      byte
+	signCount  uint32
+	credential *Credential
+}
+
+// parseAuthData decodes the authenticator data and checks it was made for
+// this relying party.
+func (rp *RelyingParty) parseAuthData(raw []byte, requireUserVerification bool) (authData, error) {
+	// rpIdHash, flags and signCount
+	if len(raw) < 37 {
+		return authData{}, fmt.Errorf("%w: too short", ErrInvalidAuthData)
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(raw[:32], rpIDHash[:]) {
+		return authData{}, fmt.Errorf("%w: rpIdHash mismatch", ErrInvalidAuthData)
+	}
+	data := authData{flags: raw[32], signCount: binary.BigEndian.Uint32(raw[33:37])}
+	if data.flags&FlagUserPresent == 0 {
+		return authData{}, ErrUserNotPresent
+	}
+	if requireUserVerification && data.flags&FlagUserVerified == 0 {
+		return authData{}, ErrUserNotVerified
+	}
+
+	rest := raw[37:]
+	if data.flags&FlagAttestedData != 0 {
+		// aaguid and credentialIdLength
+		if len(rest) < 18 {
+			return authData{}, fmt.Errorf("%w: truncated credential", ErrInvalidAuthData)
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		if idLength > 1023 || len(rest) < 18+idLength {
+			return authData{}, fmt.Errorf("%w: bad credential id", ErrInvalidAuthData)
+		}
+		credential := &Credential{
+			AAGUID: append([]byte(nil), rest[:16]...),
+			ID:     append([]byte(nil), rest[18:18+idLength]...),
+		}
+		rest = rest[18+idLength:]
+
+		item, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authData{}, fmt.Errorf("%w: %w", ErrInvalidAuthData, err)
+		}
+		key, err := publicKeyFrom(item)
+		if err != nil {
+			return authData{}, err
+		}
+		credential.PublicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+		credential.Algorithm = key.Algorithm
+		data.credential = credential
+		rest = after
+	}
+	if data.flags&FlagExtensions != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return authData{}, fmt.Errorf("%w: %w", ErrInvalidAuthData, err)
+		}
+	}
+	if len(rest) != 0 {
+		return authData{}, fmt.Errorf("%w: trailing data", ErrInvalidAuthData)
+	}
+	return data, nil
+}